@@ -27,6 +27,7 @@ import (
 	dockerclient "github.com/docker/docker/client"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
 
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
 )
@@ -57,6 +58,7 @@ type ConnectorOptions struct {
 
 type Execution struct {
 	base.Execution
+	util.ExecutionContext
 	connector *Connector
 }
 
@@ -218,7 +220,8 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 		}
 	}()
 
-	out, err := e.connector.dockerClient.ImagePull(context.Background(), imageName, types.ImagePullOptions{})
+	ctx := e.Context()
+	out, err := e.connector.dockerClient.ImagePull(ctx, imageName, types.ImagePullOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -228,7 +231,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 		return nil, err
 	}
 
-	resp, err := e.connector.dockerClient.ContainerCreate(context.Background(),
+	resp, err := e.connector.dockerClient.ContainerCreate(ctx,
 		&container.Config{
 			Image:        imageName,
 			AttachStdin:  true,
@@ -273,7 +276,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 		return nil, err
 	}
 
-	hijackedResp, err := e.connector.dockerClient.ContainerAttach(context.Background(), resp.ID, types.ContainerAttachOptions{
+	hijackedResp, err := e.connector.dockerClient.ContainerAttach(ctx, resp.ID, types.ContainerAttachOptions{
 		Stdout: true,
 		Stdin:  true,
 		Stream: true,
@@ -288,16 +291,27 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 		return nil, err
 	}
 
-	if err := e.connector.dockerClient.ContainerStart(context.Background(), resp.ID, types.ContainerStartOptions{}); err != nil {
+	if err := e.connector.dockerClient.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
 		return nil, err
 	}
 
+	// Reading the output doesn't observe the context, so the connection is
+	// closed when the execution is cancelled.
+	stop := context.AfterFunc(ctx, hijackedResp.Close)
+	defer stop()
+
 	var bufStdOut bytes.Buffer
 	if _, err := bufStdOut.ReadFrom(hijackedResp.Reader); err != nil {
+		if ctx.Err() != nil {
+			e.removeContainer(resp.ID)
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
 
-	if err := e.connector.dockerClient.ContainerRemove(context.Background(), resp.ID,
+	// The container is removed even if the execution has been cancelled in
+	// the meantime.
+	if err := e.connector.dockerClient.ContainerRemove(context.WithoutCancel(ctx), resp.ID,
 		types.ContainerRemoveOptions{
 			RemoveVolumes: true,
 			Force:         true,
@@ -328,6 +342,19 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 	return outputs, nil
 }
 
+// removeContainer stops and removes the container of a cancelled execution,
+// so it doesn't keep running in the background.
+func (e *Execution) removeContainer(containerID string) {
+	err := e.connector.dockerClient.ContainerRemove(context.WithoutCancel(e.Context()), containerID,
+		types.ContainerRemoveOptions{
+			RemoveVolumes: true,
+			Force:         true,
+		})
+	if err != nil {
+		e.Logger.Error(err.Error())
+	}
+}
+
 func (c *Connector) Test(defUID uuid.UUID, config *structpb.Struct, logger *zap.Logger) (pipelinePB.Connector_State, error) {
 
 	def, err := c.GetConnectorDefinitionByUID(defUID, nil, nil)
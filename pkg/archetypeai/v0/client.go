@@ -17,6 +17,7 @@ func newClient(config *structpb.Struct, logger *zap.Logger) *httpclient.Client {
 	c := httpclient.New("Archetype AI", getBasePath(config),
 		httpclient.WithLogger(logger),
 		httpclient.WithEndUserError(new(errBody)),
+		httpclient.WithRetry(httpclient.DefaultRetryPolicy),
 	)
 
 	c.SetAuthToken(getAPIKey(config))
@@ -2,6 +2,7 @@ package archetypeai
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
 	"fmt"
 	"strings"
@@ -41,7 +42,8 @@ type connector struct {
 
 type execution struct {
 	base.Execution
-	execute func(*structpb.Struct) (*structpb.Struct, error)
+	util.ExecutionContext
+	execute func(context.Context, *structpb.Struct) (*structpb.Struct, error)
 	client  *httpclient.Client
 }
 
@@ -89,21 +91,12 @@ func (c *connector) CreateExecution(defUID uuid.UUID, task string, config *struc
 
 // Execute performs calls the Archetype AI API to execute a task.
 func (e *execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
-	outputs := make([]*structpb.Struct, len(inputs))
-
-	for i, input := range inputs {
-		output, err := e.execute(input)
-		if err != nil {
-			return nil, err
-		}
-
-		outputs[i] = output
-	}
-
-	return outputs, nil
+	return util.ExecuteConcurrently(e.Context(), inputs, util.Concurrency(e.Context()), func(ctx context.Context, _ int, input *structpb.Struct) (*structpb.Struct, error) {
+		return e.execute(ctx, input)
+	})
 }
 
-func (e *execution) describe(in *structpb.Struct) (*structpb.Struct, error) {
+func (e *execution) describe(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
 	params := fileQueryParams{}
 	if err := base.ConvertFromStructpb(in, &params); err != nil {
 		return nil, err
@@ -113,7 +106,7 @@ func (e *execution) describe(in *structpb.Struct) (*structpb.Struct, error) {
 	// request. If this stops being the case in the future, we'll need a
 	// describeReq structure.
 	resp := describeResp{}
-	req := e.client.R().SetBody(params).SetResult(&resp)
+	req := e.client.R().SetContext(ctx).SetBody(params).SetResult(&resp)
 
 	if _, err := req.Post(describePath); err != nil {
 		return nil, err
@@ -138,7 +131,7 @@ func (e *execution) describe(in *structpb.Struct) (*structpb.Struct, error) {
 	return out, nil
 }
 
-func (e *execution) summarize(in *structpb.Struct) (*structpb.Struct, error) {
+func (e *execution) summarize(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
 	params := fileQueryParams{}
 	if err := base.ConvertFromStructpb(in, &params); err != nil {
 		return nil, err
@@ -148,7 +141,7 @@ func (e *execution) summarize(in *structpb.Struct) (*structpb.Struct, error) {
 	// request. If this stops being the case in the future, we'll need a
 	// summarizeReq structure.
 	resp := summarizeResp{}
-	req := e.client.R().SetBody(params).SetResult(&resp)
+	req := e.client.R().SetContext(ctx).SetBody(params).SetResult(&resp)
 
 	if _, err := req.Post(summarizePath); err != nil {
 		return nil, err
@@ -173,14 +166,14 @@ func (e *execution) summarize(in *structpb.Struct) (*structpb.Struct, error) {
 	return out, nil
 }
 
-func (e *execution) uploadFile(in *structpb.Struct) (*structpb.Struct, error) {
+func (e *execution) uploadFile(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
 	params := uploadFileParams{}
 	if err := base.ConvertFromStructpb(in, &params); err != nil {
 		return nil, err
 	}
 
 	resp := uploadFileResp{}
-	req := e.client.R().SetResult(&resp)
+	req := e.client.R().SetContext(ctx).SetResult(&resp)
 
 	b, err := util.DecodeBase64(params.File)
 	if err != nil {
@@ -17,8 +17,7 @@ func (v DataSaver) Save() (row map[string]bigquery.Value, insertID string, err e
 	return v.DataMap, bigquery.NoDedupeID, nil
 }
 
-func insertDataToBigQuery(projectID, datasetID, tableName string, valueSaver DataSaver, client *bigquery.Client) error {
-	ctx := context.Background()
+func insertDataToBigQuery(ctx context.Context, projectID, datasetID, tableName string, valueSaver DataSaver, client *bigquery.Client) error {
 	tableRef := client.Dataset(datasetID).Table(tableName)
 	inserter := tableRef.Inserter()
 	if err := inserter.Put(ctx, valueSaver); err != nil {
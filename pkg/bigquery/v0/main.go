@@ -14,6 +14,7 @@ import (
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
 
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
 )
@@ -37,6 +38,7 @@ type Connector struct {
 
 type Execution struct {
 	base.Execution
+	util.ExecutionContext
 }
 
 func Init(logger *zap.Logger) base.IConnector {
@@ -86,6 +88,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 	}
 	defer client.Close()
 
+	ctx := e.Context()
 	for _, input := range inputs {
 		var output *structpb.Struct
 		switch e.Task {
@@ -93,7 +96,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 			datasetID := getDatasetID(e.Config)
 			tableName := getTableName(e.Config)
 			tableRef := client.Dataset(datasetID).Table(tableName)
-			metaData, err := tableRef.Metadata(context.Background())
+			metaData, err := tableRef.Metadata(ctx)
 			if err != nil {
 				return nil, err
 			}
@@ -101,7 +104,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 			if err != nil {
 				return nil, err
 			}
-			err = insertDataToBigQuery(getProjectID(e.Config), datasetID, tableName, valueSaver, client)
+			err = insertDataToBigQuery(ctx, getProjectID(e.Config), datasetID, tableName, valueSaver, client)
 			if err != nil {
 				return nil, err
 			}
@@ -13,6 +13,7 @@ import (
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
 
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
 )
@@ -35,6 +36,7 @@ type Connector struct {
 
 type Execution struct {
 	base.Execution
+	util.ExecutionContext
 }
 
 func Init(logger *zap.Logger) base.IConnector {
@@ -78,6 +80,8 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 		return nil, fmt.Errorf("error creating GCS client: %v", err)
 	}
 	defer client.Close()
+
+	ctx := e.Context()
 	for _, input := range inputs {
 		var output *structpb.Struct
 		switch e.Task {
@@ -85,7 +89,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 			objectName := input.GetFields()["object_name"].GetStringValue()
 			data := input.GetFields()["data"].GetStringValue()
 			bucketName := getBucketName(e.Config)
-			err = uploadToGCS(client, bucketName, objectName, data)
+			err = uploadToGCS(ctx, client, bucketName, objectName, data)
 			if err != nil {
 				return nil, err
 			}
@@ -95,7 +99,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 			publicURL := ""
 
 			// Check whether the object is public or not
-			publicAccess, err := isObjectPublic(client, bucketName, objectName)
+			publicAccess, err := isObjectPublic(ctx, client, bucketName, objectName)
 			if err != nil {
 				return nil, err
 			}
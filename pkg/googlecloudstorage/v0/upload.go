@@ -11,8 +11,8 @@ import (
 	"github.com/instill-ai/component/pkg/base"
 )
 
-func uploadToGCS(client *storage.Client, bucketName, objectName, data string) error {
-	wc := client.Bucket(bucketName).Object(objectName).NewWriter(context.Background())
+func uploadToGCS(ctx context.Context, client *storage.Client, bucketName, objectName, data string) error {
+	wc := client.Bucket(bucketName).Object(objectName).NewWriter(ctx)
 	b, _ := base64.StdEncoding.DecodeString(base.TrimBase64Mime(data))
 	if _, err := io.WriteString(wc, string(b)); err != nil {
 		return err
@@ -22,8 +22,7 @@ func uploadToGCS(client *storage.Client, bucketName, objectName, data string) er
 
 // Check if an object in GCS is public or not
 // Refer to https://stackoverflow.com/questions/68722565/how-to-check-if-a-file-in-gcp-storage-is-public-or-not
-func isObjectPublic(client *storage.Client, bucketName, objectName string) (bool, error) {
-	ctx := context.Background()
+func isObjectPublic(ctx context.Context, client *storage.Client, bucketName, objectName string) (bool, error) {
 	bucket := client.Bucket(bucketName)
 	attrs, err := bucket.Attrs(ctx)
 	if err != nil {
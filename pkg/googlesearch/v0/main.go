@@ -14,6 +14,7 @@ import (
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
 
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
 )
@@ -37,6 +38,7 @@ type Connector struct {
 
 type Execution struct {
 	base.Execution
+	util.ExecutionContext
 }
 
 func Init(logger *zap.Logger) base.IConnector {
@@ -79,11 +81,8 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 	if err != nil || service == nil {
 		return nil, fmt.Errorf("error creating Google custom search service: %v", err)
 	}
-	cseListCall := service.Cse.List().Cx(getSearchEngineID(e.Config))
 
-	outputs := []*structpb.Struct{}
-
-	for _, input := range inputs {
+	return util.ExecuteConcurrently(e.Context(), inputs, util.Concurrency(e.Context()), func(ctx context.Context, _ int, input *structpb.Struct) (*structpb.Struct, error) {
 		switch e.Task {
 		case taskSearch:
 
@@ -93,6 +92,10 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 				return nil, err
 			}
 
+			// Calls aren't safe for concurrent use, so each input builds
+			// its own.
+			cseListCall := service.Cse.List().Cx(getSearchEngineID(e.Config)).Context(ctx)
+
 			// Make the search request
 			outputStruct, err := search(cseListCall, inputStruct)
 
@@ -109,14 +112,12 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 			if err != nil {
 				return nil, err
 			}
-			outputs = append(outputs, &output)
+			return &output, nil
 
 		default:
 			return nil, fmt.Errorf("not supported task: %s", e.Task)
 		}
-	}
-
-	return outputs, nil
+	})
 }
 
 func (c *Connector) Test(defUID uuid.UUID, config *structpb.Struct, logger *zap.Logger) (pipelinePB.Connector_State, error) {
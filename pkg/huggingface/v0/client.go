@@ -1,34 +1,108 @@
 package huggingface
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/gofrs/uuid"
 	"github.com/instill-ai/connector/pkg/util/httpclient"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/instill-ai/x/errmsg"
 )
 
 const (
 	modelsPath = "/models/"
+
+	// Text Generation Inference routes.
+	tgiGeneratePath       = "/generate"
+	tgiGenerateStreamPath = "/generate_stream"
+
+	// The serverless Inference API serves the models under /models/{model}.
+	endpointModeInferenceAPI = "inference_api"
+	// Inference Endpoints serve a single model at their base URL.
+	endpointModeInferenceEndpoint = "inference_endpoint"
+	// Text Generation Inference serves a single model at its base URL and
+	// has specific routes for text generation.
+	endpointModeTGI = "tgi"
 )
 
-func newClient(config *structpb.Struct, logger *zap.Logger) *httpclient.Client {
+// newClient returns a Hugging Face client. Clients of the same connector
+// definition and API key share their rate limit. The model loading failures
+// aren't retried by the client but left to post, which handles them according
+// to the cold start strategy.
+func newClient(defUID uuid.UUID, config *structpb.Struct, logger *zap.Logger, retry httpclient.RetryPolicy) *httpclient.Client {
+	retry.Skip = isModelLoading
 	c := httpclient.New("Hugging Face", getBaseURL(config),
 		httpclient.WithLogger(logger),
 		httpclient.WithEndUserError(new(errBody)),
+		httpclient.WithRetry(retry),
+		httpclient.WithRateLimit(defUID.String()+getAPIKey(config), getRateLimit(config)),
 	)
 
 	c.SetAuthToken(getAPIKey(config))
+	if getColdStartStrategy(config) == coldStartWaitForModel {
+		c.SetHeader(waitForModelHeader, "true")
+	}
 
 	return c
 }
 
+// maxErrorBodySize caps the size of the error responses read from a stream.
+const maxErrorBodySize = 1 << 20
+
+// errorBody returns the body of an error response. Unparsed responses (e.g.
+// streams) are read and their body is kept in the response, so the caller can
+// still read it.
+func errorBody(resp *resty.Response) []byte {
+	if b := resp.Body(); len(b) > 0 || resp.RawBody() == nil || !resp.IsError() {
+		return b
+	}
+
+	raw := resp.RawBody()
+	b, _ := io.ReadAll(io.LimitReader(raw, maxErrorBodySize))
+	raw.Close()
+
+	resp.SetBody(b)
+	resp.RawResponse.Body = io.NopCloser(bytes.NewReader(b))
+	return b
+}
+
+// modelLoading returns the error of a response if it's a 503 error returned
+// while the model loads.
+func modelLoading(resp *resty.Response) (errBody, bool) {
+	var e errBody
+	if resp.StatusCode() != http.StatusServiceUnavailable {
+		return e, false
+	}
+
+	if err := json.Unmarshal(errorBody(resp), &e); err != nil {
+		return e, false
+	}
+
+	return e, e.EstimatedTime != nil || strings.Contains(strings.ToLower(e.Message()), "loading")
+}
+
+// isModelLoading reports whether a response is a 503 error returned while the
+// model loads.
+func isModelLoading(resp *resty.Response) bool {
+	_, ok := modelLoading(resp)
+	return ok
+}
+
 type errBody struct {
 	// Error can be either a string or a string array.
 	Error json.RawMessage `json:"error,omitempty"`
+	// EstimatedTime is the time, in seconds, the model needs to load. It is
+	// returned with a 503 status code while the model is loading.
+	EstimatedTime *float64 `json:"estimated_time,omitempty"`
 }
 
 func (e errBody) Message() string {
@@ -45,11 +119,62 @@ func (e errBody) Message() string {
 	return ""
 }
 
+// post sends a request. If the model is loading and the cold start strategy
+// is to poll, the request is sent again until the model is loaded or the
+// maximum load time is reached.
 func post(req *resty.Request, path string) (*resty.Response, error) {
-	resp, err := req.Post(path)
-	if err != nil {
-		err = httpclient.WrapURLError(err)
-	}
+	load, _ := req.Context().Value(modelLoadKey{}).(*modelLoad)
+	start := time.Now()
+	backoff := minLoadPoll
+	for attempt := 0; ; attempt++ {
+		// The error of a previous response must not be reused.
+		req.SetError(new(errBody))
+
+		attemptStart := time.Now()
+		resp, err := req.Post(path)
+		if err != nil {
+			err = httpclient.WrapURLError(err)
+		}
+
+		var loading errBody
+		var isLoading bool
+		if resp != nil {
+			loading, isLoading = modelLoading(resp)
+		}
 
-	return resp, err
+		if load == nil || load.maxWait <= 0 || !isLoading {
+			if attempt > 0 {
+				load.waited += attemptStart.Sub(start)
+			}
+
+			return resp, err
+		}
+
+		wait := backoff
+		if loading.EstimatedTime != nil {
+			wait = time.Duration(*loading.EstimatedTime * float64(time.Second))
+		}
+		backoff = min(2*backoff, maxLoadPoll)
+
+		remaining := load.maxWait - time.Since(start)
+		if remaining <= 0 {
+			if err == nil {
+				// Unparsed responses (e.g. streams) are handled by the
+				// caller.
+				return resp, nil
+			}
+
+			return resp, errmsg.AddMessage(err, fmt.Sprintf("The model didn't load in %s.", load.maxWait))
+		}
+
+		if body := resp.RawBody(); body != nil {
+			body.Close()
+		}
+
+		select {
+		case <-time.After(min(max(wait, minLoadPoll), remaining)):
+		case <-req.Context().Done():
+			return resp, req.Context().Err()
+		}
+	}
 }
@@ -0,0 +1,81 @@
+package huggingface
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Models that aren't used for a while are unloaded from the Inference API,
+// and dedicated endpoints can scale to zero. Until the model is loaded again,
+// requests fail with a 503 status code. The cold start strategy defines how
+// these failures are handled. By default, they are returned to the user, as
+// the other strategies keep the execution waiting.
+const (
+	// coldStartPoll sends the request again until the model is loaded,
+	// waiting for the load time estimated by Hugging Face or, if there's no
+	// estimation, with an exponential backoff.
+	coldStartPoll = "poll"
+	// coldStartWaitForModel asks the Inference API to hold the request until
+	// the model is loaded.
+	coldStartWaitForModel = "wait_for_model"
+	// coldStartFail returns the error to the user.
+	coldStartFail = "fail"
+
+	waitForModelHeader = "X-Wait-For-Model"
+
+	defaultMaxModelLoadTime = 5 * time.Minute
+
+	// minLoadPoll and maxLoadPoll bound the time between polls when Hugging
+	// Face doesn't estimate the load time.
+	minLoadPoll = time.Second
+	maxLoadPoll = 30 * time.Second
+)
+
+func getColdStartStrategy(config *structpb.Struct) string {
+	if v := config.GetFields()["cold_start_strategy"].GetStringValue(); v != "" {
+		return v
+	}
+
+	return coldStartFail
+}
+
+func getMaxModelLoadTime(config *structpb.Struct) time.Duration {
+	if v, ok := config.GetFields()["max_model_load_time"]; ok {
+		return time.Duration(v.GetNumberValue() * float64(time.Second))
+	}
+
+	return defaultMaxModelLoadTime
+}
+
+// modelLoad tracks the time an input waits for the model to load.
+type modelLoad struct {
+	// maxWait is the time after which polling stops. Zero disables polling.
+	maxWait time.Duration
+	waited  time.Duration
+}
+
+type modelLoadKey struct{}
+
+// withModelLoad returns a context that makes post poll the endpoint while the
+// model loads, if the configuration requires it. The returned modelLoad will
+// hold the time spent waiting.
+func withModelLoad(ctx context.Context, config *structpb.Struct) (context.Context, *modelLoad) {
+	load := new(modelLoad)
+	if getColdStartStrategy(config) == coldStartPoll {
+		load.maxWait = getMaxModelLoadTime(config)
+	}
+
+	return context.WithValue(ctx, modelLoadKey{}, load), load
+}
+
+// addModelLoadTime reports the time spent waiting for the model to load in
+// the output, if any.
+func addModelLoadTime(output *structpb.Struct, load *modelLoad) {
+	if load.waited <= 0 {
+		return
+	}
+
+	output.Fields["model_load_time"] = structpb.NewNumberValue(load.waited.Seconds())
+}
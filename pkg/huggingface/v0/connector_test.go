@@ -1,12 +1,19 @@
 package huggingface
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	qt "github.com/frankban/quicktest"
 	"github.com/gofrs/uuid"
@@ -18,6 +25,14 @@ import (
 	"github.com/instill-ai/x/errmsg"
 )
 
+// testRetryPolicy keeps the retries of the tests short.
+var testRetryPolicy = httpclient.RetryPolicy{
+	MaxAttempts:    3,
+	MinWait:        time.Millisecond,
+	MaxWait:        time.Second,
+	MaxElapsedTime: 5 * time.Second,
+}
+
 const (
 	apiKey = "123"
 	model  = "openai/whisper-tiny"
@@ -41,6 +56,28 @@ const (
   }
 ]`
 
+	imageClassificationResp = `
+{
+  "category": "lo-fi jazz",
+  "score": 0.894,
+  "classes": [
+    {"score": 0.123, "label": "backpack hip-hop", "category": "backpack hip-hop"},
+    {"score": 0.894, "label": "lo-fi jazz", "category": "lo-fi jazz"}
+  ]
+}`
+	visionObjDetectionResp = `
+{
+  "objects": [
+    {
+      "score": 0.123,
+      "label": "backpack hip-hop",
+      "category": "backpack hip-hop",
+      "box": {"xmin": 0, "xmax": 1, "ymin": 0, "ymax": 1},
+      "bounding_box": {"top": 0, "left": 0, "width": 1, "height": 1}
+    }
+  ]
+}`
+
 	errorResp  = ` { "error": "Invalid request" }`
 	errorsResp = ` { "error": ["Temporarily unavailable", "Too many requests"] }`
 )
@@ -50,6 +87,32 @@ var (
 	bEncoded = base64.StdEncoding.EncodeToString(bRaw)
 
 	inputsBody = []byte(`{"inputs": "testing generation"}`)
+
+	maxNewTokens   = 4
+	returnFullText = true
+
+	plusMask = encodeMask(
+		".#.",
+		"###",
+		".#.",
+	)
+	plusSegmentsResp = fmt.Sprintf(`{
+  "segments": [{
+    "score": 0.123,
+    "label": "backpack hip-hop",
+    "mask": "data:image/png;base64,%s",
+    "bounding_box": {"left": 0, "top": 0, "width": 3, "height": 3},
+    "area": 5,
+    "rle": "1,1,1,3,1,1,1",
+    "polygon": [{"x": 1, "y": 0}, {"x": 2, "y": 1}, {"x": 1, "y": 2}, {"x": 0, "y": 1}]
+  }],
+  "objects": [{
+    "rle": "1,1,1,3,1,1,1",
+    "bounding_box": {"left": 0, "top": 0, "width": 3, "height": 3},
+    "category": "backpack hip-hop",
+    "score": 0.123
+  }]
+}`, plusMask)
 )
 
 type taskParams struct {
@@ -57,6 +120,7 @@ type taskParams struct {
 	input       any
 	contentType string // content type received in Hugging Face
 	wantBody    []byte // expected request body in Hugging Face
+	reqBody     any    // expected JSON request body, if it differs from the input
 	okResp      string // successful response from Hugging Face
 	wantResp    string // successful response from connector
 }
@@ -65,6 +129,29 @@ func wrapArrayInObject(array, key string) string {
 	return fmt.Sprintf(`{"%s": %s}`, key, array)
 }
 
+// encodeMask returns a base64-encoded grayscale PNG mask, where '#' pixels are
+// white, '+' pixels are gray and the rest are black.
+func encodeMask(rows ...string) string {
+	img := image.NewGray(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, p := range row {
+			switch p {
+			case '#':
+				img.Pix[y*img.Stride+x] = 0xff
+			case '+':
+				img.Pix[y*img.Stride+x] = 0x60
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		panic(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
 var coveredTasks = []taskParams{
 	{
 		task:        textGenerationTask,
@@ -72,7 +159,17 @@ var coveredTasks = []taskParams{
 		contentType: httpclient.MIMETypeJSON,
 		wantBody:    inputsBody,
 		okResp:      `[{"generated_text": "text response"}]`,
-		wantResp:    `{"generated_text": "text response"}`,
+		wantResp:    `{"generated_text": "text response", "finish_reason": "stop", "usage": {"prompt_tokens": 5, "completion_tokens": 4, "total_tokens": 9}}`,
+	},
+	{
+		task: textGenerationTask,
+		input: TextGenerationRequest{
+			Inputs:     testInput,
+			Parameters: TextGenerationParameters{MaxNewTokens: &maxNewTokens},
+		},
+		contentType: httpclient.MIMETypeJSON,
+		okResp:      `[{"generated_text": "testing generation text response"}]`,
+		wantResp:    `{"generated_text": "testing generation text response", "finish_reason": "length", "usage": {"prompt_tokens": 5, "completion_tokens": 4, "total_tokens": 9}}`,
 	},
 	{
 		task:        textToImageTask,
@@ -160,7 +257,7 @@ var coveredTasks = []taskParams{
 		contentType: httpclient.MIMETypeJSON,
 		wantBody:    []byte(`{"inputs": {}}`),
 		okResp:      `{"generated_text": "gen"}`,
-		wantResp:    `{"generated_text": "gen"}`,
+		wantResp:    `{"generated_text": "gen", "finish_reason": "stop", "usage": {"prompt_tokens": 0, "completion_tokens": 1, "total_tokens": 1}}`,
 	},
 	{
 		task:        imageClassificationTask,
@@ -168,15 +265,15 @@ var coveredTasks = []taskParams{
 		contentType: "text/plain.*",
 		wantBody:    bRaw,
 		okResp:      classificationResp,
-		wantResp:    wrapArrayInObject(classificationResp, "classes"),
+		wantResp:    imageClassificationResp,
 	},
 	{
 		task:        imageSegmentationTask,
 		input:       ImageRequest{Image: bEncoded},
 		contentType: "text/plain.*",
 		wantBody:    bRaw,
-		okResp:      `[{"score": 0.123, "label": "backpack hip-hop", "mask": "YBcsSdfg"}]`,
-		wantResp:    `{"segments": [{"score": 0.123, "label": "backpack hip-hop", "mask": "data:image/png;base64,YBcsSdfg"}]}`,
+		okResp:      fmt.Sprintf(`[{"score": 0.123, "label": "backpack hip-hop", "mask": "%s"}]`, plusMask),
+		wantResp:    plusSegmentsResp,
 	},
 	{
 		task:        objectDetectionTask,
@@ -184,7 +281,7 @@ var coveredTasks = []taskParams{
 		contentType: "text/plain.*",
 		wantBody:    bRaw,
 		okResp:      objDetectionResp,
-		wantResp:    wrapArrayInObject(objDetectionResp, "objects"),
+		wantResp:    visionObjDetectionResp,
 	},
 	{
 		task:        imageToTextTask,
@@ -210,6 +307,59 @@ var coveredTasks = []taskParams{
 		okResp:      classificationResp,
 		wantResp:    wrapArrayInObject(classificationResp, "classes"),
 	},
+	{
+		task:        textToSpeechTask,
+		input:       TextToSpeechRequest{Inputs: testInput},
+		contentType: httpclient.MIMETypeJSON,
+		okResp:      string(bRaw),
+		wantResp:    fmt.Sprintf(`{"audio": "data:audio/flac;base64,%s"}`, bEncoded),
+	},
+	{
+		task: zeroShotImageClassificationTask,
+		input: ZeroShotImageClassificationInput{
+			Image:      "data:image/png;base64," + bEncoded,
+			Parameters: ZeroShotImageClassificationParameters{CandidateLabels: []string{"cat", "dog"}},
+		},
+		contentType: httpclient.MIMETypeJSON,
+		reqBody: ZeroShotImageClassificationRequest{
+			Inputs:     bEncoded,
+			Parameters: ZeroShotImageClassificationParameters{CandidateLabels: []string{"cat", "dog"}},
+		},
+		okResp:   classificationResp,
+		wantResp: imageClassificationResp,
+	},
+	{
+		task:        depthEstimationTask,
+		input:       ImageRequest{Image: bEncoded},
+		contentType: "text/plain.*",
+		wantBody:    bRaw,
+		okResp:      `{"depth": "YBcsSdfg", "predicted_depth": [[0.5, 1], [1.5, 2]]}`,
+		wantResp:    `{"depth": "data:image/png;base64,YBcsSdfg", "predicted_depth": [[0.5, 1], [1.5, 2]]}`,
+	},
+	{
+		task:        documentQuestionAnsweringTask,
+		input:       DocumentQuestionAnsweringInput{Image: bEncoded, Question: "What's the total?"},
+		contentType: httpclient.MIMETypeJSON,
+		reqBody: DocumentQuestionAnsweringRequest{
+			Inputs: DocumentQuestionAnsweringInputs{Image: bEncoded, Question: "What's the total?"},
+		},
+		okResp:   `[{"answer": "$12", "score": 0.9, "start": 16, "end": 16}]`,
+		wantResp: `{"answers": [{"answer": "$12", "score": 0.9, "start": 16, "end": 16}]}`,
+	},
+	{
+		task: imageToImageTask,
+		input: ImageToImageInput{
+			Image:      bEncoded,
+			Parameters: ImageToImageParameters{Prompt: "make it blue", TargetSize: &ImageSize{Width: 64, Height: 32}},
+		},
+		contentType: httpclient.MIMETypeJSON,
+		reqBody: ImageToImageRequest{
+			Inputs:     bEncoded,
+			Parameters: ImageToImageParameters{Prompt: "make it blue", TargetSize: &ImageSize{Width: 64, Height: 32}},
+		},
+		okResp:   string(bRaw),
+		wantResp: fmt.Sprintf(`{"image": "data:image/jpeg;base64,%s"}`, bEncoded),
+	},
 }
 
 func TestConnector_ExecuteSpeechRecognition(t *testing.T) {
@@ -298,11 +448,12 @@ func testTask(c *qt.C, p taskParams) {
 				body, err := io.ReadAll(r.Body)
 				c.Assert(err, qt.IsNil)
 				if ct == httpclient.MIMETypeJSON {
-					// If we have a case where we don't pass the input request,
-					// we can check if p.wantBody is not empty and then do
-					// c.Check(body, qt.JSONEquals, json.RawMessage(p.wantBody)
+					wantBody := p.input
+					if p.reqBody != nil {
+						wantBody = p.reqBody
+					}
 
-					c.Check(body, qt.JSONEquals, p.input)
+					c.Check(body, qt.JSONEquals, wantBody)
 				} else {
 					c.Check(body, qt.ContentEquals, p.wantBody)
 				}
@@ -323,6 +474,7 @@ func testTask(c *qt.C, p taskParams) {
 
 			exec, err := connector.CreateExecution(defID, p.task, config, logger)
 			c.Assert(err, qt.IsNil)
+			exec.(*Execution).retryPolicy = testRetryPolicy
 
 			pbIn, err := base.ConvertToStructpb(p.input)
 			c.Assert(err, qt.IsNil)
@@ -342,3 +494,808 @@ func testTask(c *qt.C, p taskParams) {
 		})
 	}
 }
+
+func TestConnector_ExecuteStructuredOutput(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	completions := []string{"Rome", ` {"city": "Rome"}`}
+	var reqs []TextGenerationRequest
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req TextGenerationRequest
+		c.Assert(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
+		reqs = append(reqs, req)
+
+		// By default, the generated text is prefixed with the input.
+		resp, err := json.Marshal([]TextGenerationResponse{{GeneratedText: req.Inputs + completions[len(reqs)-1]}})
+		c.Assert(err, qt.IsNil)
+
+		w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+		w.Write(resp)
+	})
+
+	srv := httptest.NewServer(h)
+	c.Cleanup(srv.Close)
+
+	config, err := structpb.NewStruct(map[string]any{
+		"api_key":  apiKey,
+		"base_url": srv.URL,
+	})
+	c.Assert(err, qt.IsNil)
+
+	exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+	c.Assert(err, qt.IsNil)
+
+	pbIn, err := structpb.NewStruct(map[string]any{
+		"model":  model,
+		"inputs": "Where is the Colosseum?",
+		"json_schema": map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"city": map[string]any{"type": "string"}},
+			"required":   []any{"city"},
+		},
+		"json_schema_retries": 1,
+	})
+	c.Assert(err, qt.IsNil)
+
+	got, err := exec.Execute([]*structpb.Struct{pbIn})
+	c.Assert(err, qt.IsNil)
+	c.Assert(reqs, qt.HasLen, 2)
+
+	// The model is instructed to follow the schema and, on failure, the
+	// validation errors are appended to the conversation.
+	c.Check(reqs[0].Inputs, qt.Matches, `(?s)Where is the Colosseum\?\n\nRespond only with a JSON object .*\n`)
+	c.Check(reqs[1].Inputs, qt.Equals, reqs[0].Inputs+"Rome\n\nThe response is not a JSON object. "+
+		strings.TrimPrefix(reqs[0].Inputs, "Where is the Colosseum?\n\n"))
+
+	c.Check(got[0].AsMap()["data"], qt.DeepEquals, map[string]any{"city": "Rome"})
+	c.Check(got[0].AsMap()["generated_text"], qt.Equals, reqs[1].Inputs+` {"city": "Rome"}`)
+}
+
+func TestConnector_ExecuteFeatureExtraction(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	testcases := []struct {
+		name       string
+		in         map[string]any
+		wantInputs []string
+		okResp     string
+		wantResp   string
+		wantErr    string
+	}{
+		{
+			name:       "ok - pooled",
+			in:         map[string]any{"inputs": "hi"},
+			wantInputs: []string{"hi"},
+			okResp:     `[[0.1, 0.2]]`,
+			wantResp:   `{"embedding": [0.1, 0.2]}`,
+		},
+		{
+			name:       "ok - flat",
+			in:         map[string]any{"inputs": "hi"},
+			wantInputs: []string{"hi"},
+			okResp:     `[0.1, 0.2]`,
+			wantResp:   `{"embedding": [0.1, 0.2]}`,
+		},
+		{
+			name:       "ok - token level",
+			in:         map[string]any{"inputs": "hi"},
+			wantInputs: []string{"hi"},
+			okResp:     `[[[1, 2], [3, 4]]]`,
+			wantResp:   `{"token_embeddings": [[1, 2], [3, 4]]}`,
+		},
+		{
+			name:       "ok - mean pooling and normalization",
+			in:         map[string]any{"inputs": "hi", "pooling": "mean", "normalize": true},
+			wantInputs: []string{"hi"},
+			okResp:     `[[[1, 0], [5, 8]]]`,
+			wantResp:   `{"embedding": [0.6, 0.8]}`,
+		},
+		{
+			name:       "ok - batch",
+			in:         map[string]any{"inputs": "hi", "batch_inputs": []any{"a", "b"}, "normalize": true},
+			wantInputs: []string{"hi", "a", "b"},
+			okResp:     `[[0, 2], [3, 4], [0, 0]]`,
+			wantResp:   `{"embedding": [0, 1], "embeddings": [[0.6, 0.8], [0, 0]]}`,
+		},
+		{
+			name:       "ok - token-level batch",
+			in:         map[string]any{"batch_inputs": []any{"a", "b"}},
+			wantInputs: []string{"a", "b"},
+			okResp:     `[[[1, 2]], [[3, 4], [5, 6]]]`,
+			wantResp:   `{"batch_token_embeddings": [[[1, 2]], [[3, 4], [5, 6]]]}`,
+		},
+		{
+			name:       "nok - missing features",
+			in:         map[string]any{"batch_inputs": []any{"a", "b"}},
+			wantInputs: []string{"a", "b"},
+			okResp:     `[[1, 2]]`,
+			wantErr:    "Hugging Face returned features for 1 inputs instead of 2.",
+		},
+		{
+			name:       "nok - unexpected format",
+			in:         map[string]any{"inputs": "hi"},
+			wantInputs: []string{"hi"},
+			okResp:     `{"features": [1, 2]}`,
+			wantErr:    "Hugging Face returned the features in an unexpected format.",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		c.Run(tc.name, func(c *qt.C) {
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c.Check(r.URL.Path, qt.Equals, modelsPath+model)
+
+				var req FeatureExtractionRequest
+				c.Assert(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
+				c.Check(req.Inputs, qt.DeepEquals, tc.wantInputs)
+
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				fmt.Fprint(w, tc.okResp)
+			})
+
+			srv := httptest.NewServer(h)
+			c.Cleanup(srv.Close)
+
+			config, err := structpb.NewStruct(map[string]any{
+				"api_key":  apiKey,
+				"base_url": srv.URL,
+			})
+			c.Assert(err, qt.IsNil)
+
+			exec, err := connector.CreateExecution(defID, featureExtractionTask, config, logger)
+			c.Assert(err, qt.IsNil)
+
+			tc.in["model"] = model
+			pbIn, err := structpb.NewStruct(tc.in)
+			c.Assert(err, qt.IsNil)
+
+			got, err := exec.Execute([]*structpb.Struct{pbIn})
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				return
+			}
+
+			c.Assert(err, qt.IsNil)
+			c.Check(tc.wantResp, qt.JSONEquals, got[0].AsMap())
+		})
+	}
+}
+
+func TestConnector_ExecuteImageSegmentation(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	softMask := encodeMask(
+		"##++",
+		"##++",
+	)
+	leftMask := encodeMask(
+		"#...",
+		"#...",
+		"....",
+	)
+	rightMask := encodeMask(
+		"...#",
+		"...#",
+		"....",
+	)
+	emptyMask := encodeMask(
+		"....",
+		"....",
+	)
+
+	testcases := []struct {
+		name     string
+		in       map[string]any
+		okResp   string
+		wantResp string
+		wantErr  string
+	}{
+		{
+			name:   "ok - default threshold",
+			in:     map[string]any{},
+			okResp: fmt.Sprintf(`[{"score": 0.9, "label": "cat", "mask": "%s"}]`, softMask),
+			wantResp: fmt.Sprintf(`{
+  "segments": [{
+    "score": 0.9,
+    "label": "cat",
+    "mask": "data:image/png;base64,%s",
+    "bounding_box": {"left": 0, "top": 0, "width": 2, "height": 2},
+    "area": 4,
+    "rle": "0,4",
+    "polygon": [{"x": 0, "y": 0}, {"x": 1, "y": 0}, {"x": 1, "y": 1}, {"x": 0, "y": 1}]
+  }],
+  "objects": [{
+    "rle": "0,4",
+    "bounding_box": {"left": 0, "top": 0, "width": 2, "height": 2},
+    "category": "cat",
+    "score": 0.9
+  }]
+}`, softMask),
+		},
+		{
+			name:   "ok - low threshold",
+			in:     map[string]any{"mask_threshold": 0.2},
+			okResp: fmt.Sprintf(`[{"score": 0.9, "label": "cat", "mask": "%s"}]`, softMask),
+			wantResp: fmt.Sprintf(`{
+  "segments": [{
+    "score": 0.9,
+    "label": "cat",
+    "mask": "data:image/png;base64,%s",
+    "bounding_box": {"left": 0, "top": 0, "width": 4, "height": 2},
+    "area": 8,
+    "rle": "0,8",
+    "polygon": [{"x": 0, "y": 0}, {"x": 3, "y": 0}, {"x": 3, "y": 1}, {"x": 0, "y": 1}]
+  }],
+  "objects": [{
+    "rle": "0,8",
+    "bounding_box": {"left": 0, "top": 0, "width": 4, "height": 2},
+    "category": "cat",
+    "score": 0.9
+  }]
+}`, softMask),
+		},
+		{
+			name: "ok - merge by label",
+			in:   map[string]any{"merge_by_label": true},
+			okResp: fmt.Sprintf(`[
+  {"score": 0.5, "label": "cat", "mask": "%s"},
+  {"score": 0.8, "label": "cat", "mask": "%s"},
+  {"score": 0.7, "label": "dog", "mask": "%s"}
+]`, leftMask, rightMask, emptyMask),
+			wantResp: fmt.Sprintf(`{
+  "segments": [{
+    "score": 0.8,
+    "label": "cat",
+    "mask": "data:image/png;base64,%s",
+    "bounding_box": {"left": 0, "top": 0, "width": 4, "height": 2},
+    "area": 4,
+    "rle": "0,1,2,2,2,1",
+    "polygon": [{"x": 0, "y": 0}, {"x": 0, "y": 1}]
+  }],
+  "objects": [{
+    "rle": "0,1,2,2,2,1",
+    "bounding_box": {"left": 0, "top": 0, "width": 4, "height": 2},
+    "category": "cat",
+    "score": 0.8
+  }],
+  "stuffs": [{"rle": "0,1,2,2,2,1,4", "category": "cat"}]
+}`, encodeMask("#..#", "#..#", "....")),
+		},
+		{
+			name:    "nok - invalid mask",
+			in:      map[string]any{},
+			okResp:  `[{"score": 0.9, "label": "cat", "mask": "YBcsSdfg"}]`,
+			wantErr: `Hugging Face returned an invalid mask for the segment "cat".`,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		c.Run(tc.name, func(c *qt.C) {
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				fmt.Fprint(w, tc.okResp)
+			})
+
+			srv := httptest.NewServer(h)
+			c.Cleanup(srv.Close)
+
+			config, err := structpb.NewStruct(map[string]any{
+				"api_key":  apiKey,
+				"base_url": srv.URL,
+			})
+			c.Assert(err, qt.IsNil)
+
+			exec, err := connector.CreateExecution(defID, imageSegmentationTask, config, logger)
+			c.Assert(err, qt.IsNil)
+
+			tc.in["model"] = model
+			tc.in["image"] = bEncoded
+			pbIn, err := structpb.NewStruct(tc.in)
+			c.Assert(err, qt.IsNil)
+
+			got, err := exec.Execute([]*structpb.Struct{pbIn})
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				return
+			}
+
+			c.Assert(err, qt.IsNil)
+			c.Check(tc.wantResp, qt.JSONEquals, got[0].AsMap())
+		})
+	}
+}
+
+func TestConnector_ExecuteTGI(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	prompt := "Tell me a joke."
+	wantBody := TGIGenerateRequest{
+		Inputs: prompt,
+		Parameters: TGIParameters{
+			MaxNewTokens:   &maxNewTokens,
+			ReturnFullText: &returnFullText,
+			Details:        true,
+		},
+	}
+	wantDetails := map[string]any{
+		"finish_reason":    "eos_token",
+		"generated_tokens": float64(2),
+		"tokens": []any{
+			map[string]any{"id": float64(1), "text": " Knock", "logprob": -0.5},
+			map[string]any{"id": float64(2), "text": " knock", "logprob": -0.25},
+			map[string]any{"id": float64(0), "text": "</s>", "logprob": float64(0), "special": true},
+		},
+	}
+
+	pbIn, err := structpb.NewStruct(map[string]any{
+		"model":  model,
+		"inputs": prompt,
+		"parameters": map[string]any{
+			"max_new_tokens": maxNewTokens,
+			"details":        true,
+		},
+		"options": map[string]any{"wait_for_model": true},
+	})
+	c.Assert(err, qt.IsNil)
+
+	config, err := structpb.NewStruct(map[string]any{
+		"api_key":       apiKey,
+		"endpoint_mode": endpointModeTGI,
+	})
+	c.Assert(err, qt.IsNil)
+
+	c.Run("ok - generate", func(c *qt.C) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Check(r.URL.Path, qt.Equals, tgiGeneratePath)
+
+			body, err := io.ReadAll(r.Body)
+			c.Assert(err, qt.IsNil)
+			c.Check(body, qt.JSONEquals, wantBody)
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			fmt.Fprint(w, `{
+  "generated_text": "Tell me a joke. Knock knock",
+  "details": {
+    "finish_reason": "eos_token",
+    "generated_tokens": 2,
+    "tokens": [
+      {"id": 1, "text": " Knock", "logprob": -0.5, "special": false},
+      {"id": 2, "text": " knock", "logprob": -0.25, "special": false},
+      {"id": 0, "text": "</s>", "logprob": 0, "special": true}
+    ]
+  }
+}`)
+		})
+
+		srv := httptest.NewServer(h)
+		c.Cleanup(srv.Close)
+		config.Fields["base_url"] = structpb.NewStringValue(srv.URL)
+
+		exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+		c.Assert(err, qt.IsNil)
+
+		got, err := exec.Execute([]*structpb.Struct{pbIn})
+		c.Assert(err, qt.IsNil)
+		c.Check(got[0].AsMap(), qt.DeepEquals, map[string]any{
+			"generated_text": "Tell me a joke. Knock knock",
+			"finish_reason":  "stop",
+			"usage": map[string]any{
+				"prompt_tokens":     float64(4),
+				"completion_tokens": float64(2),
+				"total_tokens":      float64(6),
+			},
+			"details": wantDetails,
+		})
+	})
+
+	c.Run("ok - stream", func(c *qt.C) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Check(r.URL.Path, qt.Equals, tgiGenerateStreamPath)
+
+			body, err := io.ReadAll(r.Body)
+			c.Assert(err, qt.IsNil)
+			c.Check(body, qt.JSONEquals, wantBody)
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, `data:{"index":1,"token":{"id":1,"text":" Knock","logprob":-0.5,"special":false},"generated_text":null,"details":null}
+
+data:{"index":2,"token":{"id":2,"text":" knock","logprob":-0.25,"special":false},"generated_text":null,"details":null}
+
+data:{"index":3,"token":{"id":0,"text":"</s>","logprob":0,"special":true},"generated_text":"Tell me a joke. Knock knock","details":{"finish_reason":"eos_token","generated_tokens":2}}
+
+`)
+		})
+
+		srv := httptest.NewServer(h)
+		c.Cleanup(srv.Close)
+		config.Fields["base_url"] = structpb.NewStringValue(srv.URL)
+
+		exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+		c.Assert(err, qt.IsNil)
+
+		var chunks []string
+		exec.(*Execution).SetStreamHandler(func(chunk TextGenerationChunk) {
+			chunks = append(chunks, chunk.Text)
+		})
+
+		got, err := exec.Execute([]*structpb.Struct{pbIn})
+		c.Assert(err, qt.IsNil)
+		c.Check(chunks, qt.DeepEquals, []string{" Knock", " knock"})
+		c.Check(got[0].AsMap()["generated_text"], qt.Equals, "Tell me a joke. Knock knock")
+		c.Check(got[0].AsMap()["finish_reason"], qt.Equals, "stop")
+		c.Check(got[0].AsMap()["details"], qt.DeepEquals, wantDetails)
+	})
+
+	c.Run("ok - stream structured output attempts", func(c *qt.C) {
+		attempts := [][]string{{"Rome"}, {`{"city":`, `"Rome"}`}}
+
+		var calls int
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, text := range attempts[calls-1] {
+				b, _ := json.Marshal(text)
+				fmt.Fprintf(w, "data:{\"token\":{\"id\":1,\"text\":%s,\"logprob\":0,\"special\":false}}\n\n", b)
+			}
+		})
+
+		srv := httptest.NewServer(h)
+		c.Cleanup(srv.Close)
+		config.Fields["base_url"] = structpb.NewStringValue(srv.URL)
+
+		exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+		c.Assert(err, qt.IsNil)
+
+		var chunks []TextGenerationChunk
+		exec.(*Execution).SetStreamHandler(func(chunk TextGenerationChunk) {
+			chunks = append(chunks, chunk)
+		})
+
+		pbIn, err := structpb.NewStruct(map[string]any{
+			"model":  model,
+			"inputs": "Where is the Colosseum?",
+			"json_schema": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+				"required":   []any{"city"},
+			},
+			"json_schema_retries": 1,
+		})
+		c.Assert(err, qt.IsNil)
+
+		got, err := exec.Execute([]*structpb.Struct{pbIn})
+		c.Assert(err, qt.IsNil)
+		c.Check(got[0].AsMap()["data"], qt.DeepEquals, map[string]any{"city": "Rome"})
+
+		// The chunks of the invalid generation are superseded by the ones
+		// of the next attempt.
+		c.Check(chunks, qt.DeepEquals, []TextGenerationChunk{
+			{Attempt: 0, Text: "Rome"},
+			{Attempt: 1, Text: `{"city":`},
+			{Attempt: 1, Text: `"Rome"}`},
+		})
+	})
+
+	c.Run("ok - stream cold start", func(c *qt.C) {
+		var calls int
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprint(w, `{"error": "Model is currently loading", "estimated_time": 0.1}`)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, `data:{"token":{"id":1,"text":" Knock","logprob":-0.5,"special":false}}
+
+`)
+		})
+
+		srv := httptest.NewServer(h)
+		c.Cleanup(srv.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"api_key":             apiKey,
+			"base_url":            srv.URL,
+			"endpoint_mode":       endpointModeTGI,
+			"cold_start_strategy": coldStartPoll,
+		})
+		c.Assert(err, qt.IsNil)
+
+		exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+		c.Assert(err, qt.IsNil)
+
+		var chunks []string
+		exec.(*Execution).SetStreamHandler(func(chunk TextGenerationChunk) {
+			chunks = append(chunks, chunk.Text)
+		})
+
+		got, err := exec.Execute([]*structpb.Struct{pbIn})
+		c.Assert(err, qt.IsNil)
+		c.Check(calls, qt.Equals, 2)
+		c.Check(chunks, qt.DeepEquals, []string{" Knock"})
+		c.Check(got[0].AsMap()["model_load_time"], qt.Not(qt.IsNil))
+	})
+
+	c.Run("nok - stream cold start", func(c *qt.C) {
+		var calls int
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+
+			// The model loading failures aren't retried by the client,
+			// even if the server asks for it.
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error": "Model is currently loading", "estimated_time": 0.1}`)
+		})
+
+		srv := httptest.NewServer(h)
+		c.Cleanup(srv.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"api_key":             apiKey,
+			"base_url":            srv.URL,
+			"endpoint_mode":       endpointModeTGI,
+			"cold_start_strategy": coldStartFail,
+		})
+		c.Assert(err, qt.IsNil)
+
+		exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+		c.Assert(err, qt.IsNil)
+		exec.(*Execution).SetStreamHandler(func(TextGenerationChunk) {})
+
+		_, err = exec.Execute([]*structpb.Struct{pbIn})
+		c.Check(calls, qt.Equals, 1)
+		c.Check(errmsg.Message(err), qt.Equals, "Hugging Face responded with a 503 status code. Model is currently loading")
+	})
+
+	c.Run("nok - stream error", func(c *qt.C) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, `data:{"error":"Request failed during generation: Server error: CUDA out of memory","error_type":"generation"}
+
+`)
+		})
+
+		srv := httptest.NewServer(h)
+		c.Cleanup(srv.Close)
+		config.Fields["base_url"] = structpb.NewStringValue(srv.URL)
+
+		exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+		c.Assert(err, qt.IsNil)
+		exec.(*Execution).SetStreamHandler(func(TextGenerationChunk) {})
+
+		_, err = exec.Execute([]*structpb.Struct{pbIn})
+		c.Check(errmsg.Message(err), qt.Equals, "Hugging Face failed to generate the text: Request failed during generation: Server error: CUDA out of memory")
+	})
+}
+
+func TestConnector_ExecuteRetry(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	testcases := []struct {
+		name         string
+		statuses     []int
+		retryAfter   string
+		wantAttempts int
+		wantWait     time.Duration
+		wantErr      string
+	}{
+		{
+			name:         "ok - retry on rate limit",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+			wantAttempts: 3,
+		},
+		{
+			name:         "ok - retry after the server wait time",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			retryAfter:   "0.1",
+			wantAttempts: 2,
+			wantWait:     100 * time.Millisecond,
+		},
+		{
+			name:         "nok - too many attempts",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+			wantAttempts: 3,
+			wantErr:      "Hugging Face responded with a 429 status code. Invalid request",
+		},
+		{
+			name:         "nok - server wait time exceeds max",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:   "60",
+			wantAttempts: 1,
+			wantErr:      "Hugging Face responded with a 429 status code. Invalid request",
+		},
+		{
+			name:         "nok - no retry on unavailable service",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantAttempts: 1,
+			wantErr:      "Hugging Face responded with a 503 status code. Invalid request",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		c.Run(tc.name, func(c *qt.C) {
+			c.Parallel()
+
+			var attempts atomic.Int32
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tc.statuses[attempts.Add(1)-1]
+
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+
+				w.WriteHeader(status)
+				if status != http.StatusOK {
+					fmt.Fprint(w, errorResp)
+					return
+				}
+
+				fmt.Fprint(w, `[{"summary_text": "summary"}]`)
+			})
+
+			srv := httptest.NewServer(h)
+			c.Cleanup(srv.Close)
+
+			// Model loading failures are handled by the cold start
+			// strategy.
+			config, err := structpb.NewStruct(map[string]any{
+				"api_key":             apiKey,
+				"base_url":            srv.URL,
+				"cold_start_strategy": coldStartFail,
+			})
+			c.Assert(err, qt.IsNil)
+
+			exec, err := connector.CreateExecution(defID, summarizationTask, config, logger)
+			c.Assert(err, qt.IsNil)
+			exec.(*Execution).retryPolicy = testRetryPolicy
+
+			pbIn, err := structpb.NewStruct(map[string]any{"model": model, "inputs": testInput})
+			c.Assert(err, qt.IsNil)
+
+			start := time.Now()
+			got, err := exec.Execute([]*structpb.Struct{pbIn})
+			c.Check(attempts.Load(), qt.Equals, int32(tc.wantAttempts))
+			c.Check(time.Since(start) >= tc.wantWait, qt.IsTrue)
+
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				return
+			}
+
+			c.Assert(err, qt.IsNil)
+			c.Check(got[0].AsMap()["summary_text"], qt.Equals, "summary")
+		})
+	}
+}
+
+func TestConnector_ExecuteColdStart(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	loadingResp := `{"error": "Model openai/whisper-tiny is currently loading", "estimated_time": 0.1}`
+
+	testcases := []struct {
+		name         string
+		config       map[string]any
+		loadingCalls int
+		wantHeader   string
+		wantErr      string
+	}{
+		{
+			name:         "ok - poll",
+			config:       map[string]any{"cold_start_strategy": coldStartPoll},
+			loadingCalls: 4,
+		},
+		{
+			name:       "ok - wait for model",
+			config:     map[string]any{"cold_start_strategy": coldStartWaitForModel},
+			wantHeader: "true",
+		},
+		{
+			name:         "nok - fail",
+			config:       map[string]any{"cold_start_strategy": coldStartFail},
+			loadingCalls: 1,
+			wantErr:      "Hugging Face responded with a 503 status code. Model openai/whisper-tiny is currently loading",
+		},
+		{
+			name:         "nok - fail by default",
+			loadingCalls: 1,
+			wantErr:      "Hugging Face responded with a 503 status code. Model openai/whisper-tiny is currently loading",
+		},
+		{
+			name:         "nok - max load time",
+			config:       map[string]any{"cold_start_strategy": coldStartPoll, "max_model_load_time": 0.1},
+			loadingCalls: 10,
+			wantErr:      "The model didn't load in 100ms. Hugging Face responded with a 503 status code. Model openai/whisper-tiny is currently loading",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		c.Run(tc.name, func(c *qt.C) {
+			c.Parallel()
+
+			var calls int
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c.Check(r.Header.Get(waitForModelHeader), qt.Equals, tc.wantHeader)
+
+				calls++
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				if calls <= tc.loadingCalls {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					fmt.Fprint(w, loadingResp)
+					return
+				}
+
+				fmt.Fprint(w, `[{"summary_text": "summary"}]`)
+			})
+
+			srv := httptest.NewServer(h)
+			c.Cleanup(srv.Close)
+
+			config, err := structpb.NewStruct(map[string]any{
+				"api_key":  apiKey,
+				"base_url": srv.URL,
+			})
+			c.Assert(err, qt.IsNil)
+			for k, v := range tc.config {
+				config.Fields[k], err = structpb.NewValue(v)
+				c.Assert(err, qt.IsNil)
+			}
+
+			exec, err := connector.CreateExecution(defID, summarizationTask, config, logger)
+			c.Assert(err, qt.IsNil)
+
+			pbIn, err := structpb.NewStruct(map[string]any{"model": model, "inputs": testInput})
+			c.Assert(err, qt.IsNil)
+
+			got, err := exec.Execute([]*structpb.Struct{pbIn})
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				return
+			}
+
+			c.Assert(err, qt.IsNil)
+			c.Check(got[0].AsMap()["summary_text"], qt.Equals, "summary")
+
+			loadTime, reported := got[0].AsMap()["model_load_time"]
+			c.Check(reported, qt.Equals, tc.loadingCalls > 0)
+			if reported {
+				c.Check(loadTime, qt.Not(qt.Equals), float64(0))
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package huggingface
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/instill-ai/connector/pkg/util"
+	"github.com/instill-ai/x/errmsg"
+)
+
+const (
+	poolingNone = "none"
+	poolingMean = "mean"
+)
+
+// parseFeatures reads the features returned by the feature extraction
+// endpoint for a batch of inputs. Depending on the model, the response holds
+// an embedding per input (e.g. sentence-transformers models) or an embedding
+// per token of each input. The latter are returned as token embeddings.
+func parseFeatures(data []byte, numInputs int) (pooled [][]float64, tokens [][][]float64, err error) {
+	var flat []float64
+	switch {
+	case json.Unmarshal(data, &tokens) == nil:
+	case json.Unmarshal(data, &pooled) == nil:
+		tokens = nil
+	case json.Unmarshal(data, &flat) == nil:
+		// Some endpoints return a flat embedding for a single input.
+		pooled, tokens = [][]float64{flat}, nil
+	default:
+		return nil, nil, errmsg.AddMessage(
+			fmt.Errorf("parsing features: unexpected shape"),
+			"Hugging Face returned the features in an unexpected format.",
+		)
+	}
+
+	got := len(pooled)
+	if tokens != nil {
+		got = len(tokens)
+	}
+
+	if got != numInputs {
+		return nil, nil, errmsg.AddMessage(
+			fmt.Errorf("got features for %d inputs, want %d", got, numInputs),
+			fmt.Sprintf("Hugging Face returned features for %d inputs instead of %d.", got, numInputs),
+		)
+	}
+
+	return pooled, tokens, nil
+}
+
+func (in FeatureExtractionInput) texts() []string {
+	return util.EmbeddingTexts(in.Inputs, in.BatchInputs)
+}
+
+func (in FeatureExtractionInput) request() FeatureExtractionRequest {
+	return FeatureExtractionRequest{Inputs: in.texts(), Options: in.Options}
+}
+
+// output pools and normalizes the features of the input texts and builds the
+// task output.
+func (in FeatureExtractionInput) output(data []byte) (*FeatureExtractionOutput, error) {
+	pooled, tokens, err := parseFeatures(data, len(in.texts()))
+	if err != nil {
+		return nil, err
+	}
+
+	switch in.Pooling {
+	case "", poolingNone:
+	case poolingMean:
+		if tokens != nil {
+			pooled = make([][]float64, len(tokens))
+			for i, t := range tokens {
+				pooled[i] = meanPool(t)
+			}
+
+			tokens = nil
+		}
+	default:
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("unsupported pooling %q", in.Pooling),
+			fmt.Sprintf("Pooling %q isn't supported.", in.Pooling),
+		)
+	}
+
+	if in.Normalize {
+		for _, e := range pooled {
+			normalize(e)
+		}
+
+		for _, t := range tokens {
+			for _, e := range t {
+				normalize(e)
+			}
+		}
+	}
+
+	out := &FeatureExtractionOutput{}
+	single := len(in.texts()) > len(in.BatchInputs)
+	if tokens != nil {
+		if single {
+			out.TokenEmbeddings, tokens = tokens[0], tokens[1:]
+		}
+		if len(in.BatchInputs) > 0 {
+			out.BatchTokenEmbeddings = tokens
+		}
+
+		return out, nil
+	}
+
+	if single {
+		out.Embedding, pooled = pooled[0], pooled[1:]
+	}
+	if len(in.BatchInputs) > 0 {
+		out.Embeddings = pooled
+	}
+
+	return out, nil
+}
+
+// meanPool averages the token embeddings of an input. The Inference API
+// doesn't return the padding tokens, so all the tokens are accounted for.
+func meanPool(tokens [][]float64) []float64 {
+	if len(tokens) == 0 {
+		return []float64{}
+	}
+
+	mean := make([]float64, len(tokens[0]))
+	for _, t := range tokens {
+		for j := range mean {
+			if j < len(t) {
+				mean[j] += t[j]
+			}
+		}
+	}
+
+	for j := range mean {
+		mean[j] /= float64(len(tokens))
+	}
+
+	return mean
+}
+
+// normalize scales an embedding to unit L2 norm. Zero vectors are left
+// untouched.
+func normalize(e []float64) {
+	var norm float64
+	for _, v := range e {
+		norm += v * v
+	}
+
+	if norm == 0 {
+		return
+	}
+
+	norm = math.Sqrt(norm)
+	for i := range e {
+		e[i] /= norm
+	}
+}
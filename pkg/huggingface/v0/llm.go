@@ -0,0 +1,211 @@
+package huggingface
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
+)
+
+// Hugging Face doesn't report the token usage nor the reason the generation
+// stopped, so these values are estimated from the request and the generated
+// text. Text Generation Inference reports them in the details of the
+// generation, when requested.
+
+func textGenerationUsage(req TextGenerationRequest, resp TextGenerationResponse) (util.LLMUsage, string) {
+	completion := textGenerationCompletion(req, resp.GeneratedText)
+
+	var maxTokens int
+	if req.Parameters.MaxNewTokens != nil {
+		maxTokens = *req.Parameters.MaxNewTokens
+	}
+
+	promptTokens := util.EstimateTokens(req.Inputs)
+	completionTokens := util.EstimateTokens(completion)
+	finishReason := util.EstimateFinishReason(completionTokens, maxTokens)
+
+	if d := resp.Details; d != nil {
+		completionTokens = d.GeneratedTokens
+		if len(d.Prefill) > 0 {
+			promptTokens = len(d.Prefill)
+		}
+
+		finishReason = tgiFinishReason(d.FinishReason)
+	}
+
+	return util.NewLLMUsage(promptTokens, completionTokens), finishReason
+}
+
+// tgiFinishReason maps the finish reasons of Text Generation Inference to the
+// ones of the connector.
+func tgiFinishReason(reason string) string {
+	switch reason {
+	case "length":
+		return util.FinishReasonLength
+	case "eos_token", "stop_sequence":
+		return util.FinishReasonStop
+	default:
+		return reason
+	}
+}
+
+// textGenerationCompletion returns the text generated by the model. By
+// default, the generated text is prefixed with the input.
+func textGenerationCompletion(req TextGenerationRequest, generatedText string) string {
+	if req.Parameters.ReturnFullText == nil || *req.Parameters.ReturnFullText {
+		return strings.TrimPrefix(generatedText, req.Inputs)
+	}
+
+	return generatedText
+}
+
+// conversationalPrompt returns the texts of a conversation that are sent to
+// the model.
+func conversationalPrompt(req ConversationalRequest) []string {
+	prompt := append([]string{req.Inputs.Text}, req.Inputs.PastUserInputs...)
+	return append(prompt, req.Inputs.GeneratedResponses...)
+}
+
+func conversationalUsage(req ConversationalRequest, generatedText string) (util.LLMUsage, string) {
+	var maxTokens int
+	if req.Parameters.MaxLength != nil {
+		maxTokens = *req.Parameters.MaxLength
+	}
+
+	completionTokens := util.EstimateTokens(generatedText)
+	usage := util.NewLLMUsage(util.EstimateTokens(conversationalPrompt(req)...), completionTokens)
+	return usage, util.EstimateFinishReason(completionTokens, maxTokens)
+}
+
+// textGenerationTokenCost estimates the number of tokens a request will
+// consume from the tokens-per-minute limit: the prompt and the maximum number
+// of tokens to generate.
+func textGenerationTokenCost(req TextGenerationRequest) int {
+	cost := util.EstimateTokens(req.Inputs)
+	if req.Parameters.MaxNewTokens != nil {
+		cost += *req.Parameters.MaxNewTokens
+	}
+
+	return cost
+}
+
+func conversationalTokenCost(req ConversationalRequest) int {
+	cost := util.EstimateTokens(conversationalPrompt(req)...)
+	if req.Parameters.MaxLength != nil {
+		cost += *req.Parameters.MaxLength
+	}
+
+	return cost
+}
+
+func addLLMUsage(output *structpb.Struct, usage util.LLMUsage, finishReason string) error {
+	usageStruct, err := base.ConvertToStructpb(usage)
+	if err != nil {
+		return err
+	}
+
+	output.Fields["usage"] = structpb.NewStructValue(usageStruct)
+	output.Fields["finish_reason"] = structpb.NewStringValue(finishReason)
+	return nil
+}
+
+// generateText runs a text generation through generate, which returns the
+// model response, and builds the task output. If the input has a JSON schema,
+// the model is instructed to follow it and the completion is parsed into the
+// output data. When the completion doesn't follow the schema, the model is
+// prompted again with the validation errors, appended to the conversation.
+func generateText(input *structpb.Struct, req TextGenerationRequest, generate func(TextGenerationRequest) (TextGenerationResponse, error)) (*structpb.Struct, error) {
+	schemaField, ok := input.GetFields()["json_schema"]
+	if !ok {
+		resp, err := generate(req)
+		if err != nil {
+			return nil, err
+		}
+
+		output, err := structpb.NewStruct(map[string]any{"generated_text": resp.GeneratedText})
+		if err != nil {
+			return nil, err
+		}
+
+		usage, finishReason := textGenerationUsage(req, resp)
+		if err := addLLMUsage(output, usage, finishReason); err != nil {
+			return nil, err
+		}
+
+		if err := addDetails(output, req, resp); err != nil {
+			return nil, err
+		}
+
+		return output, nil
+	}
+
+	schema, err := util.CompileJSONSchema(schemaField.GetStructValue().AsMap())
+	if err != nil {
+		return nil, err
+	}
+
+	req.Inputs = fmt.Sprintf("%s\n\n%s\n", req.Inputs, schema.Instructions())
+
+	var resp TextGenerationResponse
+	var completion, finishReason string
+	var usage util.LLMUsage
+	retries := int(input.GetFields()["json_schema_retries"].GetNumberValue())
+	data, _, err := util.GenerateStructured(schema, retries, func(feedback string) (string, error) {
+		if feedback != "" {
+			req.Inputs = fmt.Sprintf("%s%s\n\n%s\n", req.Inputs, completion, feedback)
+		}
+
+		var err error
+		if resp, err = generate(req); err != nil {
+			return "", err
+		}
+
+		// Every attempt consumes tokens.
+		var attemptUsage util.LLMUsage
+		attemptUsage, finishReason = textGenerationUsage(req, resp)
+		usage = util.NewLLMUsage(usage.PromptTokens+attemptUsage.PromptTokens, usage.CompletionTokens+attemptUsage.CompletionTokens)
+
+		completion = textGenerationCompletion(req, resp.GeneratedText)
+		return completion, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := structpb.NewStruct(map[string]any{
+		"generated_text": resp.GeneratedText,
+		"data":           data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addLLMUsage(output, usage, finishReason); err != nil {
+		return nil, err
+	}
+
+	if err := addDetails(output, req, resp); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// addDetails adds the details of the generation to the output, when they
+// were requested and returned.
+func addDetails(output *structpb.Struct, req TextGenerationRequest, resp TextGenerationResponse) error {
+	if !req.Parameters.Details || resp.Details == nil {
+		return nil
+	}
+
+	details, err := base.ConvertToStructpb(resp.Details)
+	if err != nil {
+		return err
+	}
+
+	output.Fields["details"] = structpb.NewStructValue(details)
+	return nil
+}
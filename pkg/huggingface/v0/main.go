@@ -1,18 +1,24 @@
 package huggingface
 
 import (
+	"context"
 	_ "embed"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"mime"
+	"strings"
 	"sync"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/gofrs/uuid"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
+	"github.com/instill-ai/connector/pkg/util/httpclient"
 	"github.com/instill-ai/x/errmsg"
 
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
@@ -38,6 +44,12 @@ const (
 	imageToTextTask            = "TASK_IMAGE_TO_TEXT"
 	speechRecognitionTask      = "TASK_SPEECH_RECOGNITION"
 	audioClassificationTask    = "TASK_AUDIO_CLASSIFICATION"
+
+	textToSpeechTask                = "TASK_TEXT_TO_SPEECH"
+	zeroShotImageClassificationTask = "TASK_ZERO_SHOT_IMAGE_CLASSIFICATION"
+	depthEstimationTask             = "TASK_DEPTH_ESTIMATION"
+	documentQuestionAnsweringTask   = "TASK_DOCUMENT_QUESTION_ANSWERING"
+	imageToImageTask                = "TASK_IMAGE_TO_IMAGE"
 )
 
 var (
@@ -51,10 +63,21 @@ var (
 
 type Connector struct {
 	base.Connector
+
+	// retryPolicy is the retry policy of the executions' clients.
+	retryPolicy httpclient.RetryPolicy
 }
 
 type Execution struct {
 	base.Execution
+	util.ExecutionContext
+
+	retryPolicy httpclient.RetryPolicy
+
+	streamHandler StreamHandler
+	// streamMu serializes the calls to the stream handler, as the inputs of
+	// a batch are processed concurrently.
+	streamMu sync.Mutex
 }
 
 func Init(logger *zap.Logger) base.IConnector {
@@ -63,6 +86,7 @@ func Init(logger *zap.Logger) base.IConnector {
 			Connector: base.Connector{
 				Component: base.Component{Logger: logger},
 			},
+			retryPolicy: httpclient.DefaultRetryPolicy,
 		}
 		err := connector.LoadConnectorDefinitions(definitionsJSON, tasksJSON, nil)
 		if err != nil {
@@ -73,11 +97,19 @@ func Init(logger *zap.Logger) base.IConnector {
 }
 
 func (c *Connector) CreateExecution(defUID uuid.UUID, task string, config *structpb.Struct, logger *zap.Logger) (base.IExecution, error) {
-	e := &Execution{}
+	e := &Execution{retryPolicy: c.retryPolicy}
 	e.Execution = base.CreateExecutionHelper(e, c, defUID, task, config, logger)
 	return e, nil
 }
 
+// SetStreamHandler makes text generation tasks stream the response of Text
+// Generation Inference endpoints. The handler is called with every generated
+// chunk and the execution still returns the aggregated text. Calls to the
+// handler are never concurrent.
+func (e *Execution) SetStreamHandler(h StreamHandler) {
+	e.streamHandler = h
+}
+
 func getAPIKey(config *structpb.Struct) string {
 	return config.GetFields()["api_key"].GetStringValue()
 }
@@ -86,8 +118,26 @@ func getBaseURL(config *structpb.Struct) string {
 	return config.GetFields()["base_url"].GetStringValue()
 }
 
-func isCustomEndpoint(config *structpb.Struct) bool {
-	return config.GetFields()["is_custom_endpoint"].GetBoolValue()
+func getRateLimit(config *structpb.Struct) httpclient.RateLimit {
+	return httpclient.RateLimit{
+		RequestsPerMinute: int(config.GetFields()["requests_per_minute"].GetNumberValue()),
+		TokensPerMinute:   int(config.GetFields()["tokens_per_minute"].GetNumberValue()),
+	}
+}
+
+// getEndpointMode returns how the Hugging Face endpoint is laid out. When it
+// isn't set, it is inferred from the is_custom_endpoint configuration param,
+// which predates the endpoint modes.
+func getEndpointMode(config *structpb.Struct) string {
+	if v := config.GetFields()["endpoint_mode"].GetStringValue(); v != "" {
+		return v
+	}
+
+	if config.GetFields()["is_custom_endpoint"].GetBoolValue() {
+		return endpointModeInferenceEndpoint
+	}
+
+	return endpointModeInferenceAPI
 }
 
 func wrapSliceInStruct(data []byte, key string) (*structpb.Struct, error) {
@@ -108,469 +158,604 @@ func wrapSliceInStruct(data []byte, key string) (*structpb.Struct, error) {
 	}, nil
 }
 
+// dataURI encodes a binary response as a data URI. The MIME type is read from
+// the response headers and defaults to defaultType when the response doesn't
+// report a type of the same kind (e.g. an image).
+func dataURI(resp *resty.Response, defaultType string) string {
+	mimeType := defaultType
+	kind, _, _ := strings.Cut(defaultType, "/")
+	if t, _, err := mime.ParseMediaType(resp.Header().Get("Content-Type")); err == nil && strings.HasPrefix(t, kind+"/") {
+		mimeType = t
+	}
+
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(resp.Body()))
+}
+
 func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
-	client := newClient(e.Config, e.Logger)
-	outputs := []*structpb.Struct{}
+	client := newClient(e.UID, e.Config, e.Logger, e.retryPolicy)
 
 	path := "/"
-	if !isCustomEndpoint(e.Config) {
+	if getEndpointMode(e.Config) == endpointModeInferenceAPI {
 		path = modelsPath + inputs[0].GetFields()["model"].GetStringValue()
 	}
 
-	for _, input := range inputs {
-		switch e.Task {
-		case textGenerationTask:
-			inputStruct := TextGenerationRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+	return util.ExecuteConcurrently(e.Context(), inputs, util.Concurrency(e.Context()), func(ctx context.Context, i int, input *structpb.Struct) (*structpb.Struct, error) {
+		ctx, load := withModelLoad(ctx, e.Config)
+		output, err := e.executeOne(ctx, client, path, i, input)
+		if err != nil {
+			return nil, err
+		}
+
+		addModelLoadTime(output, load)
+		return output, nil
+	})
+}
+
+func (e *Execution) executeOne(ctx context.Context, client *httpclient.Client, path string, i int, input *structpb.Struct) (*structpb.Struct, error) {
+	switch e.Task {
+	case textGenerationTask:
+		inputStruct := TextGenerationRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
+
+		if getEndpointMode(e.Config) == endpointModeTGI {
+			// generateText is called again on each structured output
+			// attempt.
+			attempt := -1
+			return generateText(input, tgiRequest(inputStruct), func(inputStruct TextGenerationRequest) (TextGenerationResponse, error) {
+				attempt++
+				return e.tgiGenerate(ctx, client, i, attempt, inputStruct)
+			})
+		}
 
+		return generateText(input, inputStruct, func(inputStruct TextGenerationRequest) (TextGenerationResponse, error) {
 			resp := []TextGenerationResponse{}
-			req := client.R().SetBody(inputStruct).SetResult(&resp)
+			req := httpclient.SetTokenCost(client.R().SetContext(ctx), textGenerationTokenCost(inputStruct))
+			req.SetBody(inputStruct).SetResult(&resp)
 			if _, err := post(req, path); err != nil {
-				return nil, err
+				return TextGenerationResponse{}, err
 			}
 
 			if len(resp) < 1 {
 				err := fmt.Errorf("invalid response")
-				return nil, errmsg.AddMessage(err, "Hugging Face didn't return any result")
+				return TextGenerationResponse{}, errmsg.AddMessage(err, "Hugging Face didn't return any result")
 			}
 
-			output, err := structpb.NewStruct(map[string]any{"generated_text": resp[0].GeneratedText})
-			if err != nil {
-				return nil, err
-			}
+			return resp[0], nil
+		})
+	case textToImageTask:
+		inputStruct := TextToImageRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		case textToImageTask:
-			inputStruct := TextToImageRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		req := client.R().SetContext(ctx).SetBody(inputStruct)
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
 
-			req := client.R().SetBody(inputStruct)
-			resp, err := post(req, path)
-			if err != nil {
-				return nil, err
-			}
+		rawImg := base64.StdEncoding.EncodeToString(resp.Body())
+		output, err := structpb.NewStruct(map[string]any{
+			"image": fmt.Sprintf("data:image/jpeg;base64,%s", rawImg),
+		})
+		if err != nil {
+			return nil, err
+		}
 
-			rawImg := base64.StdEncoding.EncodeToString(resp.Body())
-			output, err := structpb.NewStruct(map[string]any{
-				"image": fmt.Sprintf("data:image/jpeg;base64,%s", rawImg),
-			})
-			if err != nil {
-				return nil, err
-			}
+		return output, nil
+	case fillMaskTask:
+		inputStruct := FillMaskRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		case fillMaskTask:
-			inputStruct := FillMaskRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		req := client.R().SetContext(ctx).SetBody(inputStruct)
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
 
-			req := client.R().SetBody(inputStruct)
-			resp, err := post(req, path)
-			if err != nil {
-				return nil, err
-			}
+		output, err := wrapSliceInStruct(resp.Body(), "results")
+		if err != nil {
+			return nil, err
+		}
 
-			output, err := wrapSliceInStruct(resp.Body(), "results")
-			if err != nil {
-				return nil, err
-			}
+		return output, nil
+	case summarizationTask:
+		inputStruct := SummarizationRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		case summarizationTask:
-			inputStruct := SummarizationRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		resp := []SummarizationResponse{}
+		req := client.R().SetContext(ctx).SetBody(inputStruct).SetResult(&resp)
+		if _, err := post(req, path); err != nil {
+			return nil, err
+		}
 
-			resp := []SummarizationResponse{}
-			req := client.R().SetBody(inputStruct).SetResult(&resp)
-			if _, err := post(req, path); err != nil {
-				return nil, err
-			}
+		if len(resp) < 1 {
+			err := fmt.Errorf("invalid response")
+			return nil, errmsg.AddMessage(err, "Hugging Face didn't return any result")
+		}
 
-			if len(resp) < 1 {
-				err := fmt.Errorf("invalid response")
-				return nil, errmsg.AddMessage(err, "Hugging Face didn't return any result")
-			}
+		output, err := structpb.NewStruct(map[string]any{"summary_text": resp[0].SummaryText})
+		if err != nil {
+			return nil, err
+		}
 
-			output, err := structpb.NewStruct(map[string]any{"summary_text": resp[0].SummaryText})
-			if err != nil {
-				return nil, err
-			}
+		return output, nil
+	case textClassificationTask:
+		inputStruct := TextClassificationRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		case textClassificationTask:
-			inputStruct := TextClassificationRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		var resp [][]any
+		req := client.R().SetContext(ctx).SetBody(inputStruct).SetResult(&resp)
+		if _, err := post(req, path); err != nil {
+			return nil, err
+		}
 
-			var resp [][]any
-			req := client.R().SetBody(inputStruct).SetResult(&resp)
-			if _, err := post(req, path); err != nil {
-				return nil, err
-			}
+		if len(resp) < 1 {
+			err := fmt.Errorf("invalid response")
+			return nil, errmsg.AddMessage(err, "Hugging Face didn't return any result")
+		}
 
-			if len(resp) < 1 {
-				err := fmt.Errorf("invalid response")
-				return nil, errmsg.AddMessage(err, "Hugging Face didn't return any result")
-			}
+		results, err := structpb.NewList(resp[0])
+		if err != nil {
+			return nil, err
+		}
 
-			results, err := structpb.NewList(resp[0])
-			if err != nil {
-				return nil, err
-			}
+		output := &structpb.Struct{
+			Fields: map[string]*structpb.Value{
+				"results": structpb.NewListValue(results),
+			},
+		}
 
-			output := &structpb.Struct{
-				Fields: map[string]*structpb.Value{
-					"results": structpb.NewListValue(results),
-				},
-			}
+		return output, nil
+	case tokenClassificationTask:
+		inputStruct := TokenClassificationRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
+		req := client.R().SetContext(ctx).SetBody(inputStruct)
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		case tokenClassificationTask:
-			inputStruct := TokenClassificationRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
-			req := client.R().SetBody(inputStruct)
-			resp, err := post(req, path)
-			if err != nil {
-				return nil, err
-			}
+		output, err := wrapSliceInStruct(resp.Body(), "results")
+		if err != nil {
+			return nil, err
+		}
 
-			output, err := wrapSliceInStruct(resp.Body(), "results")
-			if err != nil {
-				return nil, err
-			}
+		return output, nil
+	case translationTask:
+		inputStruct := TranslationRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		case translationTask:
-			inputStruct := TranslationRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		resp := []TranslationResponse{}
+		req := client.R().SetContext(ctx).SetBody(inputStruct).SetResult(&resp)
+		if _, err := post(req, path); err != nil {
+			return nil, err
+		}
 
-			resp := []TranslationResponse{}
-			req := client.R().SetBody(inputStruct).SetResult(&resp)
-			if _, err := post(req, path); err != nil {
-				return nil, err
-			}
+		if len(resp) < 1 {
+			err := fmt.Errorf("invalid response")
+			return nil, errmsg.AddMessage(err, "Hugging Face didn't return any result")
+		}
 
-			if len(resp) < 1 {
-				err := fmt.Errorf("invalid response")
-				return nil, errmsg.AddMessage(err, "Hugging Face didn't return any result")
-			}
+		output, err := structpb.NewStruct(map[string]any{"translation_text": resp[0].TranslationText})
+		if err != nil {
+			return nil, err
+		}
 
-			output, err := structpb.NewStruct(map[string]any{"translation_text": resp[0].TranslationText})
-			if err != nil {
-				return nil, err
-			}
+		return output, nil
+	case zeroShotClassificationTask:
+		inputStruct := ZeroShotRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		case zeroShotClassificationTask:
-			inputStruct := ZeroShotRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		req := client.R().SetContext(ctx).SetBody(inputStruct)
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
 
-			req := client.R().SetBody(inputStruct)
-			resp, err := post(req, path)
-			if err != nil {
-				return nil, err
-			}
+		var output structpb.Struct
+		if err = protojson.Unmarshal(resp.Body(), &output); err != nil {
+			return nil, err
+		}
 
-			var output structpb.Struct
-			if err = protojson.Unmarshal(resp.Body(), &output); err != nil {
-				return nil, err
-			}
+		return &output, nil
+	case featureExtractionTask:
+		inputStruct := FeatureExtractionInput{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, &output)
-		// case featureExtractionTask:
-		// TODO: fix this task
-		// 	inputStruct := FeatureExtractionRequest{}
-		// 	err := base.ConvertFromStructpb(input, &inputStruct)
-		// 	if err != nil {
-		// 		return nil, err
-		// 	}
-		// 	jsonBody, _ := json.Marshal(inputStruct)
-		// 	resp, err := doer.MakeHFAPIRequest(jsonBody, model)
-		// 	if err != nil {
-		// 		return nil, err
-		// 	}
-		// 	threeDArr := [][][]float64{}
-		// 	err = json.Unmarshal(resp, &threeDArr)
-		// 	if err != nil {
-		// 		return nil, err
-		// 	}
-		// 	if len(threeDArr) <= 0 {
-		// 		return nil, errors.New("invalid response")
-		// 	}
-		// 	nestedArr := threeDArr[0]
-		// 	features := structpb.ListValue{}
-		// 	features.Values = make([]*structpb.Value, len(nestedArr))
-		// 	for i, innerArr := range nestedArr {
-		// 		innerValues := make([]*structpb.Value, len(innerArr))
-		// 		for j := range innerArr {
-		// 			innerValues[j] = &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: innerArr[j]}}
-		// 		}
-		// 		features.Values[i] = &structpb.Value{Kind: &structpb.Value_ListValue{ListValue: &structpb.ListValue{Values: innerValues}}}
-		// 	}
-		// 	output := structpb.Struct{
-		// 		Fields: map[string]*structpb.Value{"feature": {Kind: &structpb.Value_ListValue{ListValue: &features}}},
-		// 	}
-		// 	outputs = append(outputs, &output)
-		case questionAnsweringTask:
-			inputStruct := QuestionAnsweringRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
-			req := client.R().SetBody(inputStruct)
-			resp, err := post(req, path)
-			if err != nil {
-				return nil, err
-			}
+		req := client.R().SetContext(ctx).SetBody(inputStruct.request())
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
 
-			var output structpb.Struct
-			if err = protojson.Unmarshal(resp.Body(), &output); err != nil {
-				return nil, err
-			}
+		outputStruct, err := inputStruct.output(resp.Body())
+		if err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, &output)
-		case tableQuestionAnsweringTask:
-			inputStruct := TableQuestionAnsweringRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		output, err := base.ConvertToStructpb(outputStruct)
+		if err != nil {
+			return nil, err
+		}
 
-			req := client.R().SetBody(inputStruct)
-			resp, err := post(req, path)
-			if err != nil {
-				return nil, err
-			}
+		return output, nil
+	case questionAnsweringTask:
+		inputStruct := QuestionAnsweringRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
+		req := client.R().SetContext(ctx).SetBody(inputStruct)
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
 
-			var output structpb.Struct
-			if err = protojson.Unmarshal(resp.Body(), &output); err != nil {
-				return nil, err
-			}
+		var output structpb.Struct
+		if err = protojson.Unmarshal(resp.Body(), &output); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, &output)
-		case sentenceSimilarityTask:
-			inputStruct := SentenceSimilarityRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		return &output, nil
+	case tableQuestionAnsweringTask:
+		inputStruct := TableQuestionAnsweringRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			req := client.R().SetBody(inputStruct)
-			resp, err := post(req, path)
-			if err != nil {
-				return nil, err
-			}
+		req := client.R().SetContext(ctx).SetBody(inputStruct)
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
 
-			output, err := wrapSliceInStruct(resp.Body(), "scores")
-			if err != nil {
-				return nil, err
-			}
+		var output structpb.Struct
+		if err = protojson.Unmarshal(resp.Body(), &output); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		case conversationalTask:
-			inputStruct := ConversationalRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		return &output, nil
+	case sentenceSimilarityTask:
+		inputStruct := SentenceSimilarityRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			req := client.R().SetBody(inputStruct)
-			resp, err := post(req, path)
-			if err != nil {
-				return nil, err
-			}
+		req := client.R().SetContext(ctx).SetBody(inputStruct)
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
 
-			var output structpb.Struct
-			if err = protojson.Unmarshal(resp.Body(), &output); err != nil {
-				return nil, err
-			}
+		output, err := wrapSliceInStruct(resp.Body(), "scores")
+		if err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, &output)
-		case imageClassificationTask:
-			inputStruct := ImageRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		return output, nil
+	case conversationalTask:
+		inputStruct := ConversationalRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Image))
-			if err != nil {
-				return nil, err
-			}
+		req := httpclient.SetTokenCost(client.R().SetContext(ctx), conversationalTokenCost(inputStruct))
+		req.SetBody(inputStruct)
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
 
-			req := client.R().SetBody(b)
-			resp, err := post(req, path)
-			if err != nil {
-				return nil, err
-			}
+		var output structpb.Struct
+		if err = protojson.Unmarshal(resp.Body(), &output); err != nil {
+			return nil, err
+		}
 
-			output, err := wrapSliceInStruct(resp.Body(), "classes")
-			if err != nil {
-				return nil, err
-			}
+		generatedText := output.GetFields()["generated_text"].GetStringValue()
+		usage, finishReason := conversationalUsage(inputStruct, generatedText)
+		if err := addLLMUsage(&output, usage, finishReason); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		case imageSegmentationTask:
-			inputStruct := ImageRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		return &output, nil
+	case imageClassificationTask:
+		inputStruct := ImageRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Image))
-			if err != nil {
-				return nil, err
-			}
+		b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Image))
+		if err != nil {
+			return nil, err
+		}
 
-			resp := []ImageSegmentationResponse{}
-			req := client.R().SetBody(b).SetResult(&resp)
-			if _, err := post(req, path); err != nil {
-				return nil, err
-			}
+		resp := []ImageClassificationResponse{}
+		req := client.R().SetContext(ctx).SetBody(b).SetResult(&resp)
+		if _, err := post(req, path); err != nil {
+			return nil, err
+		}
 
-			segments := &structpb.ListValue{
-				Values: make([]*structpb.Value, len(resp)),
-			}
+		output, err := base.ConvertToStructpb(classificationOutput(resp))
+		if err != nil {
+			return nil, err
+		}
 
-			for i := range resp {
-				segment, err := structpb.NewStruct(map[string]any{
-					"score": resp[i].Score,
-					"label": resp[i].Label,
-					"mask":  fmt.Sprintf("data:image/png;base64,%s", resp[i].Mask),
-				})
+		return output, nil
+	case imageSegmentationTask:
+		inputStruct := ImageSegmentationInput{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-				if err != nil {
-					return nil, err
-				}
+		b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Image))
+		if err != nil {
+			return nil, err
+		}
 
-				segments.Values[i] = structpb.NewStructValue(segment)
-			}
+		resp := []ImageSegmentationResponse{}
+		req := client.R().SetContext(ctx).SetBody(b).SetResult(&resp)
+		if _, err := post(req, path); err != nil {
+			return nil, err
+		}
 
-			output := &structpb.Struct{
-				Fields: map[string]*structpb.Value{
-					"segments": structpb.NewListValue(segments),
-				},
-			}
+		threshold := defaultMaskThreshold
+		if inputStruct.MaskThreshold != nil {
+			threshold = *inputStruct.MaskThreshold
+		}
 
-			outputs = append(outputs, output)
-		case objectDetectionTask:
-			inputStruct := ImageRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		segments, err := decodeSegments(resp, threshold, inputStruct.MergeByLabel)
+		if err != nil {
+			return nil, err
+		}
 
-			b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Image))
-			if err != nil {
-				return nil, err
-			}
+		out, err := segmentationOutput(segments, inputStruct.MergeByLabel)
+		if err != nil {
+			return nil, err
+		}
 
-			req := client.R().SetBody(b)
-			resp, err := post(req, path)
-			if err != nil {
-				return nil, err
-			}
+		output, err := base.ConvertToStructpb(out)
+		if err != nil {
+			return nil, err
+		}
 
-			output, err := wrapSliceInStruct(resp.Body(), "objects")
-			if err != nil {
-				return nil, err
-			}
+		return output, nil
+	case objectDetectionTask:
+		inputStruct := ImageRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		case imageToTextTask:
-			inputStruct := ImageRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Image))
+		if err != nil {
+			return nil, err
+		}
 
-			b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Image))
-			if err != nil {
-				return nil, err
-			}
+		resp := []ObjectDetectionResponse{}
+		req := client.R().SetContext(ctx).SetBody(b).SetResult(&resp)
+		if _, err := post(req, path); err != nil {
+			return nil, err
+		}
 
-			resp := []ImageToTextResponse{}
-			req := client.R().SetBody(b).SetResult(&resp)
-			if _, err := post(req, path); err != nil {
-				return nil, err
-			}
+		output, err := base.ConvertToStructpb(objectDetectionOutput(resp))
+		if err != nil {
+			return nil, err
+		}
 
-			if len(resp) < 1 {
-				err := fmt.Errorf("invalid response")
-				return nil, errmsg.AddMessage(err, "Hugging Face didn't return any result")
-			}
+		return output, nil
+	case imageToTextTask:
+		inputStruct := ImageRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			output, err := structpb.NewStruct(map[string]any{"text": resp[0].GeneratedText})
-			if err != nil {
-				return nil, err
-			}
+		b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Image))
+		if err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		case speechRecognitionTask:
-			inputStruct := AudioRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		resp := []ImageToTextResponse{}
+		req := client.R().SetContext(ctx).SetBody(b).SetResult(&resp)
+		if _, err := post(req, path); err != nil {
+			return nil, err
+		}
 
-			b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Audio))
-			if err != nil {
-				return nil, err
-			}
+		if len(resp) < 1 {
+			err := fmt.Errorf("invalid response")
+			return nil, errmsg.AddMessage(err, "Hugging Face didn't return any result")
+		}
 
-			req := client.R().SetBody(b)
-			resp, err := post(req, path)
-			if err != nil {
-				return nil, err
-			}
+		output, err := structpb.NewStruct(map[string]any{"text": resp[0].GeneratedText})
+		if err != nil {
+			return nil, err
+		}
 
-			output := new(structpb.Struct)
-			if err := protojson.Unmarshal(resp.Body(), output); err != nil {
-				return nil, err
-			}
+		return output, nil
+	case speechRecognitionTask:
+		inputStruct := AudioRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		case audioClassificationTask:
-			inputStruct := AudioRequest{}
-			if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
-				return nil, err
-			}
+		b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Audio))
+		if err != nil {
+			return nil, err
+		}
 
-			b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Audio))
-			if err != nil {
-				return nil, err
-			}
+		req := client.R().SetContext(ctx).SetBody(b)
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
 
-			req := client.R().SetBody(b)
-			resp, err := post(req, path)
-			if err != nil {
-				return nil, err
-			}
+		output := new(structpb.Struct)
+		if err := protojson.Unmarshal(resp.Body(), output); err != nil {
+			return nil, err
+		}
 
-			output, err := wrapSliceInStruct(resp.Body(), "classes")
-			if err != nil {
-				return nil, err
-			}
+		return output, nil
+	case audioClassificationTask:
+		inputStruct := AudioRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
 
-			outputs = append(outputs, output)
-		default:
-			return nil, errmsg.AddMessage(
-				fmt.Errorf("not supported task: %s", e.Task),
-				fmt.Sprintf("%s task is not supported.", e.Task),
-			)
+		b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Audio))
+		if err != nil {
+			return nil, err
+		}
+
+		req := client.R().SetContext(ctx).SetBody(b)
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
+
+		output, err := wrapSliceInStruct(resp.Body(), "classes")
+		if err != nil {
+			return nil, err
+		}
+
+		return output, nil
+	case textToSpeechTask:
+		inputStruct := TextToSpeechRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
+
+		req := client.R().SetContext(ctx).SetBody(inputStruct)
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
+
+		output, err := structpb.NewStruct(map[string]any{
+			"audio": dataURI(resp, "audio/flac"),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return output, nil
+	case zeroShotImageClassificationTask:
+		inputStruct := ZeroShotImageClassificationInput{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
+
+		resp := []ImageClassificationResponse{}
+		req := client.R().SetContext(ctx).SetResult(&resp).SetBody(ZeroShotImageClassificationRequest{
+			Inputs:     base.TrimBase64Mime(inputStruct.Image),
+			Parameters: inputStruct.Parameters,
+			Options:    inputStruct.Options,
+		})
+		if _, err := post(req, path); err != nil {
+			return nil, err
+		}
+
+		output, err := base.ConvertToStructpb(classificationOutput(resp))
+		if err != nil {
+			return nil, err
+		}
+
+		return output, nil
+	case depthEstimationTask:
+		inputStruct := ImageRequest{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
+
+		b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Image))
+		if err != nil {
+			return nil, err
+		}
+
+		resp := DepthEstimationResponse{}
+		req := client.R().SetContext(ctx).SetBody(b).SetResult(&resp)
+		if _, err := post(req, path); err != nil {
+			return nil, err
+		}
+
+		resp.Depth = fmt.Sprintf("data:image/png;base64,%s", resp.Depth)
+		output, err := base.ConvertToStructpb(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		return output, nil
+	case documentQuestionAnsweringTask:
+		inputStruct := DocumentQuestionAnsweringInput{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
 		}
-	}
 
-	return outputs, nil
+		req := client.R().SetContext(ctx).SetBody(DocumentQuestionAnsweringRequest{
+			Inputs: DocumentQuestionAnsweringInputs{
+				Image:    base.TrimBase64Mime(inputStruct.Image),
+				Question: inputStruct.Question,
+			},
+			Options: inputStruct.Options,
+		})
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
+
+		output, err := wrapSliceInStruct(resp.Body(), "answers")
+		if err != nil {
+			return nil, err
+		}
+
+		return output, nil
+	case imageToImageTask:
+		inputStruct := ImageToImageInput{}
+		if err := base.ConvertFromStructpb(input, &inputStruct); err != nil {
+			return nil, err
+		}
+
+		req := client.R().SetContext(ctx).SetBody(ImageToImageRequest{
+			Inputs:     base.TrimBase64Mime(inputStruct.Image),
+			Parameters: inputStruct.Parameters,
+			Options:    inputStruct.Options,
+		})
+		resp, err := post(req, path)
+		if err != nil {
+			return nil, err
+		}
+
+		output, err := structpb.NewStruct(map[string]any{
+			"image": dataURI(resp, "image/jpeg"),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return output, nil
+	default:
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("not supported task: %s", e.Task),
+			fmt.Sprintf("%s task is not supported.", e.Task),
+		)
+	}
 }
 
-func (c *Connector) Test(_ uuid.UUID, config *structpb.Struct, logger *zap.Logger) (pipelinePB.Connector_State, error) {
-	req := newClient(config, logger).R()
+func (c *Connector) Test(defUID uuid.UUID, config *structpb.Struct, logger *zap.Logger) (pipelinePB.Connector_State, error) {
+	req := newClient(defUID, config, logger, c.retryPolicy).R()
 	resp, err := req.Get("")
 	if err != nil {
 		return pipelinePB.Connector_STATE_ERROR, err
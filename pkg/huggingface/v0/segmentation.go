@@ -0,0 +1,132 @@
+package huggingface
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/instill-ai/connector/pkg/util/vision"
+	"github.com/instill-ai/x/errmsg"
+)
+
+const defaultMaskThreshold = 0.5
+
+type segment struct {
+	label string
+	score float64
+	mask  *vision.Mask
+	// encoded holds the mask as returned by Hugging Face. It's dropped when
+	// segments are merged.
+	encoded string
+}
+
+// decodeSegments decodes the masks of the image segmentation response. If
+// mergeByLabel is set, the segments with the same label are merged into one
+// segment, scored by its best-scoring part. Segments with an empty mask are
+// dropped.
+func decodeSegments(resp []ImageSegmentationResponse, threshold float64, mergeByLabel bool) ([]*segment, error) {
+	segments := make([]*segment, 0, len(resp))
+	byLabel := map[string]*segment{}
+	for _, r := range resp {
+		m, err := decodeMask(r.Mask, threshold)
+		if err != nil {
+			return nil, errmsg.AddMessage(
+				fmt.Errorf("decoding mask: %w", err),
+				fmt.Sprintf("Hugging Face returned an invalid mask for the segment %q.", r.Label),
+			)
+		}
+
+		if s, ok := byLabel[r.Label]; ok && mergeByLabel {
+			if err := s.mask.Merge(m); err != nil {
+				return nil, errmsg.AddMessage(
+					err,
+					fmt.Sprintf("Hugging Face returned masks of different sizes for the label %q.", r.Label),
+				)
+			}
+
+			s.score = max(s.score, r.Score)
+			s.encoded = ""
+			continue
+		}
+
+		s := &segment{label: r.Label, score: r.Score, mask: m, encoded: r.Mask}
+		byLabel[r.Label] = s
+		segments = append(segments, s)
+	}
+
+	nonEmpty := segments[:0]
+	for _, s := range segments {
+		if s.mask.Area() > 0 {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+
+	return nonEmpty, nil
+}
+
+// decodeMask decodes a base64-encoded PNG mask.
+func decodeMask(encoded string, threshold float64) (*vision.Mask, error) {
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return vision.DecodePNGMask(b, threshold)
+}
+
+// segmentationOutput builds the task output. Besides the segments, which keep
+// the mask image, it holds the Instill Model instance segmentation objects
+// and, when the segments are merged by label, the semantic segmentation
+// stuffs.
+func segmentationOutput(segments []*segment, mergedByLabel bool) (*ImageSegmentationOutput, error) {
+	out := &ImageSegmentationOutput{
+		Segments: make([]ImageSegment, len(segments)),
+		Objects:  make([]vision.InstanceSegmentationObject, len(segments)),
+	}
+
+	for i, s := range segments {
+		encoded := s.encoded
+		if encoded == "" {
+			b, err := s.mask.EncodePNG()
+			if err != nil {
+				return nil, err
+			}
+
+			encoded = base64.StdEncoding.EncodeToString(b)
+		}
+
+		bounds := s.mask.Bounds()
+		box := vision.BoxFromRect(bounds)
+		rle := s.mask.RLE(bounds)
+
+		polygon := []Point{}
+		for _, p := range s.mask.Polygon() {
+			polygon = append(polygon, Point{X: p.X, Y: p.Y})
+		}
+
+		out.Segments[i] = ImageSegment{
+			Score:       s.score,
+			Label:       s.label,
+			Mask:        fmt.Sprintf("data:image/png;base64,%s", encoded),
+			BoundingBox: box,
+			Area:        s.mask.Area(),
+			RLE:         rle,
+			Polygon:     polygon,
+		}
+
+		out.Objects[i] = vision.InstanceSegmentationObject{
+			RLE:         rle,
+			BoundingBox: box,
+			Category:    s.label,
+			Score:       s.score,
+		}
+
+		if mergedByLabel {
+			out.Stuffs = append(out.Stuffs, vision.SemanticSegmentationStuff{
+				RLE:      s.mask.RLE(s.mask.Image()),
+				Category: s.label,
+			})
+		}
+	}
+
+	return out, nil
+}
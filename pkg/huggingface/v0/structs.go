@@ -1,5 +1,7 @@
 package huggingface
 
+import "github.com/instill-ai/connector/pkg/util/vision"
+
 // Request structure for text-to-image model
 type TextToImageRequest struct {
 	// The prompt or prompts to guide the image generation.
@@ -108,9 +110,42 @@ type TextGenerationRequest struct {
 
 type TextGenerationResponse struct {
 	GeneratedText string `json:"generated_text,omitempty"`
+	// Details are only returned by Text Generation Inference, when requested.
+	Details *TextGenerationDetails `json:"details,omitempty"`
+}
+
+// TextGenerationDetails describes how Text Generation Inference generated a
+// text.
+type TextGenerationDetails struct {
+	// The reason the generation stopped: length, eos_token or stop_sequence.
+	FinishReason string `json:"finish_reason"`
+	// The number of generated tokens.
+	GeneratedTokens int `json:"generated_tokens"`
+	// The sampling seed, if sampling was enabled.
+	Seed *uint64 `json:"seed,omitempty"`
+	// The prompt tokens, when decoder_input_details is set.
+	Prefill []TextGenerationToken `json:"prefill,omitempty"`
+	// The generated tokens.
+	Tokens []TextGenerationToken `json:"tokens,omitempty"`
+	// The most likely tokens at each position, when top_n_tokens is set.
+	TopTokens [][]TextGenerationToken `json:"top_tokens,omitempty"`
+}
+
+// TextGenerationToken is a token of a Text Generation Inference generation.
+type TextGenerationToken struct {
+	ID   int    `json:"id"`
+	Text string `json:"text"`
+	// The log probability of the token. It is null for the first prompt
+	// token.
+	Logprob *float64 `json:"logprob,omitempty"`
+	// Whether the token is a special token, e.g. the end of sequence.
+	Special bool `json:"special,omitempty"`
 }
 
 type TextGenerationParameters struct {
+	// (Default: True). Bool. Whether or not to use sampling, use greedy decoding otherwise.
+	DoSample *bool `json:"do_sample,omitempty"`
+
 	// (Default: None). Integer to define the top tokens considered within the sample operation to create new text.
 	TopK *int `json:"top_k,omitempty"`
 
@@ -143,6 +178,24 @@ type TextGenerationParameters struct {
 
 	// (Default: 1). Integer. The number of proposition you want to be returned.
 	NumReturnSequences *int `json:"num_return_sequences,omitempty"`
+
+	// The parameters below are supported by Text Generation Inference.
+
+	// Stop generating tokens if one of these sequences is generated.
+	Stop []string `json:"stop,omitempty"`
+
+	// Random sampling seed.
+	Seed *uint64 `json:"seed,omitempty"`
+
+	// Return the details of the generation: the generated tokens, their log
+	// probabilities and the finish reason.
+	Details bool `json:"details,omitempty"`
+
+	// Return the details of the prompt tokens too.
+	DecoderInputDetails bool `json:"decoder_input_details,omitempty"`
+
+	// The number of most likely tokens to return at each position.
+	TopNTokens *int `json:"top_n_tokens,omitempty"`
 }
 
 // Request structure for the token classification endpoint
@@ -207,11 +260,34 @@ type ZeroShotResponse struct {
 	Scores []float64 `json:"scores,omitempty"`
 }
 
+// Request structure for the feature extraction endpoint
 type FeatureExtractionRequest struct {
-	// (Required)
-	Inputs string `json:"inputs"`
+	// (Required) The texts to embed. They are sent as a batch.
+	Inputs  []string `json:"inputs"`
+	Options Options  `json:"options,omitempty"`
+}
 
-	Options Options `json:"options,omitempty"`
+// Input of the feature extraction task. A single text, a batch of texts or
+// both can be embedded.
+type FeatureExtractionInput struct {
+	Inputs      string   `json:"inputs"`
+	BatchInputs []string `json:"batch_inputs"`
+	Options     Options  `json:"options,omitempty"`
+
+	// Pooling reduces token-level features to a single embedding per input.
+	// Supported values are "none" (default) and "mean".
+	Pooling string `json:"pooling,omitempty"`
+	// Normalize scales the embeddings to unit length.
+	Normalize bool `json:"normalize,omitempty"`
+}
+
+// Output of the feature extraction task. Token-level features are returned
+// when the model doesn't pool them and no pooling is requested.
+type FeatureExtractionOutput struct {
+	Embedding            []float64     `json:"embedding,omitempty"`
+	Embeddings           [][]float64   `json:"embeddings,omitempty"`
+	TokenEmbeddings      [][]float64   `json:"token_embeddings,omitempty"`
+	BatchTokenEmbeddings [][][]float64 `json:"batch_token_embeddings,omitempty"`
 }
 
 // Request structure for question answering model
@@ -348,6 +424,68 @@ type ImageRequest struct {
 	Image string `json:"image"`
 }
 
+type ImageSegmentationInput struct {
+	Image string `json:"image"`
+
+	// (Default: 0.5) Fraction of the maximum intensity above which a mask
+	// pixel belongs to the segment.
+	MaskThreshold *float64 `json:"mask_threshold,omitempty"`
+
+	// Merges the segments with the same label into a single segment.
+	MergeByLabel bool `json:"merge_by_label,omitempty"`
+}
+
+type ImageClassificationResponse struct {
+	// The label for the class (model specific).
+	Label string `json:"label"`
+
+	// A float that represents how likely it is that the image file belongs to this class.
+	Score float64 `json:"score"`
+}
+
+// ImageClassificationOutput holds the classes returned by Hugging Face and,
+// at the top level, the best-scoring class in the Instill Model
+// classification format.
+type ImageClassificationOutput struct {
+	*vision.Classification
+	Classes []ImageClass `json:"classes"`
+}
+
+type ImageClass struct {
+	vision.Classification
+	Label string `json:"label"`
+}
+
+type ObjectDetectionResponse struct {
+	// The label for the class (model specific) of a detected object.
+	Label string `json:"label"`
+
+	// A float that represents how likely it is that the detected object belongs to the given class.
+	Score float64 `json:"score"`
+
+	// A dict (with keys [xmin,ymin,xmax,ymax]) representing the bounding box of a detected object.
+	Box ObjectDetectionBox `json:"box"`
+}
+
+type ObjectDetectionBox struct {
+	XMin float64 `json:"xmin"`
+	YMin float64 `json:"ymin"`
+	XMax float64 `json:"xmax"`
+	YMax float64 `json:"ymax"`
+}
+
+// ObjectDetectionOutput holds the detected objects in the Instill Model
+// detection format. The objects keep the fields returned by Hugging Face.
+type ObjectDetectionOutput struct {
+	Objects []DetectedObject `json:"objects"`
+}
+
+type DetectedObject struct {
+	vision.DetectionObject
+	Label string             `json:"label"`
+	Box   ObjectDetectionBox `json:"box"`
+}
+
 type ImageSegmentationResponse struct {
 	// The label for the class (model specific) of a segment.
 	Label string `json:"label,omitempty"`
@@ -359,6 +497,36 @@ type ImageSegmentationResponse struct {
 	Mask string `json:"mask,omitempty"`
 }
 
+type ImageSegmentationOutput struct {
+	Segments []ImageSegment                      `json:"segments"`
+	Objects  []vision.InstanceSegmentationObject `json:"objects"`
+	// Stuffs are only returned when the segments are merged by label.
+	Stuffs []vision.SemanticSegmentationStuff `json:"stuffs,omitempty"`
+}
+
+type ImageSegment struct {
+	Score float64 `json:"score"`
+	Label string  `json:"label"`
+
+	// A data URI of the black and white PNG image of the mask.
+	Mask        string             `json:"mask"`
+	BoundingBox vision.BoundingBox `json:"bounding_box"`
+
+	// The number of pixels in the mask.
+	Area int `json:"area"`
+
+	// Run-length encoding of the mask within the bounding box.
+	RLE string `json:"rle"`
+
+	// The vertices of the outer contour of the mask.
+	Polygon []Point `json:"polygon"`
+}
+
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
 type ObjectBox struct {
 	XMin int `json:"xmin,omitempty"`
 	YMin int `json:"ymin,omitempty"`
@@ -379,3 +547,96 @@ type SpeechRecognitionResponse struct {
 	// The string that was recognized within the audio file.
 	Text string `json:"text,omitempty"`
 }
+
+// Request structure for the text-to-speech endpoint, which also serves the
+// text-to-audio models.
+type TextToSpeechRequest struct {
+	// (Required) The text to synthesize.
+	Inputs  string  `json:"inputs"`
+	Options Options `json:"options,omitempty"`
+}
+
+type ZeroShotImageClassificationInput struct {
+	Image      string                                `json:"image"`
+	Parameters ZeroShotImageClassificationParameters `json:"parameters"`
+	Options    Options                               `json:"options,omitempty"`
+}
+
+// Request structure for the zero-shot image classification endpoint
+type ZeroShotImageClassificationRequest struct {
+	// (Required) The base64-encoded image.
+	Inputs     string                                `json:"inputs"`
+	Parameters ZeroShotImageClassificationParameters `json:"parameters"`
+	Options    Options                               `json:"options,omitempty"`
+}
+
+type ZeroShotImageClassificationParameters struct {
+	// (Required) A list of strings that are potential classes for the image.
+	CandidateLabels []string `json:"candidate_labels"`
+
+	// The sentence used in conjunction with the candidate labels to attempt
+	// the image classification, e.g. "This is a photo of {}.".
+	HypothesisTemplate string `json:"hypothesis_template,omitempty"`
+}
+
+type DepthEstimationResponse struct {
+	// The base64-encoded PNG image of the depth.
+	Depth string `json:"depth"`
+
+	// The depth predicted by the model for each pixel.
+	PredictedDepth [][]float64 `json:"predicted_depth,omitempty"`
+}
+
+type DocumentQuestionAnsweringInput struct {
+	Image    string  `json:"image"`
+	Question string  `json:"question"`
+	Options  Options `json:"options,omitempty"`
+}
+
+// Request structure for the document question answering endpoint
+type DocumentQuestionAnsweringRequest struct {
+	Inputs  DocumentQuestionAnsweringInputs `json:"inputs"`
+	Options Options                         `json:"options,omitempty"`
+}
+
+type DocumentQuestionAnsweringInputs struct {
+	// (Required) The base64-encoded image of the document.
+	Image string `json:"image"`
+
+	// (Required) The question about the document.
+	Question string `json:"question"`
+}
+
+type ImageToImageInput struct {
+	Image      string                 `json:"image"`
+	Parameters ImageToImageParameters `json:"parameters,omitempty"`
+	Options    Options                `json:"options,omitempty"`
+}
+
+// Request structure for the image-to-image endpoint
+type ImageToImageRequest struct {
+	// (Required) The base64-encoded image to transform.
+	Inputs     string                 `json:"inputs"`
+	Parameters ImageToImageParameters `json:"parameters,omitempty"`
+	Options    Options                `json:"options,omitempty"`
+}
+
+type ImageToImageParameters struct {
+	// The text prompt to guide the image transformation.
+	Prompt string `json:"prompt,omitempty"`
+	// The prompt not to guide the image transformation.
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	// The number of denoising steps. More steps usually lead to a higher
+	// quality image at the expense of slower inference.
+	NumInferenceSteps int64 `json:"num_inference_steps,omitempty"`
+	// Higher guidance scale encourages to generate images that are closely
+	// linked to the prompt, usually at the expense of lower image quality.
+	GuidanceScale float64 `json:"guidance_scale,omitempty"`
+	// The size of the output image.
+	TargetSize *ImageSize `json:"target_size,omitempty"`
+}
+
+type ImageSize struct {
+	Width  int64 `json:"width"`
+	Height int64 `json:"height"`
+}
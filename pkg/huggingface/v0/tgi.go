@@ -0,0 +1,187 @@
+package huggingface
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/instill-ai/connector/pkg/util/httpclient"
+	"github.com/instill-ai/x/errmsg"
+)
+
+// TGIGenerateRequest is the request body of the Text Generation Inference
+// generate routes. Unlike the Inference API, TGI doesn't accept options nor
+// the max_time and num_return_sequences parameters.
+type TGIGenerateRequest struct {
+	Inputs     string        `json:"inputs"`
+	Parameters TGIParameters `json:"parameters"`
+}
+
+type TGIParameters struct {
+	DoSample            *bool    `json:"do_sample,omitempty"`
+	MaxNewTokens        *int     `json:"max_new_tokens,omitempty"`
+	RepetitionPenalty   *float64 `json:"repetition_penalty,omitempty"`
+	ReturnFullText      *bool    `json:"return_full_text,omitempty"`
+	Temperature         *float64 `json:"temperature,omitempty"`
+	TopK                *int     `json:"top_k,omitempty"`
+	TopP                *float64 `json:"top_p,omitempty"`
+	Stop                []string `json:"stop,omitempty"`
+	Seed                *uint64  `json:"seed,omitempty"`
+	Details             bool     `json:"details,omitempty"`
+	DecoderInputDetails bool     `json:"decoder_input_details,omitempty"`
+	TopNTokens          *int     `json:"top_n_tokens,omitempty"`
+}
+
+// TGIStreamResponse is an event of a streamed generation. The last event
+// holds the whole generated text and the details of the generation.
+type TGIStreamResponse struct {
+	Token         TextGenerationToken    `json:"token"`
+	TopTokens     []TextGenerationToken  `json:"top_tokens,omitempty"`
+	GeneratedText *string                `json:"generated_text"`
+	Details       *TextGenerationDetails `json:"details"`
+	Error         string                 `json:"error,omitempty"`
+}
+
+// TextGenerationChunk is an incremental piece of a streamed text generation.
+type TextGenerationChunk struct {
+	// InputIndex is the position, within the execution batch, of the input
+	// that produced the chunk.
+	InputIndex int
+	// Attempt is the number, starting at 0, of the generation the chunk
+	// belongs to. When the text doesn't follow the JSON schema of the input,
+	// the model is prompted again and the chunks of the new attempt replace
+	// the ones streamed before.
+	Attempt int
+	// Text is the content delta.
+	Text string
+}
+
+// StreamHandler receives the chunks of a streamed text generation.
+type StreamHandler func(TextGenerationChunk)
+
+// tgiRequest sets the defaults of the Inference API on a text generation
+// request sent to Text Generation Inference. In particular, TGI doesn't
+// return the prompt with the generated text by default.
+func tgiRequest(req TextGenerationRequest) TextGenerationRequest {
+	if req.Parameters.ReturnFullText == nil {
+		returnFullText := true
+		req.Parameters.ReturnFullText = &returnFullText
+	}
+
+	return req
+}
+
+func tgiBody(req TextGenerationRequest) TGIGenerateRequest {
+	p := req.Parameters
+	return TGIGenerateRequest{
+		Inputs: req.Inputs,
+		Parameters: TGIParameters{
+			DoSample:            p.DoSample,
+			MaxNewTokens:        p.MaxNewTokens,
+			RepetitionPenalty:   p.RepetitionPenalty,
+			ReturnFullText:      p.ReturnFullText,
+			Temperature:         p.Temperature,
+			TopK:                p.TopK,
+			TopP:                p.TopP,
+			Stop:                p.Stop,
+			Seed:                p.Seed,
+			Details:             p.Details,
+			DecoderInputDetails: p.DecoderInputDetails,
+			TopNTokens:          p.TopNTokens,
+		},
+	}
+}
+
+// tgiGenerate sends a text generation request to Text Generation Inference,
+// streaming the response if the execution has a stream handler. The chunks
+// are tagged with the structured output attempt.
+func (e *Execution) tgiGenerate(ctx context.Context, client *httpclient.Client, i, attempt int, in TextGenerationRequest) (TextGenerationResponse, error) {
+	resp := TextGenerationResponse{}
+	req := httpclient.SetTokenCost(client.R().SetContext(ctx), textGenerationTokenCost(in))
+	if e.streamHandler == nil {
+		req.SetBody(tgiBody(in)).SetResult(&resp)
+		_, err := post(req, tgiGeneratePath)
+		return resp, err
+	}
+
+	restyResp, err := post(req.SetBody(tgiBody(in)).SetDoNotParseResponse(true), tgiGenerateStreamPath)
+	if err != nil {
+		return resp, err
+	}
+
+	rawBody := restyResp.RawBody()
+	defer rawBody.Close()
+
+	if restyResp.IsError() {
+		return resp, client.RawResponseError(restyResp)
+	}
+
+	return readTGIStream(rawBody, in, func(text string) {
+		e.streamMu.Lock()
+		defer e.streamMu.Unlock()
+
+		e.streamHandler(TextGenerationChunk{InputIndex: i, Attempt: attempt, Text: text})
+	})
+}
+
+// readTGIStream reads the server-sent events of a streamed generation, calls
+// onToken with the text of every generated token and returns the response
+// assembled from the events.
+func readTGIStream(r io.Reader, in TextGenerationRequest, onToken func(text string)) (TextGenerationResponse, error) {
+	resp := TextGenerationResponse{}
+	text := new(strings.Builder)
+	var tokens []TextGenerationToken
+	var topTokens [][]TextGenerationToken
+
+	err := httpclient.ScanEvents(r, func(data string) error {
+		event := TGIStreamResponse{}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return err
+		}
+
+		if event.Error != "" {
+			return errmsg.AddMessage(
+				fmt.Errorf("streaming generation: %s", event.Error),
+				fmt.Sprintf("Hugging Face failed to generate the text: %s", event.Error),
+			)
+		}
+
+		tokens = append(tokens, event.Token)
+		if event.TopTokens != nil {
+			topTokens = append(topTokens, event.TopTokens)
+		}
+
+		if !event.Token.Special {
+			text.WriteString(event.Token.Text)
+			onToken(event.Token.Text)
+		}
+
+		if event.GeneratedText != nil {
+			resp.GeneratedText = *event.GeneratedText
+			resp.Details = event.Details
+		}
+
+		return nil
+	})
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.GeneratedText == "" {
+		resp.GeneratedText = text.String()
+		if in.Parameters.ReturnFullText != nil && *in.Parameters.ReturnFullText {
+			resp.GeneratedText = in.Inputs + resp.GeneratedText
+		}
+	}
+
+	// The streamed details don't include the tokens, which are sent in the
+	// events.
+	if resp.Details != nil {
+		resp.Details.Tokens = tokens
+		resp.Details.TopTokens = topTokens
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,38 @@
+package huggingface
+
+import "github.com/instill-ai/connector/pkg/util/vision"
+
+// These functions convert the Hugging Face vision task results into the
+// shared vision types.
+
+func classificationOutput(resp []ImageClassificationResponse) ImageClassificationOutput {
+	out := ImageClassificationOutput{Classes: make([]ImageClass, len(resp))}
+	classes := make([]vision.Classification, len(resp))
+	for i, r := range resp {
+		classes[i] = vision.Classification{Category: r.Label, Score: r.Score}
+		out.Classes[i] = ImageClass{Classification: classes[i], Label: r.Label}
+	}
+
+	if top, ok := vision.TopClassification(classes); ok {
+		out.Classification = &top
+	}
+
+	return out
+}
+
+func objectDetectionOutput(resp []ObjectDetectionResponse) ObjectDetectionOutput {
+	out := ObjectDetectionOutput{Objects: make([]DetectedObject, len(resp))}
+	for i, r := range resp {
+		out.Objects[i] = DetectedObject{
+			DetectionObject: vision.DetectionObject{
+				BoundingBox: vision.BoxFromCorners(r.Box.XMin, r.Box.YMin, r.Box.XMax, r.Box.YMax),
+				Category:    r.Label,
+				Score:       r.Score,
+			},
+			Label: r.Label,
+			Box:   r.Box,
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,418 @@
+package instill
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/instill-ai/connector/pkg/util"
+	commonPB "github.com/instill-ai/protogen-go/common/task/v1alpha"
+	modelPB "github.com/instill-ai/protogen-go/model/model/v1alpha"
+	"github.com/instill-ai/x/errmsg"
+)
+
+const (
+	apiToken  = "123"
+	modelName = "users/admin/models/my-model"
+)
+
+// fakeModelClient answers the model triggers with the outputs returned by
+// respond and records the requests. The rest of the methods of the model
+// service aren't implemented.
+type fakeModelClient struct {
+	modelPB.ModelPublicServiceClient
+
+	c       *qt.C
+	respond func(req *modelPB.TriggerUserModelRequest) []*modelPB.TaskOutput
+	reqs    []*modelPB.TriggerUserModelRequest
+}
+
+func (f *fakeModelClient) TriggerUserModel(ctx context.Context, req *modelPB.TriggerUserModelRequest, _ ...grpc.CallOption) (*modelPB.TriggerUserModelResponse, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	f.c.Check(md.Get("Authorization"), qt.DeepEquals, []string{"Bearer " + apiToken})
+	f.c.Check(req.GetName(), qt.Equals, modelName)
+
+	f.reqs = append(f.reqs, req)
+	return &modelPB.TriggerUserModelResponse{TaskOutputs: f.respond(req)}, nil
+}
+
+func textGenerationOutput(text string) []*modelPB.TaskOutput {
+	return []*modelPB.TaskOutput{{
+		Output: &modelPB.TaskOutput_TextGeneration{
+			TextGeneration: &modelPB.TextGenerationOutput{Text: text},
+		},
+	}}
+}
+
+func newExecution(c *qt.C, task string) *Execution {
+	logger := zap.NewNop()
+	connector := Init(logger)
+
+	config, err := structpb.NewStruct(map[string]any{
+		"api_token":        apiToken,
+		"instill_user_uid": "user-uid",
+	})
+	c.Assert(err, qt.IsNil)
+
+	exec, err := connector.CreateExecution(uuid.Must(uuid.NewV4()), task, config, logger)
+	c.Assert(err, qt.IsNil)
+
+	return exec.(*Execution)
+}
+
+// protoOutput converts a task output as the connector did before the shared
+// vision types were introduced.
+func protoOutput(c *qt.C, m proto.Message) map[string]any {
+	b, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(m)
+	c.Assert(err, qt.IsNil)
+
+	s := new(structpb.Struct)
+	c.Assert(protojson.Unmarshal(b, s), qt.IsNil)
+
+	return s.AsMap()
+}
+
+func TestConnector_ExecuteVision(t *testing.T) {
+	c := qt.New(t)
+
+	box := &modelPB.BoundingBox{Top: 10, Left: 20.5, Width: 30, Height: 40.25}
+	classification := &modelPB.ClassificationOutput{Category: "dog", Score: 0.9}
+	detection := &modelPB.DetectionOutput{Objects: []*modelPB.DetectionObject{
+		{Category: "dog", Score: 0.9, BoundingBox: box},
+		{Category: "cat", Score: 0.35, BoundingBox: box},
+	}}
+	keypoint := &modelPB.KeypointOutput{Objects: []*modelPB.KeypointObject{{
+		Keypoints:   []*modelPB.Keypoint{{X: 1.5, Y: 2, V: 0.7}, {X: 3, Y: 4.25, V: 1}},
+		Score:       0.8,
+		BoundingBox: box,
+	}}}
+	ocr := &modelPB.OcrOutput{Objects: []*modelPB.OcrObject{
+		{Text: "Hello", Score: 0.99, BoundingBox: box},
+	}}
+	instanceSegmentation := &modelPB.InstanceSegmentationOutput{Objects: []*modelPB.InstanceSegmentationObject{
+		{Rle: "0,3,1", Category: "dog", Score: 0.6, BoundingBox: box},
+	}}
+	semanticSegmentation := &modelPB.SemanticSegmentationOutput{Stuffs: []*modelPB.SemanticSegmentationStuff{
+		{Rle: "2,2", Category: "sky"},
+		{Rle: "0,2,2", Category: "grass"},
+	}}
+
+	testcases := []struct {
+		task    commonPB.Task
+		execute func(*Execution, modelPB.ModelPublicServiceClient, string, []*structpb.Struct) ([]*structpb.Struct, error)
+		output  *modelPB.TaskOutput
+		want    proto.Message
+	}{
+		{
+			task:    commonPB.Task_TASK_CLASSIFICATION,
+			execute: (*Execution).executeImageClassification,
+			output:  &modelPB.TaskOutput{Output: &modelPB.TaskOutput_Classification{Classification: classification}},
+			want:    classification,
+		},
+		{
+			task:    commonPB.Task_TASK_DETECTION,
+			execute: (*Execution).executeObjectDetection,
+			output:  &modelPB.TaskOutput{Output: &modelPB.TaskOutput_Detection{Detection: detection}},
+			want:    detection,
+		},
+		{
+			task:    commonPB.Task_TASK_KEYPOINT,
+			execute: (*Execution).executeKeyPointDetection,
+			output:  &modelPB.TaskOutput{Output: &modelPB.TaskOutput_Keypoint{Keypoint: keypoint}},
+			want:    keypoint,
+		},
+		{
+			task:    commonPB.Task_TASK_OCR,
+			execute: (*Execution).executeOCR,
+			output:  &modelPB.TaskOutput{Output: &modelPB.TaskOutput_Ocr{Ocr: ocr}},
+			want:    ocr,
+		},
+		{
+			task:    commonPB.Task_TASK_INSTANCE_SEGMENTATION,
+			execute: (*Execution).executeInstanceSegmentation,
+			output:  &modelPB.TaskOutput{Output: &modelPB.TaskOutput_InstanceSegmentation{InstanceSegmentation: instanceSegmentation}},
+			want:    instanceSegmentation,
+		},
+		{
+			task:    commonPB.Task_TASK_SEMANTIC_SEGMENTATION,
+			execute: (*Execution).executeSemanticSegmentation,
+			output:  &modelPB.TaskOutput{Output: &modelPB.TaskOutput_SemanticSegmentation{SemanticSegmentation: semanticSegmentation}},
+			want:    semanticSegmentation,
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.task.String(), func(c *qt.C) {
+			client := &fakeModelClient{
+				c: c,
+				respond: func(req *modelPB.TriggerUserModelRequest) []*modelPB.TaskOutput {
+					outputs := make([]*modelPB.TaskOutput, len(req.GetTaskInputs()))
+					for i := range outputs {
+						outputs[i] = tc.output
+					}
+
+					return outputs
+				},
+			}
+
+			pbIn, err := structpb.NewStruct(map[string]any{"image_base64": "data:image/png;base64,aW1n"})
+			c.Assert(err, qt.IsNil)
+
+			got, err := tc.execute(newExecution(c, tc.task.String()), client, modelName, []*structpb.Struct{pbIn})
+			c.Assert(err, qt.IsNil)
+			c.Assert(got, qt.HasLen, 1)
+
+			// The outputs keep the format of the Instill Model responses.
+			c.Check(got[0].AsMap(), qt.DeepEquals, protoOutput(c, tc.want))
+		})
+	}
+}
+
+func TestConnector_ExecutePromptTemplate(t *testing.T) {
+	c := qt.New(t)
+
+	task := commonPB.Task_TASK_TEXT_GENERATION.String()
+
+	c.Run("ok - rendered template", func(c *qt.C) {
+		client := &fakeModelClient{
+			c: c,
+			respond: func(*modelPB.TriggerUserModelRequest) []*modelPB.TaskOutput {
+				return textGenerationOutput("In Rome.")
+			},
+		}
+
+		pbIn, err := structpb.NewStruct(map[string]any{
+			"prompt_template": "Where is the {{.monument}}?",
+			"variables":       map[string]any{"monument": "Colosseum"},
+		})
+		c.Assert(err, qt.IsNil)
+
+		got, err := newExecution(c, task).executeTextGeneration(client, modelName, []*structpb.Struct{pbIn})
+		c.Assert(err, qt.IsNil)
+		c.Check(got[0].AsMap()["text"], qt.Equals, "In Rome.")
+
+		c.Assert(client.reqs, qt.HasLen, 1)
+		c.Check(client.reqs[0].GetTaskInputs()[0].GetTextGeneration().GetPrompt(), qt.Equals, "Where is the Colosseum?")
+	})
+
+	c.Run("nok - prompt and template", func(c *qt.C) {
+		client := &fakeModelClient{c: c}
+
+		pbIn, err := structpb.NewStruct(map[string]any{
+			"prompt":          "Where is the Colosseum?",
+			"prompt_template": "Where is the {{.monument}}?",
+		})
+		c.Assert(err, qt.IsNil)
+
+		_, err = newExecution(c, task).executeTextGeneration(client, modelName, []*structpb.Struct{pbIn})
+		c.Check(errmsg.Message(err), qt.Equals, "Provide either a prompt or a prompt template, not both.")
+		c.Check(client.reqs, qt.HasLen, 0)
+	})
+}
+
+func TestConnector_ExecuteStructuredOutput(t *testing.T) {
+	c := qt.New(t)
+
+	task := commonPB.Task_TASK_TEXT_GENERATION.String()
+	schema := map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"city": map[string]any{"type": "string"}},
+		"required":   []any{"city"},
+	}
+
+	testcases := []struct {
+		name      string
+		retries   int
+		responses []string
+		// wantCompletion is the number of tokens of the generated texts.
+		wantCompletion float64
+		wantErr        string
+	}{
+		{
+			name:           "ok - valid output",
+			responses:      []string{`{"city": "Rome"}`},
+			wantCompletion: 4,
+		},
+		{
+			name:           "ok - output fixed after retry",
+			retries:        1,
+			responses:      []string{"Rome", "```json\n{\"city\": \"Rome\"}\n```"},
+			wantCompletion: 1 + 7,
+		},
+		{
+			name:      "nok - retries exhausted",
+			retries:   1,
+			responses: []string{"Rome", `{"town": "Rome"}`},
+			wantErr:   "The model didn't generate a valid structured output after 2 attempts. The response doesn't follow the JSON schema (/: missing properties: 'city').",
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			client := &fakeModelClient{c: c}
+			client.respond = func(*modelPB.TriggerUserModelRequest) []*modelPB.TaskOutput {
+				return textGenerationOutput(tc.responses[len(client.reqs)-1])
+			}
+
+			pbIn, err := structpb.NewStruct(map[string]any{
+				"prompt":              "Where is the Colosseum?",
+				"json_schema":         schema,
+				"json_schema_retries": tc.retries,
+			})
+			c.Assert(err, qt.IsNil)
+
+			got, err := newExecution(c, task).executeTextGeneration(client, modelName, []*structpb.Struct{pbIn})
+			c.Check(client.reqs, qt.HasLen, len(tc.responses))
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				return
+			}
+
+			c.Assert(err, qt.IsNil)
+			c.Check(got[0].AsMap()["data"], qt.DeepEquals, map[string]any{"city": "Rome"})
+			c.Check(got[0].AsMap()["text"], qt.Equals, tc.responses[len(tc.responses)-1])
+
+			// Every attempt is accounted for.
+			c.Check(got[0].AsMap()["usage"].(map[string]any)["completion_tokens"], qt.Equals, tc.wantCompletion)
+
+			// Instill Model can't enforce the schema, so the model is
+			// instructed to follow it.
+			first := client.reqs[0].GetTaskInputs()[0].GetTextGeneration()
+			c.Check(strings.HasPrefix(first.GetPrompt(), "Where is the Colosseum?\n\n"), qt.IsTrue)
+			c.Check(first.GetPrompt(), qt.Contains, `"city"`)
+			c.Check(first.GetChatHistory(), qt.HasLen, 0)
+
+			if len(client.reqs) == 1 {
+				return
+			}
+
+			// The invalid output is fed back to the model.
+			retry := client.reqs[1].GetTaskInputs()[0].GetTextGeneration()
+			c.Check(retry.GetPrompt(), qt.Not(qt.Equals), "")
+			c.Assert(retry.GetChatHistory(), qt.HasLen, 2)
+			c.Check(retry.GetChatHistory()[0].GetRole(), qt.Equals, "user")
+			c.Check(retry.GetChatHistory()[0].GetContent()[0].GetText(), qt.Equals, first.GetPrompt())
+			c.Check(retry.GetChatHistory()[1].GetRole(), qt.Equals, "assistant")
+			c.Check(retry.GetChatHistory()[1].GetContent()[0].GetText(), qt.Equals, "Rome")
+		})
+	}
+}
+
+func TestConnector_ExecuteContextTrimming(t *testing.T) {
+	c := qt.New(t)
+
+	task := commonPB.Task_TASK_TEXT_GENERATION.String()
+
+	textMsg := func(role, text string) map[string]any {
+		return map[string]any{"role": role, "content": []any{map[string]any{"type": "text", "text": text}}}
+	}
+
+	// The tokens of these messages are estimated to 10 each.
+	a, b, d, e := strings.Repeat("a", 40), strings.Repeat("b", 40), strings.Repeat("d", 40), strings.Repeat("e", 40)
+	history := []any{
+		textMsg("user", a),
+		textMsg("assistant", b),
+		textMsg("user", d),
+		textMsg("assistant", e),
+	}
+
+	type message struct {
+		Role, Text string
+	}
+
+	testcases := []struct {
+		name        string
+		trimming    string
+		maxContext  int
+		wantSystem  string
+		wantHistory []message
+		wantErr     string
+	}{
+		{
+			name:       "ok - fits",
+			trimming:   "drop",
+			maxContext: 43,
+			wantSystem: "Be nice.",
+			wantHistory: []message{
+				{"user", a}, {"assistant", b}, {"user", d}, {"assistant", e},
+			},
+		},
+		{
+			// Dropping the first message is enough for the history to
+			// fit, but Instill Model requires it to start with a user
+			// message, so the assistant reply is dropped too.
+			name:        "ok - drop",
+			trimming:    "drop",
+			maxContext:  37,
+			wantSystem:  "Be nice.",
+			wantHistory: []message{{"user", d}, {"assistant", e}},
+		},
+		{
+			name:        "ok - summarize",
+			trimming:    "summarize",
+			maxContext:  299,
+			wantSystem:  "Be nice.\n\nSummary of the earlier conversation: They talked about letters.",
+			wantHistory: []message{{"user", d}, {"assistant", e}},
+		},
+		{
+			name:       "nok - no room for the prompt",
+			trimming:   "drop",
+			maxContext: 2,
+			wantErr:    "The prompt, the system messages and the tokens reserved for the completion take 3 tokens, which exceeds the maximum context of 2 tokens.",
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			client := &fakeModelClient{c: c}
+			client.respond = func(req *modelPB.TriggerUserModelRequest) []*modelPB.TaskOutput {
+				in := req.GetTaskInputs()[0].GetTextGeneration()
+				if len(client.reqs) == 1 && tc.trimming == "summarize" {
+					c.Check(in.GetPrompt(), qt.Equals, util.SummaryPrompt+"\n\nuser: "+a+"\nassistant: "+b+"\n")
+					c.Check(in.GetMaxNewTokens(), qt.Equals, int32(util.SummaryMaxTokens))
+					return textGenerationOutput(" They talked about letters. ")
+				}
+
+				return textGenerationOutput("Hello")
+			}
+
+			pbIn, err := structpb.NewStruct(map[string]any{
+				"prompt":             "Hi",
+				"system_message":     "Be nice.",
+				"chat_history":       history,
+				"max_context_tokens": tc.maxContext,
+				"history_trimming":   tc.trimming,
+			})
+			c.Assert(err, qt.IsNil)
+
+			got, err := newExecution(c, task).executeTextGeneration(client, modelName, []*structpb.Struct{pbIn})
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				c.Check(client.reqs, qt.HasLen, 0)
+				return
+			}
+
+			c.Assert(err, qt.IsNil)
+			c.Check(got[0].AsMap()["text"], qt.Equals, "Hello")
+
+			req := client.reqs[len(client.reqs)-1].GetTaskInputs()[0].GetTextGeneration()
+			c.Check(req.GetPrompt(), qt.Equals, "Hi")
+			c.Check(req.GetSystemMessage(), qt.Equals, tc.wantSystem)
+
+			gotHistory := make([]message, len(req.GetChatHistory()))
+			for i, m := range req.GetChatHistory() {
+				gotHistory[i] = message{m.GetRole(), m.GetContent()[0].GetText()}
+			}
+			c.Check(gotHistory, qt.DeepEquals, tc.wantHistory)
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package instill
 
 import (
-	"context"
 	"fmt"
 
 	"google.golang.org/grpc/metadata"
@@ -47,7 +46,7 @@ func (e *Execution) executeImageClassification(grpcClient modelPB.ModelPublicSer
 		Name:       modelName,
 		TaskInputs: taskInputs,
 	}
-	ctx := metadata.NewOutgoingContext(context.Background(), getRequestMetadata(e.Config))
+	ctx := metadata.NewOutgoingContext(e.Context(), getRequestMetadata(e.Config))
 	res, err := grpcClient.TriggerUserModel(ctx, &req)
 	if err != nil || res == nil {
 		return nil, err
@@ -62,15 +61,7 @@ func (e *Execution) executeImageClassification(grpcClient modelPB.ModelPublicSer
 		if imgClassificationOp == nil {
 			return nil, fmt.Errorf("invalid output: %v for model: %s", imgClassificationOp, modelName)
 		}
-		outputJSON, err := protojson.MarshalOptions{
-			UseProtoNames:   true,
-			EmitUnpopulated: true,
-		}.Marshal(imgClassificationOp)
-		if err != nil {
-			return nil, err
-		}
-		output := &structpb.Struct{}
-		err = protojson.Unmarshal(outputJSON, output)
+		output, err := base.ConvertToStructpb(classificationOutput(imgClassificationOp))
 		if err != nil {
 			return nil, err
 		}
@@ -1,7 +1,6 @@
 package instill
 
 import (
-	"context"
 	"fmt"
 
 	"google.golang.org/grpc/metadata"
@@ -65,7 +64,7 @@ func (e *Execution) executeImageToImage(grpcClient modelPB.ModelPublicServiceCli
 			Name:       modelName,
 			TaskInputs: []*modelPB.TaskInput{{Input: taskInput}},
 		}
-		ctx := metadata.NewOutgoingContext(context.Background(), getRequestMetadata(e.Config))
+		ctx := metadata.NewOutgoingContext(e.Context(), getRequestMetadata(e.Config))
 		res, err := grpcClient.TriggerUserModel(ctx, &req)
 		if err != nil || res == nil {
 			return nil, err
@@ -1,7 +1,6 @@
 package instill
 
 import (
-	"context"
 	"fmt"
 
 	"google.golang.org/grpc/metadata"
@@ -41,7 +40,7 @@ func (e *Execution) executeKeyPointDetection(grpcClient modelPB.ModelPublicServi
 		Name:       modelName,
 		TaskInputs: taskInputs,
 	}
-	ctx := metadata.NewOutgoingContext(context.Background(), getRequestMetadata(e.Config))
+	ctx := metadata.NewOutgoingContext(e.Context(), getRequestMetadata(e.Config))
 	res, err := grpcClient.TriggerUserModel(ctx, &req)
 	if err != nil || res == nil {
 		return nil, err
@@ -56,15 +55,7 @@ func (e *Execution) executeKeyPointDetection(grpcClient modelPB.ModelPublicServi
 		if keyPointOutput == nil {
 			return nil, fmt.Errorf("invalid output: %v for model: %s", keyPointOutput, modelName)
 		}
-		outputJSON, err := protojson.MarshalOptions{
-			UseProtoNames:   true,
-			EmitUnpopulated: true,
-		}.Marshal(keyPointOutput)
-		if err != nil {
-			return nil, err
-		}
-		output := &structpb.Struct{}
-		err = protojson.Unmarshal(outputJSON, output)
+		output, err := base.ConvertToStructpb(keypointOutput(keyPointOutput))
 		if err != nil {
 			return nil, err
 		}
@@ -1,10 +1,16 @@
 package instill
 
 import (
+	"fmt"
+	"strings"
+
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
+	"github.com/instill-ai/connector/pkg/util/tokenizer"
 	modelPB "github.com/instill-ai/protogen-go/model/model/v1alpha"
+	"github.com/instill-ai/x/errmsg"
 )
 
 type LLMInput struct {
@@ -29,9 +35,18 @@ type LLMInput struct {
 	ExtraParams *structpb.Struct
 }
 
-func (e *Execution) convertLLMInput(input *structpb.Struct) *LLMInput {
+func (e *Execution) convertLLMInput(input *structpb.Struct) (*LLMInput, error) {
+	prompt, err := util.PromptFromTemplate(
+		input.GetFields()["prompt"].GetStringValue(),
+		input.GetFields()["prompt_template"].GetStringValue(),
+		input.GetFields()["variables"].GetStructValue().AsMap(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	llmInput := &LLMInput{
-		Prompt: input.GetFields()["prompt"].GetStringValue(),
+		Prompt: prompt,
 	}
 
 	if _, ok := input.GetFields()["system_message"]; ok {
@@ -126,6 +141,242 @@ func (e *Execution) convertLLMInput(input *structpb.Struct) *LLMInput {
 		v := input.GetFields()["extra_params"].GetStructValue()
 		llmInput.ExtraParams = v
 	}
-	return llmInput
+	return llmInput, nil
+}
+
+// promptTexts returns the texts that are sent to the model as part of the
+// prompt.
+func (l *LLMInput) promptTexts() []string {
+	texts := []string{l.Prompt}
+	if l.SystemMessage != nil {
+		texts = append(texts, *l.SystemMessage)
+	}
+	for _, m := range l.ChatHistory {
+		for _, c := range m.GetContent() {
+			texts = append(texts, c.GetText())
+		}
+	}
+
+	return texts
+}
+
+// llmUsage estimates the token usage of a text generation and the reason it
+// stopped. Instill Model doesn't report these values.
+func llmUsage(text string, llmInput *LLMInput) (util.LLMUsage, string) {
+	completionTokens := util.EstimateTokens(text)
+	usage := util.NewLLMUsage(util.EstimateTokens(llmInput.promptTexts()...), completionTokens)
+
+	var maxTokens int
+	if llmInput.MaxNewTokens != nil {
+		maxTokens = int(*llmInput.MaxNewTokens)
+	}
+
+	return usage, util.EstimateFinishReason(completionTokens, maxTokens)
+}
+
+// addLLMUsage completes a text generation output with the token usage and
+// the reason the generation stopped. Instill Model doesn't report these
+// values, so they are estimated from the input and the generated text.
+func addLLMUsage(output *structpb.Struct, llmInput *LLMInput) error {
+	usage, finishReason := llmUsage(output.GetFields()["text"].GetStringValue(), llmInput)
+	return setLLMUsage(output, usage, finishReason)
+}
+
+func setLLMUsage(output *structpb.Struct, usage util.LLMUsage, finishReason string) error {
+	usageStruct, err := base.ConvertToStructpb(usage)
+	if err != nil {
+		return err
+	}
+
+	output.Fields["usage"] = structpb.NewStructValue(usageStruct)
+	output.Fields["finish_reason"] = structpb.NewStringValue(finishReason)
+
+	return nil
+}
+
+// generateText runs a text generation through trigger and completes its
+// output with the token usage. If the input has a JSON schema, Instill Model
+// can't enforce it, so the model is instructed to follow it and the generated
+// text is parsed into the output data. When the text doesn't follow the
+// schema, the model is prompted again with the validation errors.
+func generateText(input *structpb.Struct, llmInput *LLMInput, trigger func(*LLMInput) (*structpb.Struct, error)) (*structpb.Struct, error) {
+	schemaField, ok := input.GetFields()["json_schema"]
+	if !ok {
+		output, err := trigger(llmInput)
+		if err != nil || output == nil {
+			return nil, err
+		}
+
+		if err := addLLMUsage(output, llmInput); err != nil {
+			return nil, err
+		}
+
+		return output, nil
+	}
+
+	schema, err := util.CompileJSONSchema(schemaField.GetStructValue().AsMap())
+	if err != nil {
+		return nil, err
+	}
+
+	req := *llmInput
+	req.Prompt = fmt.Sprintf("%s\n\n%s", req.Prompt, schema.Instructions())
+
+	var output *structpb.Struct
+	var usage util.LLMUsage
+	var finishReason string
+	retries := int(input.GetFields()["json_schema_retries"].GetNumberValue())
+	data, _, err := util.GenerateStructured(schema, retries, func(feedback string) (string, error) {
+		if feedback != "" {
+			req.ChatHistory = append(req.ChatHistory, promptMessage(&req), &modelPB.Message{
+				Role: "assistant",
+				Content: []*modelPB.MessageContent{{
+					Type:    "text",
+					Content: &modelPB.MessageContent_Text{Text: output.GetFields()["text"].GetStringValue()},
+				}},
+			})
+			req.Prompt, req.PromptImages = feedback, nil
+		}
+
+		var err error
+		if output, err = trigger(&req); err != nil {
+			return "", err
+		}
+		if output == nil {
+			return "", fmt.Errorf("empty text generation output")
+		}
+
+		text := output.GetFields()["text"].GetStringValue()
+
+		// Every attempt consumes tokens.
+		var attemptUsage util.LLMUsage
+		attemptUsage, finishReason = llmUsage(text, &req)
+		usage = util.NewLLMUsage(usage.PromptTokens+attemptUsage.PromptTokens, usage.CompletionTokens+attemptUsage.CompletionTokens)
+
+		return text, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dataStruct, err := structpb.NewStruct(data)
+	if err != nil {
+		return nil, err
+	}
+
+	output.Fields["data"] = structpb.NewStructValue(dataStruct)
+	if err := setLLMUsage(output, usage, finishReason); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// promptMessage returns the prompt of an LLM input as a chat history message.
+func promptMessage(llmInput *LLMInput) *modelPB.Message {
+	contents := []*modelPB.MessageContent{{
+		Type:    "text",
+		Content: &modelPB.MessageContent_Text{Text: llmInput.Prompt},
+	}}
+
+	for _, image := range llmInput.PromptImages {
+		contents = append(contents, &modelPB.MessageContent{
+			Type:    "image_url",
+			Content: &modelPB.MessageContent_ImageUrl{ImageUrl: &modelPB.ImageContent{ImageUrl: image}},
+		})
+	}
+
+	return &modelPB.Message{Role: "user", Content: contents}
+}
+
+// tokenCounter counts the tokens of the texts sent to Instill Model. The
+// tokenizer of the models isn't known, so the count is estimated.
+var tokenCounter tokenizer.Counter = tokenizer.Estimator
+
+func messageTokens(m *modelPB.Message) int {
+	var tokens int
+	for _, c := range m.GetContent() {
+		tokens += tokenCounter.CountTokens(c.GetText())
+	}
+
+	return tokens
+}
+
+// fitContext trims the chat history of an LLM input so the request fits in
+// the maximum context of the input, if any. The oldest messages are dropped
+// or, if requested, summarized with trigger into the system message.
+func fitContext(input *structpb.Struct, llmInput *LLMInput, trigger func(*LLMInput) (*structpb.Struct, error)) error {
+	maxContext, ok := input.GetFields()["max_context_tokens"]
+	if !ok || len(llmInput.ChatHistory) == 0 {
+		return nil
+	}
+
+	fixed := tokenCounter.CountTokens(llmInput.Prompt)
+	if llmInput.SystemMessage != nil {
+		fixed += tokenCounter.CountTokens(*llmInput.SystemMessage)
+	}
+	if llmInput.MaxNewTokens != nil {
+		fixed += int(*llmInput.MaxNewTokens)
+	}
+
+	summarize := input.GetFields()["history_trimming"].GetStringValue() == util.HistoryTrimmingSummarize
+	if summarize {
+		fixed += tokenCounter.CountTokens(util.SummaryPrefix) + util.SummaryMaxTokens
+	}
+
+	history := make([]util.ContextMessage, len(llmInput.ChatHistory))
+	for i, m := range llmInput.ChatHistory {
+		history[i] = util.ContextMessage{
+			Tokens: messageTokens(m),
+			Pinned: m.GetRole() == "system",
+			// Instill Model requires the history to start with a user
+			// message.
+			CanStart: m.GetRole() == "user",
+		}
+	}
+
+	dropped, err := util.TrimHistory(history, fixed, int(maxContext.GetNumberValue()))
+	if err != nil || len(dropped) == 0 {
+		return err
+	}
+
+	isDropped := make(map[int]bool, len(dropped))
+	transcript := new(strings.Builder)
+	for _, i := range dropped {
+		isDropped[i] = true
+		for _, c := range llmInput.ChatHistory[i].GetContent() {
+			if c.GetText() != "" {
+				fmt.Fprintf(transcript, "%s: %s\n", llmInput.ChatHistory[i].GetRole(), c.GetText())
+			}
+		}
+	}
+
+	kept := make([]*modelPB.Message, 0, len(llmInput.ChatHistory)-len(dropped))
+	for i, m := range llmInput.ChatHistory {
+		if !isDropped[i] {
+			kept = append(kept, m)
+		}
+	}
+	llmInput.ChatHistory = kept
+
+	if !summarize {
+		return nil
+	}
+
+	maxTokens := int32(util.SummaryMaxTokens)
+	output, err := trigger(&LLMInput{
+		Prompt:       fmt.Sprintf("%s\n\n%s", util.SummaryPrompt, transcript),
+		MaxNewTokens: &maxTokens,
+	})
+	if err != nil {
+		return errmsg.AddMessage(err, "Couldn't summarize the chat history.")
+	}
+
+	systemMessage := util.SummaryPrefix + strings.TrimSpace(output.GetFields()["text"].GetStringValue())
+	if llmInput.SystemMessage != nil {
+		systemMessage = fmt.Sprintf("%s\n\n%s", *llmInput.SystemMessage, systemMessage)
+	}
+	llmInput.SystemMessage = &systemMessage
 
+	return nil
 }
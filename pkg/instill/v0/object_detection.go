@@ -1,7 +1,6 @@
 package instill
 
 import (
-	"context"
 	"fmt"
 
 	"google.golang.org/grpc/metadata"
@@ -48,7 +47,7 @@ func (e *Execution) executeObjectDetection(grpcClient modelPB.ModelPublicService
 		TaskInputs: taskInputs,
 	}
 
-	ctx := metadata.NewOutgoingContext(context.Background(), getRequestMetadata(e.Config))
+	ctx := metadata.NewOutgoingContext(e.Context(), getRequestMetadata(e.Config))
 	res, err := grpcClient.TriggerUserModel(ctx, &req)
 	if err != nil || res == nil {
 		return nil, err
@@ -65,15 +64,7 @@ func (e *Execution) executeObjectDetection(grpcClient modelPB.ModelPublicService
 		if objDetectionOutput == nil {
 			return nil, fmt.Errorf("invalid output: %v for model: %s", objDetectionOutput, modelName)
 		}
-		outputJSON, err := protojson.MarshalOptions{
-			UseProtoNames:   true,
-			EmitUnpopulated: true,
-		}.Marshal(objDetectionOutput)
-		if err != nil {
-			return nil, err
-		}
-		output := &structpb.Struct{}
-		err = protojson.Unmarshal(outputJSON, output)
+		output, err := base.ConvertToStructpb(detectionOutput(objDetectionOutput))
 		if err != nil {
 			return nil, err
 		}
@@ -1,13 +1,13 @@
 package instill
 
 import (
-	"context"
 	"fmt"
 
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/structpb"
 
+	"github.com/instill-ai/component/pkg/base"
 	modelPB "github.com/instill-ai/protogen-go/model/model/v1alpha"
 )
 
@@ -41,7 +41,7 @@ func (e *Execution) executeOCR(grpcClient modelPB.ModelPublicServiceClient, mode
 			Name:       modelName,
 			TaskInputs: []*modelPB.TaskInput{{Input: taskInput}},
 		}
-		ctx := metadata.NewOutgoingContext(context.Background(), getRequestMetadata(e.Config))
+		ctx := metadata.NewOutgoingContext(e.Context(), getRequestMetadata(e.Config))
 		res, err := grpcClient.TriggerUserModel(ctx, &req)
 		if err != nil || res == nil {
 			return nil, err
@@ -51,19 +51,11 @@ func (e *Execution) executeOCR(grpcClient modelPB.ModelPublicServiceClient, mode
 			return nil, fmt.Errorf("invalid output: %v for model: %s", taskOutputs, modelName)
 		}
 
-		ocrOutput := taskOutputs[0].GetOcr()
-		if ocrOutput == nil {
-			return nil, fmt.Errorf("invalid output: %v for model: %s", ocrOutput, modelName)
+		ocrOp := taskOutputs[0].GetOcr()
+		if ocrOp == nil {
+			return nil, fmt.Errorf("invalid output: %v for model: %s", ocrOp, modelName)
 		}
-		outputJSON, err := protojson.MarshalOptions{
-			UseProtoNames:   true,
-			EmitUnpopulated: true,
-		}.Marshal(ocrOutput)
-		if err != nil {
-			return nil, err
-		}
-		output := &structpb.Struct{}
-		err = protojson.Unmarshal(outputJSON, output)
+		output, err := base.ConvertToStructpb(ocrOutput(ocrOp))
 		if err != nil {
 			return nil, err
 		}
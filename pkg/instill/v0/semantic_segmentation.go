@@ -1,7 +1,6 @@
 package instill
 
 import (
-	"context"
 	"fmt"
 
 	"google.golang.org/grpc/metadata"
@@ -45,7 +44,7 @@ func (e *Execution) executeSemanticSegmentation(grpcClient modelPB.ModelPublicSe
 		Name:       modelName,
 		TaskInputs: taskInputs,
 	}
-	ctx := metadata.NewOutgoingContext(context.Background(), getRequestMetadata(e.Config))
+	ctx := metadata.NewOutgoingContext(e.Context(), getRequestMetadata(e.Config))
 	res, err := grpcClient.TriggerUserModel(ctx, &req)
 	if err != nil || res == nil {
 		return nil, err
@@ -61,15 +60,7 @@ func (e *Execution) executeSemanticSegmentation(grpcClient modelPB.ModelPublicSe
 		if semanticSegmentationOp == nil {
 			return nil, fmt.Errorf("invalid output: %v for model: %s", semanticSegmentationOp, modelName)
 		}
-		outputJSON, err := protojson.MarshalOptions{
-			UseProtoNames:   true,
-			EmitUnpopulated: true,
-		}.Marshal(semanticSegmentationOp)
-		if err != nil {
-			return nil, err
-		}
-		output := &structpb.Struct{}
-		err = protojson.Unmarshal(outputJSON, output)
+		output, err := base.ConvertToStructpb(semanticSegmentationOutput(semanticSegmentationOp))
 		if err != nil {
 			return nil, err
 		}
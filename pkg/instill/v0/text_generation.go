@@ -1,7 +1,6 @@
 package instill
 
 import (
-	"context"
 	"fmt"
 
 	"google.golang.org/grpc/metadata"
@@ -24,50 +23,66 @@ func (e *Execution) executeTextGeneration(grpcClient modelPB.ModelPublicServiceC
 
 	for _, input := range inputs {
 
-		llmInput := e.convertLLMInput(input)
-		taskInput := &modelPB.TaskInput_TextGeneration{
-			TextGeneration: &modelPB.TextGenerationInput{
-				Prompt:        llmInput.Prompt,
-				PromptImages:  llmInput.PromptImages,
-				ChatHistory:   llmInput.ChatHistory,
-				SystemMessage: llmInput.SystemMessage,
-				MaxNewTokens:  llmInput.MaxNewTokens,
-				Temperature:   llmInput.Temperature,
-				TopK:          llmInput.TopK,
-				Seed:          llmInput.Seed,
-				ExtraParams:   llmInput.ExtraParams,
-			},
-		}
-
-		// only support batch 1
-		req := modelPB.TriggerUserModelRequest{
-			Name:       modelName,
-			TaskInputs: []*modelPB.TaskInput{{Input: taskInput}},
-		}
-		ctx := metadata.NewOutgoingContext(context.Background(), getRequestMetadata(e.Config))
-		res, err := grpcClient.TriggerUserModel(ctx, &req)
-		if err != nil || res == nil {
+		llmInput, err := e.convertLLMInput(input)
+		if err != nil {
 			return nil, err
 		}
-		taskOutputs := res.GetTaskOutputs()
-		if len(taskOutputs) <= 0 {
-			return nil, fmt.Errorf("invalid output: %v for model: %s", taskOutputs, modelName)
-		}
 
-		textGenOutput := taskOutputs[0].GetTextGeneration()
-		if textGenOutput == nil {
-			return nil, fmt.Errorf("invalid output: %v for model: %s", textGenOutput, modelName)
+		trigger := func(llmInput *LLMInput) (*structpb.Struct, error) {
+			taskInput := &modelPB.TaskInput_TextGeneration{
+				TextGeneration: &modelPB.TextGenerationInput{
+					Prompt:        llmInput.Prompt,
+					PromptImages:  llmInput.PromptImages,
+					ChatHistory:   llmInput.ChatHistory,
+					SystemMessage: llmInput.SystemMessage,
+					MaxNewTokens:  llmInput.MaxNewTokens,
+					Temperature:   llmInput.Temperature,
+					TopK:          llmInput.TopK,
+					Seed:          llmInput.Seed,
+					ExtraParams:   llmInput.ExtraParams,
+				},
+			}
+
+			// only support batch 1
+			req := modelPB.TriggerUserModelRequest{
+				Name:       modelName,
+				TaskInputs: []*modelPB.TaskInput{{Input: taskInput}},
+			}
+			ctx := metadata.NewOutgoingContext(e.Context(), getRequestMetadata(e.Config))
+			res, err := grpcClient.TriggerUserModel(ctx, &req)
+			if err != nil || res == nil {
+				return nil, err
+			}
+			taskOutputs := res.GetTaskOutputs()
+			if len(taskOutputs) <= 0 {
+				return nil, fmt.Errorf("invalid output: %v for model: %s", taskOutputs, modelName)
+			}
+
+			textGenOutput := taskOutputs[0].GetTextGeneration()
+			if textGenOutput == nil {
+				return nil, fmt.Errorf("invalid output: %v for model: %s", textGenOutput, modelName)
+			}
+			outputJSON, err := protojson.MarshalOptions{
+				UseProtoNames:   true,
+				EmitUnpopulated: true,
+			}.Marshal(textGenOutput)
+			if err != nil {
+				return nil, err
+			}
+			output := &structpb.Struct{}
+			err = protojson.Unmarshal(outputJSON, output)
+			if err != nil {
+				return nil, err
+			}
+			return output, nil
 		}
-		outputJSON, err := protojson.MarshalOptions{
-			UseProtoNames:   true,
-			EmitUnpopulated: true,
-		}.Marshal(textGenOutput)
-		if err != nil {
+
+		if err := fitContext(input, llmInput, trigger); err != nil {
 			return nil, err
 		}
-		output := &structpb.Struct{}
-		err = protojson.Unmarshal(outputJSON, output)
-		if err != nil {
+
+		output, err := generateText(input, llmInput, trigger)
+		if err != nil || output == nil {
 			return nil, err
 		}
 		outputs = append(outputs, output)
@@ -1,7 +1,6 @@
 package instill
 
 import (
-	"context"
 	"fmt"
 
 	"google.golang.org/grpc/metadata"
@@ -56,7 +55,7 @@ func (e *Execution) executeTextToImage(grpcClient modelPB.ModelPublicServiceClie
 			Name:       modelName,
 			TaskInputs: []*modelPB.TaskInput{{Input: taskInput}},
 		}
-		ctx := metadata.NewOutgoingContext(context.Background(), getRequestMetadata(e.Config))
+		ctx := metadata.NewOutgoingContext(e.Context(), getRequestMetadata(e.Config))
 		res, err := grpcClient.TriggerUserModel(ctx, &req)
 		if err != nil || res == nil {
 			return nil, err
@@ -0,0 +1,109 @@
+package instill
+
+import (
+	"strconv"
+
+	"github.com/instill-ai/connector/pkg/util/vision"
+	modelPB "github.com/instill-ai/protogen-go/model/model/v1alpha"
+)
+
+// These functions convert the Instill Model vision task outputs into the
+// shared vision types.
+
+// toFloat64 converts the float32 values of the model outputs. Going through
+// the shortest decimal representation keeps e.g. 0.9 from becoming
+// 0.8999999761581421.
+func toFloat64(f float32) float64 {
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+	return v
+}
+
+func boundingBox(box *modelPB.BoundingBox) vision.BoundingBox {
+	return vision.BoundingBox{
+		Top:    toFloat64(box.GetTop()),
+		Left:   toFloat64(box.GetLeft()),
+		Width:  toFloat64(box.GetWidth()),
+		Height: toFloat64(box.GetHeight()),
+	}
+}
+
+func classificationOutput(out *modelPB.ClassificationOutput) vision.Classification {
+	return vision.Classification{
+		Category: out.GetCategory(),
+		Score:    toFloat64(out.GetScore()),
+	}
+}
+
+func detectionOutput(out *modelPB.DetectionOutput) vision.Detection {
+	objects := make([]vision.DetectionObject, len(out.GetObjects()))
+	for i, o := range out.GetObjects() {
+		objects[i] = vision.DetectionObject{
+			BoundingBox: boundingBox(o.GetBoundingBox()),
+			Category:    o.GetCategory(),
+			Score:       toFloat64(o.GetScore()),
+		}
+	}
+
+	return vision.Detection{Objects: objects}
+}
+
+func keypointOutput(out *modelPB.KeypointOutput) vision.Keypoints {
+	objects := make([]vision.KeypointObject, len(out.GetObjects()))
+	for i, o := range out.GetObjects() {
+		keypoints := make([]vision.Keypoint, len(o.GetKeypoints()))
+		for j, k := range o.GetKeypoints() {
+			keypoints[j] = vision.Keypoint{
+				X: toFloat64(k.GetX()),
+				Y: toFloat64(k.GetY()),
+				V: toFloat64(k.GetV()),
+			}
+		}
+
+		objects[i] = vision.KeypointObject{
+			Keypoints:   keypoints,
+			Score:       toFloat64(o.GetScore()),
+			BoundingBox: boundingBox(o.GetBoundingBox()),
+		}
+	}
+
+	return vision.Keypoints{Objects: objects}
+}
+
+func ocrOutput(out *modelPB.OcrOutput) vision.OCR {
+	objects := make([]vision.OCRObject, len(out.GetObjects()))
+	for i, o := range out.GetObjects() {
+		objects[i] = vision.OCRObject{
+			BoundingBox: boundingBox(o.GetBoundingBox()),
+			Text:        o.GetText(),
+			Score:       toFloat64(o.GetScore()),
+		}
+	}
+
+	return vision.OCR{Objects: objects}
+}
+
+func instanceSegmentationOutput(out *modelPB.InstanceSegmentationOutput) vision.InstanceSegmentation {
+	objects := make([]vision.InstanceSegmentationObject, len(out.GetObjects()))
+	for i, o := range out.GetObjects() {
+		objects[i] = vision.InstanceSegmentationObject{
+			RLE:         o.GetRle(),
+			BoundingBox: boundingBox(o.GetBoundingBox()),
+			Category:    o.GetCategory(),
+			Score:       toFloat64(o.GetScore()),
+		}
+	}
+
+	return vision.InstanceSegmentation{Objects: objects}
+}
+
+func semanticSegmentationOutput(out *modelPB.SemanticSegmentationOutput) vision.SemanticSegmentation {
+	stuffs := make([]vision.SemanticSegmentationStuff, len(out.GetStuffs()))
+	for i, s := range out.GetStuffs() {
+		stuffs[i] = vision.SemanticSegmentationStuff{
+			RLE:      s.GetRle(),
+			Category: s.GetCategory(),
+		}
+	}
+
+	return vision.SemanticSegmentation{Stuffs: stuffs}
+}
@@ -1,7 +1,6 @@
 package instill
 
 import (
-	"context"
 	"fmt"
 
 	"google.golang.org/grpc/metadata"
@@ -24,7 +23,10 @@ func (e *Execution) executeVisualQuestionAnswering(grpcClient modelPB.ModelPubli
 
 	for _, input := range inputs {
 
-		llmInput := e.convertLLMInput(input)
+		llmInput, err := e.convertLLMInput(input)
+		if err != nil {
+			return nil, err
+		}
 		taskInput := &modelPB.TaskInput_VisualQuestionAnswering{
 			VisualQuestionAnswering: &modelPB.VisualQuestionAnsweringInput{
 				Prompt:        llmInput.Prompt,
@@ -44,7 +46,7 @@ func (e *Execution) executeVisualQuestionAnswering(grpcClient modelPB.ModelPubli
 			Name:       modelName,
 			TaskInputs: []*modelPB.TaskInput{{Input: taskInput}},
 		}
-		ctx := metadata.NewOutgoingContext(context.Background(), getRequestMetadata(e.Config))
+		ctx := metadata.NewOutgoingContext(e.Context(), getRequestMetadata(e.Config))
 		res, err := grpcClient.TriggerUserModel(ctx, &req)
 		if err != nil || res == nil {
 			return nil, err
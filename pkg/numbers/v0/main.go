@@ -2,6 +2,7 @@ package numbers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -18,6 +19,7 @@ import (
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
 
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
 )
@@ -40,6 +42,7 @@ type Connector struct {
 
 type Execution struct {
 	base.Execution
+	util.ExecutionContext
 }
 
 type CommitCustomLicense struct {
@@ -128,7 +131,7 @@ func getToken(config *structpb.Struct) string {
 	return fmt.Sprintf("token %s", config.GetFields()["capture_token"].GetStringValue())
 }
 
-func (e *Execution) registerAsset(data []byte, reg Register) (string, error) {
+func (e *Execution) registerAsset(ctx context.Context, data []byte, reg Register) (string, error) {
 
 	var b bytes.Buffer
 
@@ -162,7 +165,7 @@ func (e *Execution) registerAsset(data []byte, reg Register) (string, error) {
 
 	w.Close()
 
-	req, err := http.NewRequest("POST", urlRegisterAsset, &b)
+	req, err := http.NewRequestWithContext(ctx, "POST", urlRegisterAsset, &b)
 	if err != nil {
 		return "", err
 	}
@@ -252,7 +255,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 				Headline:        inputStruct.Headline,
 				NITCommitCustom: &commitCustom,
 			}
-			assetCid, err := e.registerAsset(imageBytes, reg)
+			assetCid, err := e.registerAsset(e.Context(), imageBytes, reg)
 			if err != nil {
 				return nil, err
 			}
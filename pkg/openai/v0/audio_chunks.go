@@ -0,0 +1,238 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/gabriel-vasile/mimetype"
+
+	"github.com/instill-ai/x/errmsg"
+)
+
+// maxAudioSize is the maximum size of the audio files OpenAI accepts.
+const maxAudioSize = 25 << 20
+
+// splitAudio splits an audio file into chunks that don't exceed maxSize.
+// Only formats that can be split without decoding the audio are supported.
+func splitAudio(audio []byte, maxSize int) ([][]byte, error) {
+	if len(audio) <= maxSize {
+		return [][]byte{audio}, nil
+	}
+
+	switch mimetype.Detect(audio).String() {
+	case "audio/wav":
+		return splitWAV(audio, maxSize)
+	case "audio/mpeg":
+		return splitMP3(audio, maxSize)
+	}
+
+	return nil, errmsg.AddMessage(
+		fmt.Errorf("audio too large: %d bytes", len(audio)),
+		fmt.Sprintf(
+			"The audio size (%.1f MB) exceeds the %d MB limit. Only WAV and MP3 files can be split automatically, so compress the audio or convert it to one of these formats.",
+			float64(len(audio))/(1<<20), maxSize>>20,
+		),
+	)
+}
+
+// splitWAV splits a PCM WAV file on sample frame boundaries. Each chunk is a
+// WAV file with the format of the original one.
+func splitWAV(audio []byte, maxSize int) ([][]byte, error) {
+	invalid := func(reason string) error {
+		return errmsg.AddMessage(fmt.Errorf("invalid WAV file: %s", reason), "The WAV file can't be split because it is malformed.")
+	}
+
+	if len(audio) < 12 || string(audio[:4]) != "RIFF" || string(audio[8:12]) != "WAVE" {
+		return nil, invalid("missing RIFF header")
+	}
+
+	var fmtChunk, data []byte
+	for pos := 12; pos+8 <= len(audio) && data == nil; {
+		id := string(audio[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(audio[pos+4 : pos+8]))
+		end := pos + 8 + size
+		// Streamed files might not have the final data size.
+		if end > len(audio) || end < pos {
+			end = len(audio)
+		}
+
+		switch id {
+		case "fmt ":
+			fmtChunk = audio[pos:end]
+		case "data":
+			data = audio[pos+8 : end]
+		}
+
+		// Chunks are word-aligned.
+		pos = end + size%2
+	}
+
+	if len(fmtChunk) < 8+16 || data == nil {
+		return nil, invalid("missing format or data chunk")
+	}
+
+	blockAlign := int(binary.LittleEndian.Uint16(fmtChunk[8+12:]))
+	if blockAlign == 0 {
+		return nil, invalid("zero block alignment")
+	}
+
+	headerSize := 12 + len(fmtChunk) + 8
+	chunkDataSize := (maxSize - headerSize) / blockAlign * blockAlign
+	if chunkDataSize <= 0 {
+		return nil, invalid("frames exceed the size limit")
+	}
+
+	var chunks [][]byte
+	for start := 0; start < len(data); start += chunkDataSize {
+		frames := data[start:min(start+chunkDataSize, len(data))]
+
+		chunk := bytes.NewBuffer(make([]byte, 0, headerSize+len(frames)))
+		chunk.WriteString("RIFF")
+		_ = binary.Write(chunk, binary.LittleEndian, uint32(headerSize-8+len(frames)))
+		chunk.WriteString("WAVE")
+		chunk.Write(fmtChunk)
+		chunk.WriteString("data")
+		_ = binary.Write(chunk, binary.LittleEndian, uint32(len(frames)))
+		chunk.Write(frames)
+
+		chunks = append(chunks, chunk.Bytes())
+	}
+
+	return chunks, nil
+}
+
+var (
+	// mp3Bitrates are the bitrates, in kbit/s, of the MPEG audio frames by
+	// version (MPEG-1, MPEG-2 and 2.5), layer (I, II, III) and index.
+	mp3Bitrates = [2][3][15]int{
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+
+	// mp3SampleRates are the MPEG-1 sample rates by index. MPEG-2 and 2.5
+	// halve and quarter them.
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// mp3FrameSize parses the MPEG audio frame header at the start of b and
+// returns the frame length. It returns 0 if b doesn't start with a valid
+// header. Free format frames, whose length isn't in the header, aren't
+// supported.
+func mp3FrameSize(b []byte) int {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return 0
+	}
+
+	version := b[1] >> 3 & 3    // 0: MPEG-2.5, 1: reserved, 2: MPEG-2, 3: MPEG-1
+	layer := 3 - int(b[1]>>1&3) // 0: I, 1: II, 2: III, 3: reserved
+	bitrateIndex := b[2] >> 4
+	sampleRateIndex := b[2] >> 2 & 3
+	padding := int(b[2] >> 1 & 1)
+	if version == 1 || layer == 3 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return 0
+	}
+
+	v, sampleRate := 0, mp3SampleRates[sampleRateIndex]
+	switch version {
+	case 2:
+		v, sampleRate = 1, sampleRate/2
+	case 0:
+		v, sampleRate = 1, sampleRate/4
+	}
+
+	bitrate := mp3Bitrates[v][layer][bitrateIndex] * 1000
+	switch {
+	case layer == 0:
+		return (12*bitrate/sampleRate + padding) * 4
+	case layer == 2 && v == 1:
+		return 72*bitrate/sampleRate + padding
+	default:
+		return 144*bitrate/sampleRate + padding
+	}
+}
+
+// id3v2Size returns the size of the ID3v2 tag at the start of an MP3 file, or
+// 0 if there's none.
+func id3v2Size(audio []byte) int {
+	if len(audio) < 10 || string(audio[:3]) != "ID3" {
+		return 0
+	}
+
+	// The size is a 28-bit synchsafe integer that excludes the header and
+	// the optional footer.
+	size := 0
+	for _, b := range audio[6:10] {
+		size = size<<7 | int(b&0x7F)
+	}
+	size += 10
+	if audio[5]&0x10 != 0 {
+		size += 10
+	}
+
+	return min(size, len(audio))
+}
+
+// firstMP3Frame returns the position of the first MPEG audio frame from pos.
+// As the sync bits can appear in other data, a header only counts if it's
+// followed by another header or by the end of the file.
+func firstMP3Frame(audio []byte, pos int) int {
+	for ; pos < len(audio); pos++ {
+		size := mp3FrameSize(audio[pos:])
+		if size > 0 && (pos+size == len(audio) || mp3FrameSize(audio[pos+size:]) > 0) {
+			return pos
+		}
+	}
+
+	return len(audio)
+}
+
+// splitMP3 splits an MP3 file on frame boundaries, walking the frames with the
+// length in their header. MPEG audio frames are self-contained, so the chunks
+// can be decoded independently. The leading ID3v2 tag stays in the first
+// chunk and the trailing data (e.g. an ID3v1 tag) in the last one.
+func splitMP3(audio []byte, maxSize int) ([][]byte, error) {
+	var chunks [][]byte
+	cut := func(start, end int) error {
+		if end-start > maxSize {
+			return errmsg.AddMessage(
+				fmt.Errorf("no MP3 frame boundary in chunk starting at byte %d", start),
+				"The MP3 file can't be split because it is malformed.",
+			)
+		}
+
+		chunks = append(chunks, audio[start:end])
+		return nil
+	}
+
+	start, first := 0, firstMP3Frame(audio, id3v2Size(audio))
+	for pos := first; pos < len(audio); {
+		size := mp3FrameSize(audio[pos:])
+		if size == 0 || pos+size > len(audio) {
+			break
+		}
+
+		// Each chunk has at least one frame.
+		if pos+size-start > maxSize && pos > max(start, first) {
+			if err := cut(start, pos); err != nil {
+				return nil, err
+			}
+			start = pos
+		}
+		pos += size
+	}
+
+	if err := cut(start, len(audio)); err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
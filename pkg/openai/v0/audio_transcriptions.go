@@ -2,34 +2,86 @@ package openai
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"mime/multipart"
+	"strings"
 
+	"github.com/instill-ai/component/pkg/base"
 	"github.com/instill-ai/connector/pkg/util"
+	"github.com/instill-ai/connector/pkg/util/httpclient"
+	"github.com/instill-ai/x/errmsg"
 )
 
 const (
 	transcriptionsPath = "/v1/audio/transcriptions"
+	translationsPath   = "/v1/audio/translations"
+
+	// The response formats of the audio requests. The upstream schema only
+	// lists them in the transcription request, so openai.json overrides the
+	// translation request with the same enums as the transcription one.
+	audioFormatJSON        = "json"
+	audioFormatText        = "text"
+	audioFormatSRT         = "srt"
+	audioFormatVerboseJSON = "verbose_json"
+	audioFormatVTT         = "vtt"
 )
 
+// AudioTranscriptionInput holds the input of the speech recognition and
+// speech translation tasks. Translations don't take a language or timestamp
+// granularities.
 type AudioTranscriptionInput struct {
-	Audio       string   `json:"audio"`
-	Model       string   `json:"model"`
-	Prompt      *string  `json:"prompt,omitempty"`
-	Temperature *float64 `json:"temperature,omitempty"`
-	Language    *string  `json:"language,omitempty"`
+	Audio                  string   `json:"audio"`
+	Model                  string   `json:"model"`
+	Prompt                 *string  `json:"prompt,omitempty"`
+	Temperature            *float64 `json:"temperature,omitempty"`
+	Language               *string  `json:"language,omitempty"`
+	ResponseFormat         string   `json:"response_format"`
+	TimestampGranularities []string `json:"timestamp_granularities"`
 }
 
 type AudioTranscriptionReq struct {
-	File        []byte   `json:"file"`
-	Model       string   `json:"model"`
-	Prompt      *string  `json:"prompt,omitempty"`
-	Language    *string  `json:"language,omitempty"`
-	Temperature *float64 `json:"temperature,omitempty"`
+	File                   []byte   `json:"file"`
+	Model                  string   `json:"model"`
+	Prompt                 *string  `json:"prompt,omitempty"`
+	Language               *string  `json:"language,omitempty"`
+	Temperature            *float64 `json:"temperature,omitempty"`
+	ResponseFormat         string   `json:"response_format,omitempty"`
+	TimestampGranularities []string `json:"timestamp_granularities,omitempty"`
 }
 
+// AudioTranscriptionResp is the response of the transcription and translation
+// endpoints in the json and verbose_json formats. Only the latter contains
+// the language, duration and timings.
 type AudioTranscriptionResp struct {
-	Text string `json:"text"`
+	Text     string                 `json:"text"`
+	Language string                 `json:"language"`
+	Duration float64                `json:"duration"`
+	Segments []TranscriptionSegment `json:"segments"`
+	Words    []TranscriptionWord    `json:"words"`
+}
+
+type TranscriptionSegment struct {
+	ID    int     `json:"id"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+type TranscriptionWord struct {
+	Word  string  `json:"word"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+type AudioTranscriptionOutput struct {
+	Text     string                 `json:"text"`
+	Language string                 `json:"language,omitempty"`
+	Duration float64                `json:"duration,omitempty"`
+	Segments []TranscriptionSegment `json:"segments,omitempty"`
+	Words    []TranscriptionWord    `json:"words,omitempty"`
 }
 
 func getBytes(req AudioTranscriptionReq) (*bytes.Reader, string, error) {
@@ -49,6 +101,183 @@ func getBytes(req AudioTranscriptionReq) (*bytes.Reader, string, error) {
 	if req.Temperature != nil {
 		util.WriteField(writer, "temperature", fmt.Sprintf("%f", *req.Temperature))
 	}
+	util.WriteField(writer, "response_format", req.ResponseFormat)
+	for _, g := range req.TimestampGranularities {
+		util.WriteField(writer, "timestamp_granularities[]", g)
+	}
 	writer.Close()
 	return bytes.NewReader(data.Bytes()), writer.FormDataContentType(), nil
 }
+
+func isJSONAudioFormat(format string) bool {
+	return format == audioFormatJSON || format == audioFormatVerboseJSON
+}
+
+// postAudio sends an audio file to the transcription or translation
+// endpoint. The text formats (text, srt and vtt) are returned as the
+// transcription text.
+func postAudio(ctx context.Context, client *httpclient.Client, path string, req AudioTranscriptionReq) (AudioTranscriptionResp, error) {
+	data, ct, err := getBytes(req)
+	if err != nil {
+		return AudioTranscriptionResp{}, err
+	}
+
+	resp, err := forModel(client.R().SetContext(ctx), req.Model).SetBody(data).SetHeader("Content-Type", ct).Post(path)
+	if err != nil {
+		return AudioTranscriptionResp{}, err
+	}
+
+	if req.ResponseFormat != "" && !isJSONAudioFormat(req.ResponseFormat) {
+		return AudioTranscriptionResp{Text: resp.String()}, nil
+	}
+
+	out := AudioTranscriptionResp{}
+	if err := json.Unmarshal(resp.Body(), &out); err != nil {
+		return AudioTranscriptionResp{}, fmt.Errorf("parsing audio response: %w", err)
+	}
+
+	return out, nil
+}
+
+// audioResponseFormat returns the response format of an audio request. The
+// timestamp granularities are only available in the verbose_json format,
+// which is the default when they are requested.
+func audioResponseFormat(in AudioTranscriptionInput) (string, error) {
+	if len(in.TimestampGranularities) == 0 {
+		if in.ResponseFormat == "" {
+			return audioFormatJSON, nil
+		}
+
+		return in.ResponseFormat, nil
+	}
+
+	if in.ResponseFormat != "" && in.ResponseFormat != audioFormatVerboseJSON {
+		return "", errmsg.AddMessage(
+			fmt.Errorf("timestamp granularities with %s format", in.ResponseFormat),
+			fmt.Sprintf("Timestamp granularities require the %s response format.", audioFormatVerboseJSON),
+		)
+	}
+
+	return audioFormatVerboseJSON, nil
+}
+
+// transcribeAudio transcribes or translates, depending on the path, an audio
+// file. Audio files that exceed maxSize are split into chunks, whose
+// transcriptions are stitched together.
+func transcribeAudio(ctx context.Context, client *httpclient.Client, path string, in AudioTranscriptionInput, maxSize int) (AudioTranscriptionOutput, error) {
+	audio, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(in.Audio))
+	if err != nil {
+		return AudioTranscriptionOutput{}, err
+	}
+
+	format, err := audioResponseFormat(in)
+	if err != nil {
+		return AudioTranscriptionOutput{}, err
+	}
+
+	chunks, err := splitAudio(audio, maxSize)
+	if err != nil {
+		return AudioTranscriptionOutput{}, err
+	}
+
+	req := AudioTranscriptionReq{
+		Model:                  in.Model,
+		Prompt:                 in.Prompt,
+		Language:               in.Language,
+		Temperature:            in.Temperature,
+		ResponseFormat:         format,
+		TimestampGranularities: in.TimestampGranularities,
+	}
+
+	if len(chunks) == 1 {
+		req.File = chunks[0]
+		resp, err := postAudio(ctx, client, path, req)
+		if err != nil {
+			return AudioTranscriptionOutput{}, err
+		}
+
+		if format != audioFormatVerboseJSON {
+			return AudioTranscriptionOutput{Text: resp.Text}, nil
+		}
+
+		return AudioTranscriptionOutput(resp), nil
+	}
+
+	// The timings of each chunk are needed to stitch the transcriptions, so
+	// the chunks are always transcribed in the verbose_json format and the
+	// requested format is rendered afterwards.
+	req.ResponseFormat = audioFormatVerboseJSON
+
+	stitched := AudioTranscriptionResp{}
+	texts := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		req.File = chunk
+		resp, err := postAudio(ctx, client, path, req)
+		if err != nil {
+			return AudioTranscriptionOutput{}, errmsg.AddMessage(
+				fmt.Errorf("processing audio chunk %d: %w", i, err),
+				fmt.Sprintf("Couldn't process the audio chunk %d of %d.", i+1, len(chunks)),
+			)
+		}
+
+		offset := stitched.Duration
+		for _, s := range resp.Segments {
+			s.ID = len(stitched.Segments)
+			s.Start += offset
+			s.End += offset
+			stitched.Segments = append(stitched.Segments, s)
+		}
+		for _, w := range resp.Words {
+			w.Start += offset
+			w.End += offset
+			stitched.Words = append(stitched.Words, w)
+		}
+
+		if stitched.Language == "" {
+			stitched.Language = resp.Language
+		}
+		stitched.Duration += resp.Duration
+		texts = append(texts, strings.TrimSpace(resp.Text))
+	}
+	stitched.Text = strings.Join(texts, " ")
+
+	switch format {
+	case audioFormatVerboseJSON:
+		return AudioTranscriptionOutput(stitched), nil
+	case audioFormatSRT:
+		return AudioTranscriptionOutput{Text: subtitles(stitched.Segments, false)}, nil
+	case audioFormatVTT:
+		return AudioTranscriptionOutput{Text: subtitles(stitched.Segments, true)}, nil
+	}
+
+	return AudioTranscriptionOutput{Text: stitched.Text}, nil
+}
+
+// subtitles renders the segments of a transcription as an SRT or, if vtt is
+// true, a WebVTT file.
+func subtitles(segments []TranscriptionSegment, vtt bool) string {
+	sb := new(strings.Builder)
+	if vtt {
+		sb.WriteString("WEBVTT\n\n")
+	}
+
+	for i, s := range segments {
+		if !vtt {
+			fmt.Fprintf(sb, "%d\n", i+1)
+		}
+
+		fmt.Fprintf(sb, "%s --> %s\n%s\n\n", subtitleTime(s.Start, vtt), subtitleTime(s.End, vtt), strings.TrimSpace(s.Text))
+	}
+
+	return sb.String()
+}
+
+func subtitleTime(seconds float64, vtt bool) string {
+	ms := int64(seconds*1000 + 0.5)
+	sep := ","
+	if vtt {
+		sep = "."
+	}
+
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
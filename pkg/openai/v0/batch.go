@@ -0,0 +1,484 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/instill-ai/connector/pkg/util"
+	"github.com/instill-ai/connector/pkg/util/httpclient"
+	"github.com/instill-ai/connector/pkg/util/tokenizer"
+	"github.com/instill-ai/x/errmsg"
+)
+
+const (
+	filesPath   = "/v1/files"
+	batchesPath = "/v1/batches"
+
+	batchPurpose          = "batch"
+	batchCompletionWindow = "24h"
+	batchCustomIDPrefix   = "request-"
+
+	// defaultBatchResultsLimit is the number of results returned by default
+	// in a page of batch results.
+	defaultBatchResultsLimit = 100
+	// maxBatchLineSize is the maximum size of a line of the output or error
+	// files of a batch, i.e. of the response to a single request.
+	maxBatchLineSize = 16 * 1024 * 1024
+
+	batchStatusCompleted = "completed"
+	batchStatusFailed    = "failed"
+	batchStatusExpired   = "expired"
+	batchStatusCancelled = "cancelled"
+)
+
+// batchPollInterval is the time between two status checks of a batch that
+// is being waited for. It is a variable so tests can shorten it.
+var batchPollInterval = 10 * time.Second
+
+type BatchSubmitInput struct {
+	Endpoint string            `json:"endpoint"`
+	Requests []json.RawMessage `json:"requests"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+type BatchSubmitOutput struct {
+	BatchID     string `json:"batch_id"`
+	InputFileID string `json:"input_file_id"`
+	Status      string `json:"status"`
+}
+
+type BatchStatusInput struct {
+	BatchID string `json:"batch_id"`
+}
+
+type BatchStatusOutput struct {
+	BatchID       string             `json:"batch_id"`
+	Status        string             `json:"status"`
+	RequestCounts BatchRequestCounts `json:"request_counts"`
+	OutputFileID  string             `json:"output_file_id,omitempty"`
+	ErrorFileID   string             `json:"error_file_id,omitempty"`
+}
+
+type BatchResultsInput struct {
+	BatchID string `json:"batch_id"`
+	// WaitTimeout is the number of seconds to wait for the batch to finish.
+	WaitTimeout int `json:"wait_timeout"`
+	// Offset and Limit select the page of results to return.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+type BatchResultsOutput struct {
+	BatchID string        `json:"batch_id"`
+	Status  string        `json:"status"`
+	Results []BatchResult `json:"results"`
+	// Total is the number of requests in the batch.
+	Total int `json:"total"`
+	// NextOffset is the offset of the next page of results, if any.
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+// BatchResult holds the output of a request in a batch, in the format of the
+// synchronous task for its endpoint, or the error that made it fail.
+type BatchResult struct {
+	CustomID string           `json:"custom_id"`
+	Output   any              `json:"output,omitempty"`
+	Error    *util.InputError `json:"error,omitempty"`
+}
+
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type BatchReq struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+type BatchResp struct {
+	ID            string             `json:"id"`
+	Endpoint      string             `json:"endpoint"`
+	Status        string             `json:"status"`
+	InputFileID   string             `json:"input_file_id"`
+	OutputFileID  string             `json:"output_file_id"`
+	ErrorFileID   string             `json:"error_file_id"`
+	RequestCounts BatchRequestCounts `json:"request_counts"`
+}
+
+type FileResp struct {
+	ID string `json:"id"`
+}
+
+// BatchLine is a line of the JSONL input file of a batch.
+type BatchLine struct {
+	CustomID string `json:"custom_id"`
+	Method   string `json:"method"`
+	URL      string `json:"url"`
+	Body     any    `json:"body"`
+}
+
+// BatchResultLine is a line of the JSONL output or error files of a batch.
+type BatchResultLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func isTerminalBatchStatus(status string) bool {
+	switch status {
+	case batchStatusCompleted, batchStatusFailed, batchStatusExpired, batchStatusCancelled:
+		return true
+	}
+
+	return false
+}
+
+// batchRequestBody builds the body of a batch request from the input of the
+// synchronous task for the same endpoint.
+func batchRequestBody(endpoint string, request json.RawMessage) (any, error) {
+	switch endpoint {
+	case completionsPath:
+		in := TextCompletionInput{}
+		if err := json.Unmarshal(request, &in); err != nil {
+			return nil, err
+		}
+
+		return textCompletionReq(in)
+	case embeddingsPath:
+		in := TextEmbeddingsInput{}
+		if err := json.Unmarshal(request, &in); err != nil {
+			return nil, err
+		}
+
+		return TextEmbeddingsReq{
+			Model:          in.Model,
+			Input:          in.texts(),
+			Dimensions:     in.Dimensions,
+			EncodingFormat: in.EncodingFormat,
+		}, nil
+	}
+
+	return nil, errmsg.AddMessage(
+		fmt.Errorf("unsupported batch endpoint: %s", endpoint),
+		fmt.Sprintf("Batches aren't supported for the %s endpoint.", endpoint),
+	)
+}
+
+// batchInputFile builds the JSONL input file of a batch. Requests are
+// identified by their position in the input.
+func batchInputFile(in BatchSubmitInput) ([]byte, error) {
+	if len(in.Requests) == 0 {
+		return nil, errmsg.AddMessage(fmt.Errorf("empty batch"), "A batch must contain at least one request.")
+	}
+
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for i, request := range in.Requests {
+		body, err := batchRequestBody(in.Endpoint, request)
+		if err != nil {
+			return nil, errmsg.AddMessage(
+				fmt.Errorf("building request %d: %w", i, err),
+				fmt.Sprintf("Request %d is invalid.", i),
+			)
+		}
+
+		line := BatchLine{
+			CustomID: batchCustomIDPrefix + strconv.Itoa(i),
+			Method:   "POST",
+			URL:      in.Endpoint,
+			Body:     body,
+		}
+		if err := enc.Encode(line); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func uploadBatchFile(ctx context.Context, client *httpclient.Client, file []byte) (string, error) {
+	data := &bytes.Buffer{}
+	writer := multipart.NewWriter(data)
+	util.WriteField(writer, "purpose", batchPurpose)
+
+	// The file extension must be .jsonl, so it can't be inferred from the
+	// content as in util.WriteFile.
+	part, err := writer.CreateFormFile("file", "batch.jsonl")
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(file); err != nil {
+		return "", err
+	}
+	writer.Close()
+
+	resp := FileResp{}
+	req := client.R().SetContext(ctx).SetBody(data.Bytes()).SetResult(&resp).
+		SetHeader("Content-Type", writer.FormDataContentType())
+	if _, err := req.Post(filesPath); err != nil {
+		return "", err
+	}
+
+	return resp.ID, nil
+}
+
+func batchSubmit(ctx context.Context, client *httpclient.Client, in BatchSubmitInput) (BatchSubmitOutput, error) {
+	file, err := batchInputFile(in)
+	if err != nil {
+		return BatchSubmitOutput{}, err
+	}
+
+	fileID, err := uploadBatchFile(ctx, client, file)
+	if err != nil {
+		return BatchSubmitOutput{}, err
+	}
+
+	resp := BatchResp{}
+	req := client.R().SetContext(ctx).SetResult(&resp).SetBody(BatchReq{
+		InputFileID:      fileID,
+		Endpoint:         in.Endpoint,
+		CompletionWindow: batchCompletionWindow,
+		Metadata:         in.Metadata,
+	})
+	if _, err := req.Post(batchesPath); err != nil {
+		return BatchSubmitOutput{}, err
+	}
+
+	return BatchSubmitOutput{
+		BatchID:     resp.ID,
+		InputFileID: resp.InputFileID,
+		Status:      resp.Status,
+	}, nil
+}
+
+func getBatch(ctx context.Context, client *httpclient.Client, batchID string) (BatchResp, error) {
+	resp := BatchResp{}
+	req := client.R().SetContext(ctx).SetResult(&resp).SetPathParam("batch_id", batchID)
+	if _, err := req.Get(batchesPath + "/{batch_id}"); err != nil {
+		return BatchResp{}, err
+	}
+
+	return resp, nil
+}
+
+func batchStatus(ctx context.Context, client *httpclient.Client, in BatchStatusInput) (BatchStatusOutput, error) {
+	resp, err := getBatch(ctx, client, in.BatchID)
+	if err != nil {
+		return BatchStatusOutput{}, err
+	}
+
+	return BatchStatusOutput{
+		BatchID:       resp.ID,
+		Status:        resp.Status,
+		RequestCounts: resp.RequestCounts,
+		OutputFileID:  resp.OutputFileID,
+		ErrorFileID:   resp.ErrorFileID,
+	}, nil
+}
+
+// waitForBatch polls the status of a batch until it finishes or the timeout
+// expires.
+func waitForBatch(ctx context.Context, client *httpclient.Client, batchID string, timeout time.Duration) (BatchResp, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := getBatch(ctx, client, batchID)
+		if err != nil {
+			return BatchResp{}, err
+		}
+
+		if isTerminalBatchStatus(resp.Status) {
+			return resp, nil
+		}
+
+		wait := min(batchPollInterval, time.Until(deadline))
+		if wait <= 0 {
+			return BatchResp{}, errmsg.AddMessage(
+				fmt.Errorf("batch %s not finished: %s", batchID, resp.Status),
+				fmt.Sprintf("The batch is still %s. Try again later or increase the wait timeout.", strings.ReplaceAll(resp.Status, "_", " ")),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return BatchResp{}, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// scanBatchFile reads the output or error file of a batch line by line, so
+// large batches aren't held in memory, and calls onLine with each line and
+// the index of its request.
+func scanBatchFile(ctx context.Context, client *httpclient.Client, fileID string, onLine func(i int, line BatchResultLine)) error {
+	if fileID == "" {
+		return nil
+	}
+
+	req := client.R().SetContext(ctx).SetPathParam("file_id", fileID).SetDoNotParseResponse(true)
+	resp, err := req.Get(filesPath + "/{file_id}/content")
+	if err != nil {
+		return err
+	}
+
+	rawBody := resp.RawBody()
+	defer rawBody.Close()
+
+	if resp.IsError() {
+		return client.RawResponseError(resp)
+	}
+
+	scanner := bufio.NewScanner(rawBody)
+	// Completions can exceed the default token size of the scanner.
+	scanner.Buffer(nil, maxBatchLineSize)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var line BatchResultLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("parsing batch file %s: %w", fileID, err)
+		}
+
+		i, err := strconv.Atoi(strings.TrimPrefix(line.CustomID, batchCustomIDPrefix))
+		if err != nil || i < 0 {
+			return fmt.Errorf("unexpected custom ID in batch results: %s", line.CustomID)
+		}
+
+		onLine(i, line)
+	}
+
+	return scanner.Err()
+}
+
+// batchResultOutput converts the response to a batch request into the output
+// of the synchronous task for its endpoint. As the request input isn't
+// available, embeddings are always returned as a list.
+func batchResultOutput(endpoint string, body json.RawMessage) (any, error) {
+	switch endpoint {
+	case completionsPath:
+		resp := TextCompletionResp{}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+
+		return textCompletionOutput(tokenizer.Estimator, resp, TextCompletionReq{})
+	case embeddingsPath:
+		resp := TextEmbeddingsResp{}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+
+		return TextEmbeddingsOutput{Embeddings: sortedEmbeddings(resp.Data)}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported batch endpoint: %s", endpoint)
+}
+
+func batchResult(endpoint string, line BatchResultLine) BatchResult {
+	result := BatchResult{CustomID: line.CustomID}
+
+	var err error
+	switch {
+	case line.Error != nil:
+		err = errmsg.AddMessage(fmt.Errorf("batch request error: %s", line.Error.Code), line.Error.Message)
+	case line.Response == nil:
+		err = fmt.Errorf("batch request without response")
+	case line.Response.StatusCode >= 400:
+		body := errBody{}
+		_ = json.Unmarshal(line.Response.Body, &body)
+		err = errmsg.AddMessage(&httpclient.ResponseError{StatusCode: line.Response.StatusCode}, body.Message())
+	default:
+		result.Output, err = batchResultOutput(endpoint, line.Response.Body)
+	}
+
+	if err != nil {
+		inputErr := util.NewInputError(err)
+		result.Error = &inputErr
+	}
+
+	return result
+}
+
+// batchResults waits for a batch to finish and returns a page of the results
+// of its requests, in the order they were submitted. Requests that weren't
+// processed (e.g. because the batch expired) hold an error.
+func batchResults(ctx context.Context, client *httpclient.Client, in BatchResultsInput) (BatchResultsOutput, error) {
+	batch, err := waitForBatch(ctx, client, in.BatchID, time.Duration(in.WaitTimeout)*time.Second)
+	if err != nil {
+		return BatchResultsOutput{}, err
+	}
+
+	limit := in.Limit
+	if limit <= 0 {
+		limit = defaultBatchResultsLimit
+	}
+
+	// Only the results of the page are kept. The request count might be
+	// missing, e.g. if the batch failed validation, so the total is also
+	// inferred from the results.
+	total := batch.RequestCounts.Total
+	page := map[int]BatchResult{}
+	onLine := func(i int, line BatchResultLine) {
+		total = max(total, i+1)
+		if i >= in.Offset && i < in.Offset+limit {
+			page[i] = batchResult(batch.Endpoint, line)
+		}
+	}
+
+	if err := scanBatchFile(ctx, client, batch.OutputFileID, onLine); err != nil {
+		return BatchResultsOutput{}, err
+	}
+
+	if err := scanBatchFile(ctx, client, batch.ErrorFileID, onLine); err != nil {
+		return BatchResultsOutput{}, err
+	}
+
+	out := BatchResultsOutput{
+		BatchID: batch.ID,
+		Status:  batch.Status,
+		Results: []BatchResult{},
+		Total:   total,
+	}
+
+	end := min(in.Offset+limit, total)
+	for i := in.Offset; i < end; i++ {
+		result, ok := page[i]
+		if !ok {
+			result = BatchResult{
+				CustomID: batchCustomIDPrefix + strconv.Itoa(i),
+				Error: &util.InputError{
+					Code:    code.Code_ABORTED.String(),
+					Message: fmt.Sprintf("The request wasn't processed, the batch is %s.", batch.Status),
+				},
+			}
+		}
+
+		out.Results = append(out.Results, result)
+	}
+
+	if end < total {
+		out.NextOffset = &end
+	}
+
+	return out, nil
+}
@@ -0,0 +1,173 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/instill-ai/connector/pkg/util"
+	"github.com/instill-ai/connector/pkg/util/httpclient"
+	"github.com/instill-ai/connector/pkg/util/tokenizer"
+	"github.com/instill-ai/x/errmsg"
+)
+
+const (
+	// OpenAI adds a few tokens to every message and primes the reply.
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// tokenCounter returns the tokenizer of a model, or an estimator if the
+// model encoding is unknown or unavailable.
+func tokenCounter(ctx context.Context, model string) tokenizer.Counter {
+	enc, err := tokenizer.ForOpenAIModel(ctx, model)
+	if err != nil {
+		return tokenizer.Estimator
+	}
+
+	return enc
+}
+
+func messageText(m *TextMessage) string {
+	texts := []string{}
+	for _, c := range m.Content {
+		if c.Type == "text" && c.Text != nil {
+			texts = append(texts, *c.Text)
+		}
+	}
+
+	return strings.Join(texts, "\n")
+}
+
+// messageTokens counts the tokens of the text contents and tool calls of a
+// message.
+func messageTokens(counter tokenizer.Counter, role string, texts ...string) int {
+	tokens := tokensPerMessage + counter.CountTokens(role)
+	for _, t := range texts {
+		tokens += counter.CountTokens(t)
+	}
+
+	return tokens
+}
+
+func historyMessageTokens(counter tokenizer.Counter, m *TextMessage) int {
+	texts := []string{messageText(m), m.ToolCallID}
+	for _, tc := range m.ToolCalls {
+		texts = append(texts, tc.ID, tc.Name, fmt.Sprint(tc.Arguments))
+	}
+
+	return messageTokens(counter, m.Role, texts...)
+}
+
+// fitContext trims the chat history of a text generation input so the
+// request fits in the maximum context. The oldest messages are dropped or,
+// if requested, replaced by a summary. System messages are always kept.
+// Only text contents are accounted for.
+func (e *Execution) fitContext(ctx context.Context, client *httpclient.Client, in TextCompletionInput) (TextCompletionInput, error) {
+	if in.MaxContextTokens == nil || len(in.ChatHistory) == 0 {
+		return in, nil
+	}
+
+	prompt, err := util.PromptFromTemplate(in.Prompt, in.PromptTemplate, in.Variables)
+	if err != nil {
+		return in, err
+	}
+
+	counter := tokenCounter(ctx, in.Model)
+
+	// The system message is ignored when a chat history is provided, so the
+	// prompt is the only message outside the history.
+	fixed := tokensPerReply + messageTokens(counter, "user", prompt)
+	if in.MaxTokens != nil {
+		fixed += *in.MaxTokens
+	}
+
+	summarize := in.HistoryTrimming == util.HistoryTrimmingSummarize
+	if summarize {
+		fixed += messageTokens(counter, "system", util.SummaryPrefix) + util.SummaryMaxTokens
+	}
+
+	history := make([]util.ContextMessage, len(in.ChatHistory))
+	for i, m := range in.ChatHistory {
+		history[i] = util.ContextMessage{
+			Tokens:   historyMessageTokens(counter, m),
+			Pinned:   m.Role == "system",
+			CanStart: m.Role != "tool",
+		}
+	}
+
+	dropped, err := util.TrimHistory(history, fixed, *in.MaxContextTokens)
+	if err != nil || len(dropped) == 0 {
+		return in, err
+	}
+
+	isDropped := make(map[int]bool, len(dropped))
+	droppedMsgs := make([]*TextMessage, 0, len(dropped))
+	for _, i := range dropped {
+		isDropped[i] = true
+		droppedMsgs = append(droppedMsgs, in.ChatHistory[i])
+	}
+
+	kept := make([]*TextMessage, 0, len(in.ChatHistory)-len(dropped)+1)
+	for i, m := range in.ChatHistory {
+		if !isDropped[i] {
+			kept = append(kept, m)
+		}
+	}
+
+	if summarize {
+		summary, err := e.summarizeHistory(ctx, client, in.Model, droppedMsgs)
+		if err != nil {
+			return in, err
+		}
+
+		text := util.SummaryPrefix + summary
+		kept = insertSummary(kept, &TextMessage{Role: "system", Content: []Content{{Type: "text", Text: &text}}})
+	}
+
+	in.ChatHistory = kept
+	return in, nil
+}
+
+// insertSummary inserts the summary of the dropped messages after the
+// leading system messages of the history.
+func insertSummary(history []*TextMessage, summary *TextMessage) []*TextMessage {
+	i := 0
+	for i < len(history) && history[i].Role == "system" {
+		i++
+	}
+
+	return append(history[:i], append([]*TextMessage{summary}, history[i:]...)...)
+}
+
+// summarizeHistory asks the model to summarize a conversation.
+func (e *Execution) summarizeHistory(ctx context.Context, client *httpclient.Client, model string, history []*TextMessage) (string, error) {
+	transcript := new(strings.Builder)
+	for _, m := range history {
+		if text := messageText(m); text != "" {
+			fmt.Fprintf(transcript, "%s: %s\n", m.Role, text)
+		}
+	}
+
+	maxTokens := util.SummaryMaxTokens
+	body := TextCompletionReq{
+		Model: model,
+		Messages: []any{
+			Message{Role: "system", Content: util.SummaryPrompt},
+			Message{Role: "user", Content: transcript.String()},
+		},
+		MaxTokens: &maxTokens,
+	}
+
+	resp := TextCompletionResp{}
+	req := forModel(httpclient.SetTokenCost(client.R().SetContext(ctx), body.tokenCost(tokenCounter(ctx, model))), model)
+	if _, err := req.SetResult(&resp).SetBody(body).Post(completionsPath); err != nil {
+		return "", errmsg.AddMessage(err, "Couldn't summarize the chat history.")
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", errmsg.AddMessage(fmt.Errorf("no choices in summary"), "Couldn't summarize the chat history.")
+	}
+
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
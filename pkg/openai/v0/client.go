@@ -1,25 +1,147 @@
 package openai
 
 import (
-	"github.com/instill-ai/connector/pkg/util/httpclient"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/gofrs/uuid"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/instill-ai/connector/pkg/util/httpclient"
+	"github.com/instill-ai/x/errmsg"
 )
 
-func newClient(config *structpb.Struct, logger *zap.Logger) *httpclient.Client {
-	c := httpclient.New("OpenAI", getBasePath(config),
+const (
+	providerOpenAI     = "openai"
+	providerAzure      = "azure"
+	providerCompatible = "compatible"
+
+	defaultAzureAPIVersion = "2024-06-01"
+
+	// apiVersionPrefix is the version prefix of the OpenAI API paths.
+	apiVersionPrefix = "/v1"
+)
+
+// newClient returns an OpenAI client. Clients of the same connector
+// definition and API key share their rate limit.
+func newClient(defUID uuid.UUID, config *structpb.Struct, logger *zap.Logger) (*httpclient.Client, error) {
+	return newProviderClient(config, logger,
+		httpclient.WithRetry(httpclient.DefaultRetryPolicy),
+		httpclient.WithRateLimit(defUID.String()+getAPIKey(config), getRateLimit(config)),
+	)
+}
+
+// newProviderClient returns an OpenAI client with no retries nor rate limit
+// unless they are passed as options.
+//
+// The requests of the client are built with the OpenAI paths. Depending on
+// the provider in the configuration, the paths and authentication are
+// adapted to the layout of the provider's API.
+func newProviderClient(config *structpb.Struct, logger *zap.Logger, opts ...httpclient.Option) (*httpclient.Client, error) {
+	if err := checkProvider(config); err != nil {
+		return nil, err
+	}
+
+	opts = append([]httpclient.Option{
 		httpclient.WithLogger(logger),
 		httpclient.WithEndUserError(new(errBody)),
-	)
+	}, opts...)
+	c := httpclient.New("OpenAI", getBasePath(config), opts...)
 
-	c.SetAuthToken(getAPIKey(config))
+	switch getProvider(config) {
+	case providerAzure:
+		c.SetHeader("api-key", getAPIKey(config))
+		c.OnBeforeRequest(azurePaths(getAPIVersion(config), getDeployments(config)))
+	case providerCompatible:
+		if getAPIKey(config) != "" {
+			c.SetAuthToken(getAPIKey(config))
+		}
+		c.OnBeforeRequest(compatiblePaths(getBasePath(config)))
+	default:
+		c.SetAuthToken(getAPIKey(config))
+	}
 
 	org := getOrg(config)
 	if org != "" {
 		c.SetHeader("OpenAI-Organization", org)
 	}
 
-	return c
+	return c, nil
+}
+
+// checkProvider validates the provider settings of a configuration. Azure
+// and OpenAI-compatible providers have no default URL. Falling back to the
+// OpenAI API would send their credentials to OpenAI.
+func checkProvider(config *structpb.Struct) error {
+	provider := getProvider(config)
+	if provider == providerOpenAI || config.GetFields()["base_url"].GetStringValue() != "" {
+		return nil
+	}
+
+	return errmsg.AddMessage(
+		fmt.Errorf("missing base URL for provider %s", provider),
+		fmt.Sprintf("The %s provider requires a base URL. Set it in the connector configuration.", provider),
+	)
+}
+
+type modelKey struct{}
+
+// forModel sets the model a request is sent to. Providers that serve each
+// model from a different deployment use it to build the request path, so it
+// must be called after the request context is set.
+func forModel(req *resty.Request, model string) *resty.Request {
+	return req.SetContext(context.WithValue(req.Context(), modelKey{}, model))
+}
+
+func requestModel(req *resty.Request) string {
+	model, _ := req.Context().Value(modelKey{}).(string)
+	return model
+}
+
+// azurePaths adapts the requests to the Azure OpenAI layout. The requests to
+// a model are sent to its deployment, e.g. /v1/chat/completions becomes
+// /openai/deployments/{deployment}/chat/completions. The rest of the paths
+// are under /openai. Deployments are named after their model unless the
+// configuration maps the model to a different name.
+func azurePaths(apiVersion string, deployments map[string]string) resty.RequestMiddleware {
+	return func(_ *resty.Client, req *resty.Request) error {
+		// Retries go through the middleware again.
+		if !strings.HasPrefix(req.URL, apiVersionPrefix+"/") {
+			return nil
+		}
+
+		path := strings.TrimPrefix(req.URL, apiVersionPrefix)
+		if model := requestModel(req); model != "" {
+			deployment, ok := deployments[model]
+			if !ok {
+				deployment = model
+			}
+
+			path = "/deployments/" + deployment + path
+		}
+
+		req.URL = "/openai" + path
+		req.SetQueryParam("api-version", apiVersion)
+		return nil
+	}
+}
+
+// compatiblePaths adapts the requests to OpenAI-compatible servers (e.g.
+// vLLM or LocalAI). These usually expose the OpenAI paths, but their base
+// URL is often provided with the version prefix.
+func compatiblePaths(baseURL string) resty.RequestMiddleware {
+	hasPrefix := strings.HasSuffix(strings.TrimSuffix(baseURL, "/"), apiVersionPrefix)
+
+	return func(_ *resty.Client, req *resty.Request) error {
+		if hasPrefix {
+			req.URL = strings.TrimPrefix(req.URL, apiVersionPrefix)
+		}
+
+		return nil
+	}
 }
 
 type errBody struct {
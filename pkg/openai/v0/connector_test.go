@@ -1,16 +1,30 @@
 package openai
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	qt "github.com/frankban/quicktest"
 	"github.com/gofrs/uuid"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/structpb"
 
+	"github.com/instill-ai/connector/pkg/util"
 	"github.com/instill-ai/connector/pkg/util/httpclient"
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
 	"github.com/instill-ai/x/errmsg"
@@ -58,6 +72,12 @@ func TestConnector_Execute(t *testing.T) {
 			path:        transcriptionsPath,
 			contentType: "multipart/form-data; boundary=.*",
 		},
+		{
+			name:        "speech translation",
+			task:        speechTranslationTask,
+			path:        translationsPath,
+			contentType: "multipart/form-data; boundary=.*",
+		},
 		{
 			name:        "text to speech",
 			task:        textToSpeechTask,
@@ -127,21 +147,465 @@ func TestConnector_Execute(t *testing.T) {
 	})
 }
 
-func TestConnector_Test(t *testing.T) {
+func TestConnector_ExecuteToolCalls(t *testing.T) {
 	c := qt.New(t)
 
 	logger := zap.NewNop()
 	connector := Init(logger)
 	defID := uuid.Must(uuid.NewV4())
 
-	c.Run("nok - error", func(c *qt.C) {
+	tool := map[string]any{
+		"type": "function",
+		"function": map[string]any{
+			"name": "get_weather",
+			"parameters": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+			},
+		},
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		c.Assert(err, qt.IsNil)
+		c.Check(body, qt.JSONEquals, map[string]any{
+			"model":       "gpt-3.5-turbo",
+			"tools":       []any{tool},
+			"tool_choice": "auto",
+			"messages": []any{
+				map[string]any{"role": "user", "content": []any{map[string]any{"type": "text", "text": "Weather in Paris?"}}},
+				map[string]any{"role": "assistant", "content": "", "tool_calls": []any{
+					map[string]any{"id": "call_0", "type": "function", "function": map[string]any{"name": "get_weather", "arguments": `{"city":"Paris"}`}},
+				}},
+				map[string]any{"role": "tool", "content": "Sunny", "tool_call_id": "call_0"},
+				map[string]any{"role": "user", "content": []any{map[string]any{"type": "text", "text": "And in Rome?"}}},
+			},
+		})
+
+		w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+		fmt.Fprintln(w, `{
+  "choices": [
+    {
+      "index": 0,
+      "finish_reason": "tool_calls",
+      "message": {
+        "role": "assistant",
+        "content": null,
+        "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\": \"Rome\"}"}}]
+      }
+    }
+  ],
+  "usage": {"prompt_tokens": 82, "completion_tokens": 17, "total_tokens": 99}
+}`)
+	})
+
+	openAIServer := httptest.NewServer(h)
+	c.Cleanup(openAIServer.Close)
+
+	config, err := structpb.NewStruct(map[string]any{
+		"base_path": openAIServer.URL,
+		"api_key":   apiKey,
+	})
+	c.Assert(err, qt.IsNil)
+
+	exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+	c.Assert(err, qt.IsNil)
+
+	pbIn, err := structpb.NewStruct(map[string]any{
+		"model":       "gpt-3.5-turbo",
+		"prompt":      "And in Rome?",
+		"tools":       []any{tool},
+		"tool_choice": "auto",
+		"chat_history": []any{
+			map[string]any{"role": "user", "content": []any{map[string]any{"type": "text", "text": "Weather in Paris?"}}},
+			map[string]any{"role": "assistant", "content": []any{}, "tool_calls": []any{
+				map[string]any{"id": "call_0", "name": "get_weather", "arguments": map[string]any{"city": "Paris"}},
+			}},
+			map[string]any{"role": "tool", "tool_call_id": "call_0", "content": []any{map[string]any{"type": "text", "text": "Sunny"}}},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	got, err := exec.Execute([]*structpb.Struct{pbIn})
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.HasLen, 1)
+	c.Check(got[0].AsMap(), qt.DeepEquals, map[string]any{
+		"texts": []any{""},
+		"tool_calls": []any{
+			map[string]any{
+				"choice_index": float64(0),
+				"id":           "call_1",
+				"name":         "get_weather",
+				"arguments":    map[string]any{"city": "Rome"},
+			},
+		},
+		"finish_reasons": []any{"tool_calls"},
+		"usage": map[string]any{
+			"prompt_tokens":     float64(82),
+			"completion_tokens": float64(17),
+			"total_tokens":      float64(99),
+		},
+	})
+}
+
+func TestConnector_ExecuteStructuredOutput(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           map[string]any{"city": map[string]any{"type": "string"}},
+		"required":             []any{"city"},
+		"additionalProperties": false,
+	}
+	completion := func(text string) string {
+		b, _ := json.Marshal(text)
+		return fmt.Sprintf(`{
+  "choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": %s}}],
+  "usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+}`, b)
+	}
+
+	testcases := []struct {
+		name      string
+		model     string
+		retries   int
+		responses []string
+		wantTexts []any
+		wantUsage float64
+		wantErr   string
+	}{
+		{
+			name:      "ok - native schema",
+			model:     "gpt-4o-mini",
+			responses: []string{`{"city":"Rome"}`},
+			wantTexts: []any{`{"city":"Rome"}`},
+			wantUsage: 15,
+		},
+		{
+			name:      "ok - client-side schema with retry",
+			model:     "gpt-3.5-turbo",
+			retries:   1,
+			responses: []string{"Rome", "```json\n{\"city\": \"Rome\"}\n```"},
+			wantTexts: []any{"```json\n{\"city\": \"Rome\"}\n```"},
+			wantUsage: 30,
+		},
+		{
+			name:      "nok - retries exhausted",
+			model:     "gpt-3.5-turbo",
+			responses: []string{`{"town":"Rome"}`},
+			wantErr:   "The model didn't generate a valid structured output. The response doesn't follow the JSON schema (/: missing properties: 'city'; /: additionalProperties 'town' not allowed).",
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			var reqs []TextCompletionReq
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req TextCompletionReq
+				c.Assert(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
+				reqs = append(reqs, req)
+
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				fmt.Fprintln(w, completion(tc.responses[len(reqs)-1]))
+			})
+
+			openAIServer := httptest.NewServer(h)
+			c.Cleanup(openAIServer.Close)
+
+			config, err := structpb.NewStruct(map[string]any{
+				"base_path": openAIServer.URL,
+				"api_key":   apiKey,
+			})
+			c.Assert(err, qt.IsNil)
+
+			exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+			c.Assert(err, qt.IsNil)
+
+			pbIn, err := structpb.NewStruct(map[string]any{
+				"model":               tc.model,
+				"prompt":              "Where is the Colosseum?",
+				"json_schema":         schema,
+				"json_schema_retries": tc.retries,
+			})
+			c.Assert(err, qt.IsNil)
+
+			got, err := exec.Execute([]*structpb.Struct{pbIn})
+			c.Check(reqs, qt.HasLen, len(tc.responses))
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				return
+			}
+
+			c.Assert(err, qt.IsNil)
+			c.Check(got[0].AsMap()["texts"], qt.DeepEquals, tc.wantTexts)
+			c.Check(got[0].AsMap()["data"], qt.DeepEquals, map[string]any{"city": "Rome"})
+			c.Check(got[0].AsMap()["usage"].(map[string]any)["total_tokens"], qt.Equals, tc.wantUsage)
+
+			if tc.model == "gpt-4o-mini" {
+				c.Check(reqs[0].ResponseFormat, qt.DeepEquals, &ResponseFormatStruct{
+					Type:       "json_schema",
+					JSONSchema: &ResponseJSONSchema{Name: "structured_output", Schema: schema, Strict: true},
+				})
+				return
+			}
+
+			// The schema is enforced client-side and the invalid response is
+			// fed back to the model.
+			c.Check(reqs[0].ResponseFormat, qt.IsNil)
+			c.Check(reqs[0].Messages, qt.HasLen, 1)
+			c.Check(reqs[1].Messages, qt.HasLen, 3)
+			c.Check(reqs[1].Messages[1], qt.DeepEquals, map[string]any{"role": "assistant", "content": "Rome"})
+		})
+	}
+}
+
+func TestConnector_ExecutePromptTemplate(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	testcases := []struct {
+		name       string
+		in         map[string]any
+		wantPrompt string
+		wantErr    string
+	}{
+		{
+			name: "ok - rendered template",
+			in: map[string]any{
+				"prompt_template": "Translate to {{.language}}:{{range .sentences}}\n- {{.}}{{end}}",
+				"variables": map[string]any{
+					"language":  "French",
+					"sentences": []any{"Hello", "Goodbye"},
+				},
+			},
+			wantPrompt: "Translate to French:\n- Hello\n- Goodbye",
+		},
+		{
+			name: "nok - missing variable",
+			in: map[string]any{
+				"prompt_template": "Translate to {{.language}}: {{.sentence}}",
+				"variables":       map[string]any{"sentence": "Hello"},
+			},
+			wantErr: `The prompt template references the variable "language", which isn't defined.`,
+		},
+		{
+			name: "nok - prompt and template",
+			in: map[string]any{
+				"prompt":          "Translate to French: Hello",
+				"prompt_template": "Translate to French: {{.sentence}}",
+			},
+			wantErr: "Provide either a prompt or a prompt template, not both.",
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req TextCompletionReq
+				c.Assert(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
+				c.Check(req.Messages, qt.DeepEquals, []any{
+					map[string]any{"role": "user", "content": []any{map[string]any{"type": "text", "text": tc.wantPrompt}}},
+				})
+
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				fmt.Fprintln(w, `{"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Bonjour"}}]}`)
+			})
+
+			openAIServer := httptest.NewServer(h)
+			c.Cleanup(openAIServer.Close)
+
+			config, err := structpb.NewStruct(map[string]any{
+				"base_path": openAIServer.URL,
+				"api_key":   apiKey,
+			})
+			c.Assert(err, qt.IsNil)
+
+			exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+			c.Assert(err, qt.IsNil)
+
+			tc.in["model"] = "gpt-3.5-turbo"
+			pbIn, err := structpb.NewStruct(tc.in)
+			c.Assert(err, qt.IsNil)
+
+			got, err := exec.Execute([]*structpb.Struct{pbIn})
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				return
+			}
+
+			c.Assert(err, qt.IsNil)
+			c.Check(got[0].AsMap()["texts"], qt.DeepEquals, []any{"Bonjour"})
+		})
+	}
+}
+
+func TestConnector_ExecuteContextTrimming(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	textMsg := func(role, text string) map[string]any {
+		return map[string]any{"role": role, "content": []any{map[string]any{"type": "text", "text": text}}}
+	}
+	reqMsg := func(role, text string) map[string]any {
+		if role == "user" {
+			return textMsg(role, text)
+		}
+
+		return map[string]any{"role": role, "content": text}
+	}
+
+	// With an unknown tokenizer, each of these messages takes 3 tokens plus
+	// the estimated 2 tokens of the role and 10 tokens of the text.
+	long := strings.Repeat("a", 40)
+	history := []any{
+		textMsg("system", "You are a helpful assistant, who answers."),
+		textMsg("user", long),
+		textMsg("assistant", long),
+		textMsg("user", long),
+		textMsg("assistant", long),
+	}
+
+	testcases := []struct {
+		name         string
+		trimming     string
+		maxContext   int
+		wantMessages []any
+		wantErr      string
+	}{
+		{
+			name:       "ok - drop",
+			trimming:   "drop",
+			maxContext: 55,
+			wantMessages: []any{
+				reqMsg("system", "You are a helpful assistant, who answers."),
+				reqMsg("user", long),
+				reqMsg("assistant", long),
+				reqMsg("user", "Hi"),
+			},
+		},
+		{
+			name:       "ok - summarize",
+			trimming:   "summarize",
+			maxContext: 325,
+			wantMessages: []any{
+				reqMsg("system", "You are a helpful assistant, who answers."),
+				reqMsg("system", "Summary of the earlier conversation: They said a lot of a's."),
+				reqMsg("user", long),
+				reqMsg("assistant", long),
+				reqMsg("user", "Hi"),
+			},
+		},
+		{
+			name:       "nok - no room for the prompt",
+			trimming:   "drop",
+			maxContext: 10,
+			wantErr:    "The prompt, the system messages and the tokens reserved for the completion take 24 tokens, which exceeds the maximum context of 10 tokens.",
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			var reqs []map[string]any
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req map[string]any
+				c.Assert(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
+				reqs = append(reqs, req)
+
+				content := "Hello"
+				if len(reqs) == 1 && tc.trimming == "summarize" {
+					c.Check(req["max_tokens"], qt.Equals, float64(util.SummaryMaxTokens))
+					c.Check(req["messages"], qt.DeepEquals, []any{
+						reqMsg("system", util.SummaryPrompt),
+						map[string]any{"role": "user", "content": "user: " + long + "\nassistant: " + long + "\n"},
+					})
+					content = "They said a lot of a's."
+				}
+
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				fmt.Fprintf(w, `{"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": %q}}]}`, content)
+			})
+
+			openAIServer := httptest.NewServer(h)
+			c.Cleanup(openAIServer.Close)
+
+			config, err := structpb.NewStruct(map[string]any{
+				"base_path": openAIServer.URL,
+				"api_key":   apiKey,
+			})
+			c.Assert(err, qt.IsNil)
+
+			exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+			c.Assert(err, qt.IsNil)
+
+			pbIn, err := structpb.NewStruct(map[string]any{
+				"model":              "my-model",
+				"prompt":             "Hi",
+				"chat_history":       history,
+				"max_context_tokens": tc.maxContext,
+				"history_trimming":   tc.trimming,
+			})
+			c.Assert(err, qt.IsNil)
+
+			got, err := exec.Execute([]*structpb.Struct{pbIn})
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				c.Check(reqs, qt.HasLen, 0)
+				return
+			}
+
+			c.Assert(err, qt.IsNil)
+			c.Check(got[0].AsMap()["texts"], qt.DeepEquals, []any{"Hello"})
+			c.Check(reqs[len(reqs)-1]["messages"], qt.DeepEquals, tc.wantMessages)
+		})
+	}
+}
+
+func TestConnector_ExecuteStream(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	c.Run("ok - multiple choices", func(c *qt.C) {
+		events := []string{
+			`{"choices": [{"index": 0, "delta": {"role": "assistant", "content": ""}}, {"index": 1, "delta": {"role": "assistant", "content": ""}}]}`,
+			`{"choices": [{"index": 0, "delta": {"content": "Hola"}}]}`,
+			`{"choices": [{"index": 1, "delta": {"content": "Hello"}}]}`,
+			`{"choices": [{"index": 0, "delta": {"content": ", mundo"}}]}`,
+			`{"choices": [{"index": 1, "delta": {"content": ", world"}}]}`,
+			`{"choices": [{"index": 0, "delta": {}, "finish_reason": "stop"}, {"index": 1, "delta": {}, "finish_reason": "stop"}]}`,
+			`[DONE]`,
+		}
+
 		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c.Check(r.Method, qt.Equals, http.MethodGet)
-			c.Check(r.URL.Path, qt.Equals, listModelsPath)
+			c.Check(r.Method, qt.Equals, http.MethodPost)
+			c.Check(r.URL.Path, qt.Equals, completionsPath)
 
-			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
-			w.WriteHeader(http.StatusUnauthorized)
-			fmt.Fprintln(w, errResp)
+			body, err := io.ReadAll(r.Body)
+			c.Assert(err, qt.IsNil)
+			c.Check(body, qt.JSONEquals, map[string]any{
+				"model":    "gpt-3.5-turbo",
+				"n":        2,
+				"stream":   true,
+				"messages": []any{map[string]any{"role": "user", "content": []any{map[string]any{"type": "text", "text": "Say hi"}}}},
+			})
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, e := range events {
+				fmt.Fprintf(w, "data: %s\n\n", e)
+				w.(http.Flusher).Flush()
+			}
 		})
 
 		openAIServer := httptest.NewServer(h)
@@ -149,24 +613,60 @@ func TestConnector_Test(t *testing.T) {
 
 		config, err := structpb.NewStruct(map[string]any{
 			"base_path": openAIServer.URL,
+			"api_key":   apiKey,
 		})
 		c.Assert(err, qt.IsNil)
 
-		got, err := connector.Test(defID, config, logger)
-		c.Check(err, qt.IsNotNil)
-		c.Check(got, qt.Equals, pipelinePB.Connector_STATE_ERROR)
+		exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+		c.Assert(err, qt.IsNil)
 
-		wantMsg := "OpenAI responded with a 401 status code. Incorrect API key provided."
-		c.Check(errmsg.Message(err), qt.Equals, wantMsg)
+		var chunks []TextCompletionChunk
+		exec.(*Execution).SetStreamHandler(func(chunk TextCompletionChunk) {
+			chunks = append(chunks, chunk)
+		})
+
+		pbIn, err := structpb.NewStruct(map[string]any{
+			"model":  "gpt-3.5-turbo",
+			"prompt": "Say hi",
+			"n":      2,
+		})
+		c.Assert(err, qt.IsNil)
+
+		got, err := exec.Execute([]*structpb.Struct{pbIn})
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.HasLen, 1)
+		c.Check(got[0].AsMap(), qt.DeepEquals, map[string]any{
+			"texts":          []any{"Hola, mundo", "Hello, world"},
+			"finish_reasons": []any{"stop", "stop"},
+			// The stream doesn't report usage, so it's counted like the
+			// chat history, including the message overhead.
+			"usage": map[string]any{
+				"prompt_tokens":     float64(9),
+				"completion_tokens": float64(6),
+				"total_tokens":      float64(15),
+			},
+		})
+
+		c.Check(chunks, qt.DeepEquals, []TextCompletionChunk{
+			{ChoiceIndex: 0, Text: "Hola"},
+			{ChoiceIndex: 1, Text: "Hello"},
+			{ChoiceIndex: 0, Text: ", mundo"},
+			{ChoiceIndex: 1, Text: ", world"},
+		})
 	})
 
-	c.Run("ok - disconnected", func(c *qt.C) {
+	c.Run("ok - input index with partial failures", func(c *qt.C) {
 		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c.Check(r.Method, qt.Equals, http.MethodGet)
-			c.Check(r.URL.Path, qt.Equals, listModelsPath)
+			var req struct {
+				Messages []struct {
+					Content []Content `json:"content"`
+				} `json:"messages"`
+			}
+			c.Assert(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
 
-			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
-			fmt.Fprintln(w, `{}`)
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"choices\": [{\"index\": 0, \"delta\": {\"content\": %q}}]}\n\n", *req.Messages[0].Content[0].Text)
+			fmt.Fprint(w, "data: [DONE]\n\n")
 		})
 
 		openAIServer := httptest.NewServer(h)
@@ -174,21 +674,94 @@ func TestConnector_Test(t *testing.T) {
 
 		config, err := structpb.NewStruct(map[string]any{
 			"base_path": openAIServer.URL,
+			"api_key":   apiKey,
 		})
 		c.Assert(err, qt.IsNil)
 
-		got, err := connector.Test(defID, config, logger)
-		c.Check(err, qt.IsNil)
-		c.Check(got, qt.Equals, pipelinePB.Connector_STATE_DISCONNECTED)
+		exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+		c.Assert(err, qt.IsNil)
+
+		chunks := map[int]string{}
+		exec.(*Execution).SetStreamHandler(func(chunk TextCompletionChunk) {
+			chunks[chunk.InputIndex] += chunk.Text
+		})
+
+		inputs := make([]*structpb.Struct, 3)
+		for i := range inputs {
+			inputs[i], err = structpb.NewStruct(map[string]any{"model": "gpt-3.5-turbo", "prompt": fmt.Sprintf("input %d", i)})
+			c.Assert(err, qt.IsNil)
+		}
+
+		// Each input is executed on its own, but the chunks point to its
+		// index in the batch.
+		ctx := util.WithPartialFailures(context.Background())
+		_, err = util.ExecuteWithContext(ctx, exec, inputs)
+		c.Assert(err, qt.IsNil)
+		c.Check(chunks, qt.DeepEquals, map[int]string{0: "input 0", 1: "input 1", 2: "input 2"})
 	})
 
-	c.Run("ok - connected", func(c *qt.C) {
+	c.Run("ok - structured output attempts", func(c *qt.C) {
+		attempts := [][]string{{"Rome"}, {`{"city":`, `"Rome"}`}}
+
+		var calls int
 		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c.Check(r.Method, qt.Equals, http.MethodGet)
-			c.Check(r.URL.Path, qt.Equals, listModelsPath)
+			calls++
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, text := range attempts[calls-1] {
+				b, _ := json.Marshal(text)
+				fmt.Fprintf(w, "data: {\"choices\": [{\"index\": 0, \"delta\": {\"content\": %s}}]}\n\n", b)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		})
+
+		openAIServer := httptest.NewServer(h)
+		c.Cleanup(openAIServer.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"base_path": openAIServer.URL,
+			"api_key":   apiKey,
+		})
+		c.Assert(err, qt.IsNil)
+
+		exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+		c.Assert(err, qt.IsNil)
+
+		var chunks []TextCompletionChunk
+		exec.(*Execution).SetStreamHandler(func(chunk TextCompletionChunk) {
+			chunks = append(chunks, chunk)
+		})
+
+		pbIn, err := structpb.NewStruct(map[string]any{
+			"model":  "gpt-3.5-turbo",
+			"prompt": "Where is the Colosseum?",
+			"json_schema": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+				"required":   []any{"city"},
+			},
+			"json_schema_retries": 1,
+		})
+		c.Assert(err, qt.IsNil)
+
+		got, err := exec.Execute([]*structpb.Struct{pbIn})
+		c.Assert(err, qt.IsNil)
+		c.Check(got[0].AsMap()["data"], qt.DeepEquals, map[string]any{"city": "Rome"})
 
+		// The chunks of the invalid generation are superseded by the ones
+		// of the next attempt.
+		c.Check(chunks, qt.DeepEquals, []TextCompletionChunk{
+			{Attempt: 0, Text: "Rome"},
+			{Attempt: 1, Text: `{"city":`},
+			{Attempt: 1, Text: `"Rome"}`},
+		})
+	})
+
+	c.Run("nok - 401", func(c *qt.C) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
-			fmt.Fprintln(w, `{"data": [{}]}`)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, errResp)
 		})
 
 		openAIServer := httptest.NewServer(h)
@@ -196,6 +769,1384 @@ func TestConnector_Test(t *testing.T) {
 
 		config, err := structpb.NewStruct(map[string]any{
 			"base_path": openAIServer.URL,
+			"api_key":   apiKey,
+		})
+		c.Assert(err, qt.IsNil)
+
+		exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+		c.Assert(err, qt.IsNil)
+		exec.(*Execution).SetStreamHandler(func(TextCompletionChunk) {})
+
+		_, err = exec.Execute([]*structpb.Struct{new(structpb.Struct)})
+		c.Check(err, qt.IsNotNil)
+
+		want := "OpenAI responded with a 401 status code. Incorrect API key provided."
+		c.Check(errmsg.Message(err), qt.Equals, want)
+	})
+}
+
+func TestConnector_ExecuteVision(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	const (
+		imageURL = "https://storage.googleapis.com/bucket/cat.jpg"
+		pngB64   = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="
+	)
+
+	testcases := []struct {
+		name         string
+		images       []any
+		imageDetails []any
+		wantContent  []any
+		wantErr      string
+	}{
+		{
+			name:         "ok - URL and base64 images",
+			images:       []any{imageURL, "data:image/png;base64," + pngB64},
+			imageDetails: []any{"auto", "low"},
+			wantContent: []any{
+				map[string]any{"type": "text", "text": "What's in the images?"},
+				map[string]any{"type": "image_url", "image_url": map[string]any{"url": imageURL, "detail": "auto"}},
+				map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/png;base64," + pngB64, "detail": "low"}},
+			},
+		},
+		{
+			name:    "nok - unsupported format",
+			images:  []any{base64.StdEncoding.EncodeToString([]byte("%PDF-1.4 foo"))},
+			wantErr: "Image 0 is invalid. The image format (application/pdf) isn't supported. Use one of image/png, image/jpeg, image/gif, image/webp.",
+		},
+		{
+			name:    "nok - invalid base64",
+			images:  []any{imageURL, "foo"},
+			wantErr: "Image 1 is invalid. Images must be URLs or base64-encoded files.",
+		},
+		{
+			name:         "nok - unsupported detail",
+			images:       []any{imageURL},
+			imageDetails: []any{"medium"},
+			wantErr:      `Image detail "medium" isn't supported. Use one of auto, low, high.`,
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Messages []struct {
+						Content any `json:"content"`
+					} `json:"messages"`
+				}
+				c.Assert(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
+				c.Assert(req.Messages, qt.HasLen, 1)
+				c.Check(req.Messages[0].Content, qt.DeepEquals, tc.wantContent)
+
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				fmt.Fprintln(w, `{"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Cats"}}]}`)
+			})
+
+			openAIServer := httptest.NewServer(h)
+			c.Cleanup(openAIServer.Close)
+
+			config, err := structpb.NewStruct(map[string]any{
+				"base_path": openAIServer.URL,
+				"api_key":   apiKey,
+			})
+			c.Assert(err, qt.IsNil)
+
+			exec, err := connector.CreateExecution(defID, textGenerationTask, config, logger)
+			c.Assert(err, qt.IsNil)
+
+			in := map[string]any{
+				"model":  "gpt-4-vision-preview",
+				"prompt": "What's in the images?",
+				"images": tc.images,
+			}
+			if tc.imageDetails != nil {
+				in["image_details"] = tc.imageDetails
+			}
+
+			pbIn, err := structpb.NewStruct(in)
+			c.Assert(err, qt.IsNil)
+
+			got, err := exec.Execute([]*structpb.Struct{pbIn})
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				return
+			}
+
+			c.Assert(err, qt.IsNil)
+			c.Check(got[0].AsMap()["texts"], qt.DeepEquals, []any{"Cats"})
+		})
+	}
+}
+
+func TestConnector_ExecuteTextEmbeddings(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	// base64Embedding encodes the embedding of the ith text as little-endian
+	// float32 values.
+	base64Embedding := func(i int) string {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(i)))
+		binary.LittleEndian.PutUint32(b[4:], math.Float32bits(0.5))
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	texts := make([]any, maxEmbeddingsBatch+2)
+	for i := range texts {
+		texts[i] = strconv.Itoa(i)
+	}
+
+	var batchSizes []int
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, qt.Equals, embeddingsPath)
+
+		var req TextEmbeddingsReq
+		c.Assert(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
+		c.Check(req.Model, qt.Equals, "text-embedding-3-small")
+		c.Check(req.Dimensions, qt.Equals, 2)
+		c.Check(req.EncodingFormat, qt.Equals, encodingFormatBase64)
+		batchSizes = append(batchSizes, len(req.Input))
+
+		// Data is returned in reverse order.
+		data := make([]map[string]any, len(req.Input))
+		for i, text := range req.Input {
+			n, err := strconv.Atoi(text)
+			c.Assert(err, qt.IsNil)
+			data[len(data)-1-i] = map[string]any{"index": i, "embedding": base64Embedding(n)}
+		}
+
+		w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+		c.Check(json.NewEncoder(w).Encode(map[string]any{"data": data}), qt.IsNil)
+	})
+
+	openAIServer := httptest.NewServer(h)
+	c.Cleanup(openAIServer.Close)
+
+	config, err := structpb.NewStruct(map[string]any{
+		"base_path": openAIServer.URL,
+		"api_key":   apiKey,
+	})
+	c.Assert(err, qt.IsNil)
+
+	exec, err := connector.CreateExecution(defID, textEmbeddingsTask, config, logger)
+	c.Assert(err, qt.IsNil)
+
+	pbIn, err := structpb.NewStruct(map[string]any{
+		"model":           "text-embedding-3-small",
+		"texts":           texts,
+		"dimensions":      2,
+		"encoding_format": encodingFormatBase64,
+	})
+	c.Assert(err, qt.IsNil)
+
+	got, err := exec.Execute([]*structpb.Struct{pbIn})
+	c.Assert(err, qt.IsNil)
+	c.Check(batchSizes, qt.DeepEquals, []int{maxEmbeddingsBatch, 2})
+
+	out := got[0].AsMap()
+	c.Check(out["embedding"], qt.IsNil)
+
+	embeddings := out["embeddings"].([]any)
+	c.Assert(embeddings, qt.HasLen, len(texts))
+	for i, e := range embeddings {
+		c.Check(e, qt.DeepEquals, []any{float64(i), 0.5})
+	}
+}
+
+func TestConnector_Test(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	c.Run("nok - error", func(c *qt.C) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Check(r.Method, qt.Equals, http.MethodGet)
+			c.Check(r.URL.Path, qt.Equals, listModelsPath)
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, errResp)
+		})
+
+		openAIServer := httptest.NewServer(h)
+		c.Cleanup(openAIServer.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"base_path": openAIServer.URL,
+		})
+		c.Assert(err, qt.IsNil)
+
+		got, err := connector.Test(defID, config, logger)
+		c.Check(err, qt.IsNotNil)
+		c.Check(got, qt.Equals, pipelinePB.Connector_STATE_ERROR)
+
+		wantMsg := "OpenAI responded with a 401 status code. Incorrect API key provided."
+		c.Check(errmsg.Message(err), qt.Equals, wantMsg)
+	})
+
+	c.Run("ok - disconnected", func(c *qt.C) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Check(r.Method, qt.Equals, http.MethodGet)
+			c.Check(r.URL.Path, qt.Equals, listModelsPath)
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			fmt.Fprintln(w, `{}`)
+		})
+
+		openAIServer := httptest.NewServer(h)
+		c.Cleanup(openAIServer.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"base_path": openAIServer.URL,
+		})
+		c.Assert(err, qt.IsNil)
+
+		got, err := connector.Test(defID, config, logger)
+		c.Check(err, qt.IsNil)
+		c.Check(got, qt.Equals, pipelinePB.Connector_STATE_DISCONNECTED)
+	})
+
+	c.Run("ok - connected", func(c *qt.C) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Check(r.Method, qt.Equals, http.MethodGet)
+			c.Check(r.URL.Path, qt.Equals, listModelsPath)
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			fmt.Fprintln(w, `{"data": [{}]}`)
+		})
+
+		openAIServer := httptest.NewServer(h)
+		c.Cleanup(openAIServer.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"base_path": openAIServer.URL,
+		})
+		c.Assert(err, qt.IsNil)
+
+		got, err := connector.Test(defID, config, logger)
+		c.Check(err, qt.IsNil)
+		c.Check(got, qt.Equals, pipelinePB.Connector_STATE_CONNECTED)
+	})
+}
+
+func TestConnector_ExecuteBatch(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	pollInterval := batchPollInterval
+	batchPollInterval = time.Millisecond
+	c.Cleanup(func() { batchPollInterval = pollInterval })
+
+	const (
+		batchID      = "batch_abc"
+		inputFileID  = "file-in"
+		outputFileID = "file-out"
+		errorFileID  = "file-err"
+	)
+
+	completion := func(text string) string {
+		resp := map[string]any{
+			"choices": []map[string]any{{"message": map[string]any{"content": text}, "finish_reason": "stop"}},
+			"usage":   map[string]any{"prompt_tokens": 5, "completion_tokens": 3, "total_tokens": 8},
+		}
+		b, _ := json.Marshal(resp)
+		return string(b)
+	}
+
+	var statusCalls int
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == filesPath:
+			c.Check(r.FormValue("purpose"), qt.Equals, batchPurpose)
+
+			f, fh, err := r.FormFile("file")
+			c.Assert(err, qt.IsNil)
+			c.Check(fh.Filename, qt.Equals, "batch.jsonl")
+
+			b, err := io.ReadAll(f)
+			c.Assert(err, qt.IsNil)
+
+			var lines []BatchLine
+			dec := json.NewDecoder(bytes.NewReader(b))
+			for dec.More() {
+				var line BatchLine
+				c.Assert(dec.Decode(&line), qt.IsNil)
+				lines = append(lines, line)
+			}
+
+			c.Assert(lines, qt.HasLen, 3)
+			for i, line := range lines {
+				c.Check(line.CustomID, qt.Equals, fmt.Sprintf("request-%d", i))
+				c.Check(line.Method, qt.Equals, http.MethodPost)
+				c.Check(line.URL, qt.Equals, completionsPath)
+				c.Check(line.Body, qt.ContentEquals, map[string]any{
+					"model": "gpt-3.5-turbo",
+					"messages": []any{map[string]any{
+						"role":    "user",
+						"content": []any{map[string]any{"type": "text", "text": fmt.Sprintf("Prompt %d", i)}},
+					}},
+				})
+			}
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			fmt.Fprintf(w, `{"id": %q, "purpose": "batch"}`, inputFileID)
+
+		case r.Method == http.MethodPost && r.URL.Path == batchesPath:
+			var req BatchReq
+			c.Assert(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
+			c.Check(req, qt.DeepEquals, BatchReq{
+				InputFileID:      inputFileID,
+				Endpoint:         completionsPath,
+				CompletionWindow: batchCompletionWindow,
+				Metadata:         map[string]string{"job": "nightly"},
+			})
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			fmt.Fprintf(w, `{"id": %q, "status": "validating", "input_file_id": %q}`, batchID, inputFileID)
+
+		case r.Method == http.MethodGet && r.URL.Path == batchesPath+"/"+batchID:
+			statusCalls++
+			status := "in_progress"
+			if statusCalls > 2 {
+				status = batchStatusCompleted
+			}
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			fmt.Fprintf(w, `{
+  "id": %q,
+  "endpoint": %q,
+  "status": %q,
+  "output_file_id": %q,
+  "error_file_id": %q,
+  "request_counts": {"total": 4, "completed": 2, "failed": 1}
+}`, batchID, completionsPath, status, outputFileID, errorFileID)
+
+		case r.Method == http.MethodGet && r.URL.Path == filesPath+"/"+outputFileID+"/content":
+			// Results aren't returned in order.
+			fmt.Fprintf(w, "%s\n%s\n",
+				`{"custom_id": "request-2", "response": {"status_code": 200, "body": `+completion("Answer 2")+`}}`,
+				`{"custom_id": "request-0", "response": {"status_code": 200, "body": `+completion("Answer 0")+`}}`,
+			)
+
+		case r.Method == http.MethodGet && r.URL.Path == filesPath+"/"+errorFileID+"/content":
+			fmt.Fprintln(w, `{"custom_id": "request-1", "response": {"status_code": 400, "body": {"error": {"message": "Invalid model."}}}}`)
+
+		default:
+			c.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	openAIServer := httptest.NewServer(h)
+	c.Cleanup(openAIServer.Close)
+
+	config, err := structpb.NewStruct(map[string]any{
+		"base_path": openAIServer.URL,
+		"api_key":   apiKey,
+	})
+	c.Assert(err, qt.IsNil)
+
+	execute := func(c *qt.C, task string, in map[string]any) (map[string]any, error) {
+		exec, err := connector.CreateExecution(defID, task, config, logger)
+		c.Assert(err, qt.IsNil)
+
+		pbIn, err := structpb.NewStruct(in)
+		c.Assert(err, qt.IsNil)
+
+		got, err := exec.Execute([]*structpb.Struct{pbIn})
+		if err != nil {
+			return nil, err
+		}
+
+		return got[0].AsMap(), nil
+	}
+
+	c.Run("ok - submit", func(c *qt.C) {
+		requests := make([]any, 3)
+		for i := range requests {
+			requests[i] = map[string]any{"model": "gpt-3.5-turbo", "prompt": fmt.Sprintf("Prompt %d", i)}
+		}
+
+		got, err := execute(c, batchSubmitTask, map[string]any{
+			"endpoint": completionsPath,
+			"requests": requests,
+			"metadata": map[string]any{"job": "nightly"},
+		})
+		c.Assert(err, qt.IsNil)
+		c.Check(got, qt.ContentEquals, map[string]any{
+			"batch_id":      batchID,
+			"input_file_id": inputFileID,
+			"status":        "validating",
+		})
+	})
+
+	c.Run("nok - submit unsupported endpoint", func(c *qt.C) {
+		_, err := execute(c, batchSubmitTask, map[string]any{
+			"endpoint": "/v1/moderations",
+			"requests": []any{map[string]any{"input": "foo"}},
+		})
+		c.Check(err, qt.IsNotNil)
+		c.Check(errmsg.Message(err), qt.Equals, "Request 0 is invalid. Batches aren't supported for the /v1/moderations endpoint.")
+	})
+
+	c.Run("ok - status", func(c *qt.C) {
+		statusCalls = 0
+
+		got, err := execute(c, batchStatusTask, map[string]any{"batch_id": batchID})
+		c.Assert(err, qt.IsNil)
+		c.Check(got, qt.ContentEquals, map[string]any{
+			"batch_id":       batchID,
+			"status":         "in_progress",
+			"output_file_id": outputFileID,
+			"error_file_id":  errorFileID,
+			"request_counts": map[string]any{"total": 4.0, "completed": 2.0, "failed": 1.0},
+		})
+	})
+
+	c.Run("nok - results not finished", func(c *qt.C) {
+		statusCalls = 0
+
+		_, err := execute(c, batchResultsTask, map[string]any{"batch_id": batchID})
+		c.Check(err, qt.IsNotNil)
+		c.Check(errmsg.Message(err), qt.Equals, "The batch is still in progress. Try again later or increase the wait timeout.")
+	})
+
+	c.Run("ok - results", func(c *qt.C) {
+		statusCalls = 0
+
+		got, err := execute(c, batchResultsTask, map[string]any{"batch_id": batchID, "wait_timeout": 60})
+		c.Assert(err, qt.IsNil)
+		c.Check(statusCalls, qt.Equals, 3)
+		c.Check(got["status"], qt.Equals, batchStatusCompleted)
+
+		c.Check(got["total"], qt.Equals, 4.0)
+		c.Check(got["next_offset"], qt.IsNil)
+
+		results := got["results"].([]any)
+		c.Assert(results, qt.HasLen, 4)
+
+		for _, i := range []int{0, 2} {
+			result := results[i].(map[string]any)
+			c.Check(result["custom_id"], qt.Equals, fmt.Sprintf("request-%d", i))
+			c.Check(result["error"], qt.IsNil)
+
+			output := result["output"].(map[string]any)
+			c.Check(output["texts"], qt.DeepEquals, []any{fmt.Sprintf("Answer %d", i)})
+			c.Check(output["finish_reasons"], qt.DeepEquals, []any{"stop"})
+		}
+
+		c.Check(results[1], qt.ContentEquals, map[string]any{
+			"custom_id": "request-1",
+			"error":     map[string]any{"code": "INVALID_ARGUMENT", "message": "Invalid model."},
+		})
+		c.Check(results[3], qt.ContentEquals, map[string]any{
+			"custom_id": "request-3",
+			"error": map[string]any{
+				"code":    "ABORTED",
+				"message": "The request wasn't processed, the batch is completed.",
+			},
+		})
+	})
+
+	c.Run("ok - results pages", func(c *qt.C) {
+		statusCalls = 2
+
+		customIDs := func(results any) []string {
+			var ids []string
+			for _, r := range results.([]any) {
+				ids = append(ids, r.(map[string]any)["custom_id"].(string))
+			}
+			return ids
+		}
+
+		got, err := execute(c, batchResultsTask, map[string]any{"batch_id": batchID, "limit": 3})
+		c.Assert(err, qt.IsNil)
+		c.Check(got["total"], qt.Equals, 4.0)
+		c.Check(got["next_offset"], qt.Equals, 3.0)
+		c.Check(customIDs(got["results"]), qt.DeepEquals, []string{"request-0", "request-1", "request-2"})
+
+		got, err = execute(c, batchResultsTask, map[string]any{"batch_id": batchID, "offset": 3, "limit": 3})
+		c.Assert(err, qt.IsNil)
+		c.Check(got["next_offset"], qt.IsNil)
+		c.Check(customIDs(got["results"]), qt.DeepEquals, []string{"request-3"})
+
+		// Pages past the end are empty.
+		got, err = execute(c, batchResultsTask, map[string]any{"batch_id": batchID, "offset": 10})
+		c.Assert(err, qt.IsNil)
+		c.Check(got["results"], qt.DeepEquals, []any{})
+	})
+}
+
+func TestConnector_ExecuteImageEdit(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	buf := new(bytes.Buffer)
+	c.Assert(png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 2, 2))), qt.IsNil)
+	pngImg := buf.Bytes()
+	b64Img := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngImg)
+
+	testcases := []struct {
+		name      string
+		task      string
+		in        map[string]any
+		wantPath  string
+		wantForm  map[string]string
+		wantFiles []string
+	}{
+		{
+			name: "ok - edit",
+			task: imageEditTask,
+			in: map[string]any{
+				"model":  "dall-e-2",
+				"image":  b64Img,
+				"mask":   b64Img,
+				"prompt": "A cute baby sea otter wearing a beret",
+				"n":      2,
+				"size":   "256x256",
+			},
+			wantPath: imgEditsPath,
+			wantForm: map[string]string{
+				"model":           "dall-e-2",
+				"prompt":          "A cute baby sea otter wearing a beret",
+				"n":               "2",
+				"size":            "256x256",
+				"response_format": "b64_json",
+			},
+			wantFiles: []string{"image", "mask"},
+		},
+		{
+			name: "ok - variation",
+			task: imageVariationTask,
+			in: map[string]any{
+				"model": "dall-e-2",
+				"image": b64Img,
+			},
+			wantPath: imgVariationsPath,
+			wantForm: map[string]string{
+				"model":           "dall-e-2",
+				"response_format": "b64_json",
+			},
+			wantFiles: []string{"image"},
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c.Check(r.Method, qt.Equals, http.MethodPost)
+				c.Check(r.URL.Path, qt.Equals, tc.wantPath)
+
+				c.Assert(r.ParseMultipartForm(1<<20), qt.IsNil)
+				form := map[string]string{}
+				for k, v := range r.MultipartForm.Value {
+					form[k] = v[0]
+				}
+				c.Check(form, qt.DeepEquals, tc.wantForm)
+
+				files := []string{}
+				for k, fhs := range r.MultipartForm.File {
+					c.Check(fhs[0].Filename, qt.Equals, "file.png")
+					files = append(files, k)
+				}
+				c.Check(files, qt.ContentEquals, tc.wantFiles)
+
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				fmt.Fprintf(w, `{"data": [{"b64_json": %q}]}`, base64.StdEncoding.EncodeToString(pngImg))
+			})
+
+			openAIServer := httptest.NewServer(h)
+			c.Cleanup(openAIServer.Close)
+
+			config, err := structpb.NewStruct(map[string]any{
+				"base_path": openAIServer.URL,
+				"api_key":   apiKey,
+			})
+			c.Assert(err, qt.IsNil)
+
+			exec, err := connector.CreateExecution(defID, tc.task, config, logger)
+			c.Assert(err, qt.IsNil)
+
+			pbIn, err := structpb.NewStruct(tc.in)
+			c.Assert(err, qt.IsNil)
+
+			got, err := exec.Execute([]*structpb.Struct{pbIn})
+			c.Assert(err, qt.IsNil)
+			c.Check(got[0].AsMap(), qt.ContentEquals, map[string]any{
+				"results": []any{map[string]any{"image": b64Img, "revised_prompt": ""}},
+			})
+		})
+	}
+
+	c.Run("nok - unsupported image format", func(c *qt.C) {
+		exec, err := connector.CreateExecution(defID, imageVariationTask, new(structpb.Struct), logger)
+		c.Assert(err, qt.IsNil)
+
+		pbIn, err := structpb.NewStruct(map[string]any{
+			"image": base64.StdEncoding.EncodeToString([]byte("GIF89a")),
+		})
+		c.Assert(err, qt.IsNil)
+
+		_, err = exec.Execute([]*structpb.Struct{pbIn})
+		c.Check(err, qt.IsNotNil)
+		c.Check(errmsg.Message(err), qt.Equals, "The image format (image/gif) isn't supported. Use a PNG image.")
+	})
+}
+
+func TestConnector_ExecuteModeration(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	const imgURL = "https://example.com/image.png"
+	moderationResp := `{
+  "results": [{
+    "flagged": true,
+    "categories": {"violence": true, "self-harm/intent": false},
+    "category_scores": {"violence": 0.9, "self-harm/intent": 0.01}
+  }]
+}`
+
+	testcases := []struct {
+		name    string
+		in      map[string]any
+		wantReq map[string]any
+	}{
+		{
+			name:    "ok - text",
+			in:      map[string]any{"model": "text-moderation-latest", "text": "I want to kill them."},
+			wantReq: map[string]any{"model": "text-moderation-latest", "input": "I want to kill them."},
+		},
+		{
+			name: "ok - text and images",
+			in: map[string]any{
+				"model":  "omni-moderation-latest",
+				"text":   "I want to kill them.",
+				"images": []any{imgURL},
+			},
+			wantReq: map[string]any{
+				"model": "omni-moderation-latest",
+				"input": []any{
+					map[string]any{"type": "text", "text": "I want to kill them."},
+					map[string]any{"type": "image_url", "image_url": map[string]any{"url": imgURL}},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c.Check(r.Method, qt.Equals, http.MethodPost)
+				c.Check(r.URL.Path, qt.Equals, moderationsPath)
+
+				var req map[string]any
+				c.Assert(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
+				c.Check(req, qt.DeepEquals, tc.wantReq)
+
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				fmt.Fprintln(w, moderationResp)
+			})
+
+			openAIServer := httptest.NewServer(h)
+			c.Cleanup(openAIServer.Close)
+
+			config, err := structpb.NewStruct(map[string]any{
+				"base_path": openAIServer.URL,
+				"api_key":   apiKey,
+			})
+			c.Assert(err, qt.IsNil)
+
+			exec, err := connector.CreateExecution(defID, moderationTask, config, logger)
+			c.Assert(err, qt.IsNil)
+
+			pbIn, err := structpb.NewStruct(tc.in)
+			c.Assert(err, qt.IsNil)
+
+			got, err := exec.Execute([]*structpb.Struct{pbIn})
+			c.Assert(err, qt.IsNil)
+			c.Check(got[0].AsMap(), qt.DeepEquals, map[string]any{
+				"flagged":         true,
+				"categories":      map[string]any{"violence": true, "self_harm_intent": false},
+				"category_scores": map[string]any{"violence": 0.9, "self_harm_intent": 0.01},
+			})
+		})
+	}
+
+	c.Run("nok - images with text model", func(c *qt.C) {
+		exec, err := connector.CreateExecution(defID, moderationTask, new(structpb.Struct), logger)
+		c.Assert(err, qt.IsNil)
+
+		pbIn, err := structpb.NewStruct(map[string]any{
+			"model":  "text-moderation-stable",
+			"images": []any{imgURL},
+		})
+		c.Assert(err, qt.IsNil)
+
+		_, err = exec.Execute([]*structpb.Struct{pbIn})
+		c.Check(err, qt.IsNotNil)
+		c.Check(errmsg.Message(err), qt.Equals, "The text-moderation-stable model can only classify text. Use an omni-moderation model to classify images.")
+	})
+}
+
+func TestConnector_ExecuteAudio(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	// wav builds an 8-bit mono WAV file of 1000 samples per second, so the
+	// duration of the audio is its number of samples in milliseconds.
+	wav := func(samples int) []byte {
+		b := new(bytes.Buffer)
+		b.WriteString("RIFF")
+		_ = binary.Write(b, binary.LittleEndian, uint32(36+samples))
+		b.WriteString("WAVEfmt ")
+		for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(1000), uint32(1000), uint16(1), uint16(8)} {
+			_ = binary.Write(b, binary.LittleEndian, v)
+		}
+		b.WriteString("data")
+		_ = binary.Write(b, binary.LittleEndian, uint32(samples))
+		b.Write(make([]byte, samples))
+		return b.Bytes()
+	}
+
+	// The chunks of the test audio have 1000 samples, i.e. 1 second.
+	const maxSize = 44 + 1000
+
+	testcases := []struct {
+		name      string
+		task      string
+		in        map[string]any
+		wantPath  string
+		wantForm  map[string]any
+		wantCalls int
+		want      map[string]any
+	}{
+		{
+			name: "ok - transcription with timestamps",
+			task: speechRecognitionTask,
+			in: map[string]any{
+				"model":                   "whisper-1",
+				"audio":                   base64.StdEncoding.EncodeToString(wav(500)),
+				"timestamp_granularities": []any{"word", "segment"},
+			},
+			wantPath: transcriptionsPath,
+			wantForm: map[string]any{
+				"model":                     []string{"whisper-1"},
+				"response_format":           []string{audioFormatVerboseJSON},
+				"timestamp_granularities[]": []string{"word", "segment"},
+			},
+			wantCalls: 1,
+			want: map[string]any{
+				"text":     " chunk 0",
+				"language": "english",
+				"duration": 0.5,
+				"segments": []any{map[string]any{"id": 0.0, "start": 0.0, "end": 0.5, "text": " chunk 0"}},
+				"words":    []any{map[string]any{"word": "chunk", "start": 0.0, "end": 0.25}},
+			},
+		},
+		{
+			name: "ok - chunked translation as subtitles",
+			task: speechTranslationTask,
+			in: map[string]any{
+				"model":           "whisper-1",
+				"audio":           base64.StdEncoding.EncodeToString(wav(2500)),
+				"response_format": audioFormatSRT,
+			},
+			wantPath: translationsPath,
+			wantForm: map[string]any{
+				"model":           []string{"whisper-1"},
+				"response_format": []string{audioFormatVerboseJSON},
+			},
+			wantCalls: 3,
+			want: map[string]any{
+				"text": "1\n00:00:00,000 --> 00:00:01,000\nchunk 0\n\n" +
+					"2\n00:00:01,000 --> 00:00:02,000\nchunk 1\n\n" +
+					"3\n00:00:02,000 --> 00:00:02,500\nchunk 2\n\n",
+			},
+		},
+		{
+			name: "ok - chunked transcription as text",
+			task: speechRecognitionTask,
+			in: map[string]any{
+				"model": "whisper-1",
+				"audio": base64.StdEncoding.EncodeToString(wav(1500)),
+			},
+			wantPath: transcriptionsPath,
+			wantForm: map[string]any{
+				"model":           []string{"whisper-1"},
+				"response_format": []string{audioFormatVerboseJSON},
+			},
+			wantCalls: 2,
+			want:      map[string]any{"text": "chunk 0 chunk 1"},
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			c.Parallel()
+
+			var calls int
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c.Check(r.URL.Path, qt.Equals, tc.wantPath)
+
+				c.Assert(r.ParseMultipartForm(1<<20), qt.IsNil)
+				form := map[string]any{}
+				for k, v := range r.MultipartForm.Value {
+					form[k] = v
+				}
+				c.Check(form, qt.DeepEquals, tc.wantForm)
+
+				f, _, err := r.FormFile("file")
+				c.Assert(err, qt.IsNil)
+				audio, err := io.ReadAll(f)
+				c.Assert(err, qt.IsNil)
+				c.Check(len(audio) <= maxSize, qt.IsTrue)
+				c.Check(string(audio[:4]), qt.Equals, "RIFF")
+
+				// The chunk duration is derived from its data size.
+				duration := float64(binary.LittleEndian.Uint32(audio[40:44])) / 1000
+				text := fmt.Sprintf(" chunk %d", calls)
+				calls++
+
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				c.Check(json.NewEncoder(w).Encode(AudioTranscriptionResp{
+					Text:     text,
+					Language: "english",
+					Duration: duration,
+					Segments: []TranscriptionSegment{{Start: 0, End: duration, Text: text}},
+					Words:    []TranscriptionWord{{Word: "chunk", Start: 0, End: duration / 2}},
+				}), qt.IsNil)
+			})
+
+			openAIServer := httptest.NewServer(h)
+			c.Cleanup(openAIServer.Close)
+
+			config, err := structpb.NewStruct(map[string]any{
+				"base_path": openAIServer.URL,
+				"api_key":   apiKey,
+			})
+			c.Assert(err, qt.IsNil)
+
+			exec, err := connector.CreateExecution(defID, tc.task, config, logger)
+			c.Assert(err, qt.IsNil)
+			exec.(*Execution).maxAudioSize = maxSize
+
+			pbIn, err := structpb.NewStruct(tc.in)
+			c.Assert(err, qt.IsNil)
+
+			got, err := exec.Execute([]*structpb.Struct{pbIn})
+			c.Assert(err, qt.IsNil)
+			c.Check(calls, qt.Equals, tc.wantCalls)
+			c.Check(got[0].AsMap(), qt.DeepEquals, tc.want)
+		})
+	}
+
+	c.Run("nok - timestamps without verbose format", func(c *qt.C) {
+		exec, err := connector.CreateExecution(defID, speechRecognitionTask, new(structpb.Struct), logger)
+		c.Assert(err, qt.IsNil)
+
+		pbIn, err := structpb.NewStruct(map[string]any{
+			"response_format":         audioFormatSRT,
+			"timestamp_granularities": []any{"word"},
+		})
+		c.Assert(err, qt.IsNil)
+
+		_, err = exec.Execute([]*structpb.Struct{pbIn})
+		c.Check(err, qt.IsNotNil)
+		c.Check(errmsg.Message(err), qt.Equals, "Timestamp granularities require the verbose_json response format.")
+	})
+
+	c.Run("nok - unknown translation format", func(c *qt.C) {
+		exec, err := connector.CreateExecution(defID, speechTranslationTask, new(structpb.Struct), logger)
+		c.Assert(err, qt.IsNil)
+
+		pbIn, err := structpb.NewStruct(map[string]any{
+			"model":           "whisper-1",
+			"audio":           base64.StdEncoding.EncodeToString(wav(500)),
+			"response_format": "docx",
+		})
+		c.Assert(err, qt.IsNil)
+
+		_, err = exec.ExecuteWithValidation([]*structpb.Struct{pbIn})
+		c.Check(err, qt.ErrorMatches, `inputs\[0\]\.response_format: .*`)
+	})
+
+	c.Run("nok - large audio can't be split", func(c *qt.C) {
+		exec, err := connector.CreateExecution(defID, speechRecognitionTask, new(structpb.Struct), logger)
+		c.Assert(err, qt.IsNil)
+
+		exec.(*Execution).maxAudioSize = maxSize
+
+		pbIn, err := structpb.NewStruct(map[string]any{
+			"audio": base64.StdEncoding.EncodeToString(append([]byte("OggS"), make([]byte, maxSize)...)),
+		})
+		c.Assert(err, qt.IsNil)
+
+		_, err = exec.Execute([]*structpb.Struct{pbIn})
+		c.Check(err, qt.IsNotNil)
+		c.Check(errmsg.Message(err), qt.Matches, "The audio size .* exceeds the 0 MB limit. Only WAV and MP3 files can be split automatically.*")
+	})
+}
+
+func TestMP3FrameSize(t *testing.T) {
+	c := qt.New(t)
+	c.Parallel()
+
+	testcases := []struct {
+		name   string
+		header []byte
+		want   int
+	}{
+		{name: "MPEG-1 layer III", header: []byte{0xFF, 0xFB, 0x90, 0x00}, want: 417},
+		{name: "MPEG-1 layer III with padding", header: []byte{0xFF, 0xFB, 0x92, 0x00}, want: 418},
+		{name: "MPEG-2 layer III", header: []byte{0xFF, 0xF3, 0x90, 0x00}, want: 261},
+		{name: "MPEG-1 layer I", header: []byte{0xFF, 0xFF, 0x90, 0x00}, want: 312},
+		{name: "bad bitrate", header: []byte{0xFF, 0xFB, 0xF0, 0x00}, want: 0},
+		{name: "free format", header: []byte{0xFF, 0xFB, 0x00, 0x00}, want: 0},
+		{name: "no sync", header: []byte("ID3\x04"), want: 0},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			c.Check(mp3FrameSize(tc.header), qt.Equals, tc.want)
+		})
+	}
+}
+
+func TestSplitMP3(t *testing.T) {
+	c := qt.New(t)
+	c.Parallel()
+
+	frame := func(padded bool) []byte {
+		header := []byte{0xFF, 0xFB, 0x90, 0x00}
+		if padded {
+			header[2] |= 0x02
+		}
+
+		// The sync bits can appear in the audio data.
+		f := bytes.Repeat(header, 105)
+		return f[:mp3FrameSize(header)]
+	}
+
+	id3 := append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 20}, make([]byte, 20)...)
+	mp3 := bytes.Clone(id3)
+	for i := 0; i < 5; i++ {
+		mp3 = append(mp3, frame(i%2 == 1)...)
+	}
+	mp3 = append(mp3, append([]byte("TAG"), make([]byte, 125)...)...)
+
+	chunks, err := splitMP3(mp3, 1000)
+	c.Assert(err, qt.IsNil)
+	c.Assert(chunks, qt.HasLen, 3)
+	c.Check(bytes.Join(chunks, nil), qt.DeepEquals, mp3)
+	for i, want := range []int{30 + 417 + 418, 417 + 418, 417 + 128} {
+		c.Check(chunks[i], qt.HasLen, want)
+	}
+	c.Check(bytes.HasPrefix(chunks[0], id3), qt.IsTrue)
+	c.Check(mp3FrameSize(chunks[1]), qt.Equals, 417)
+	c.Check(mp3FrameSize(chunks[2]), qt.Equals, 417)
+
+	// Frames can't be split.
+	_, err = splitMP3(mp3, 400)
+	c.Check(err, qt.ErrorMatches, "no MP3 frame boundary in chunk starting at byte 0")
+}
+
+func TestConnector_GetConnectorDefinition(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+
+	// modelEnum returns the model enum of a task in the component
+	// specification of a definition.
+	modelEnum := func(def *pipelinePB.ConnectorDefinition, task string) []any {
+		for _, sch := range def.Spec.ComponentSpecification.Fields["oneOf"].GetListValue().Values {
+			props := sch.GetStructValue().AsMap()["properties"].(map[string]any)
+			if props["task"].(map[string]any)["const"] != task {
+				continue
+			}
+
+			model := props["input"].(map[string]any)["properties"].(map[string]any)["model"].(map[string]any)
+			return model["anyOf"].([]any)[0].(map[string]any)["enum"].([]any)
+		}
+
+		return nil
+	}
+
+	def, err := connector.GetConnectorDefinitionByID("openai", nil, nil)
+	c.Assert(err, qt.IsNil)
+	wantEmbeddings := modelEnum(def, textEmbeddingsTask)
+
+	c.Run("ok - models from API", func(c *qt.C) {
+		var calls int
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Check(r.URL.Path, qt.Equals, listModelsPath)
+			c.Check(r.Header.Get("Authorization"), qt.Equals, "Bearer "+apiKey)
+			calls++
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			fmt.Fprintln(w, `{"data": [{"id": "gpt-5"}, {"id": "gpt-3.5-turbo"}, {"id": "gpt-4o-mini-tts"}, {"id": "whisper-2"}, {"id": "gpt-image-1"}]}`)
+		})
+
+		openAIServer := httptest.NewServer(h)
+		c.Cleanup(openAIServer.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"base_path": openAIServer.URL,
+			"api_key":   apiKey,
+		})
+		c.Assert(err, qt.IsNil)
+
+		for i := 0; i < 2; i++ {
+			def, err := connector.GetConnectorDefinitionByID("openai", config, nil)
+			c.Assert(err, qt.IsNil)
+
+			enum := modelEnum(def, textGenerationTask)
+			c.Check(enum, qt.Contains, "gpt-5")
+			c.Check(enum, qt.Not(qt.Contains), "gpt-4o-mini-tts")
+
+			// Embedded models aren't duplicated.
+			var n int
+			for _, m := range enum {
+				if m == "gpt-3.5-turbo" {
+					n++
+				}
+			}
+			c.Check(n, qt.Equals, 1)
+
+			c.Check(modelEnum(def, speechRecognitionTask), qt.DeepEquals, []any{"whisper-1", "whisper-2"})
+			c.Check(modelEnum(def, textToImageTask), qt.Not(qt.Contains), "gpt-image-1")
+			c.Check(modelEnum(def, textEmbeddingsTask), qt.DeepEquals, wantEmbeddings)
+		}
+
+		// The models are cached.
+		c.Check(calls, qt.Equals, 1)
+
+		// The embedded definition isn't modified.
+		def, err := connector.GetConnectorDefinitionByID("openai", nil, nil)
+		c.Assert(err, qt.IsNil)
+		c.Check(modelEnum(def, textGenerationTask), qt.Not(qt.Contains), "gpt-5")
+	})
+
+	c.Run("ok - embedded models when offline", func(c *qt.C) {
+		var calls int
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, errResp)
+		})
+
+		openAIServer := httptest.NewServer(h)
+		c.Cleanup(openAIServer.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"base_path": openAIServer.URL,
+			"api_key":   apiKey,
+		})
+		c.Assert(err, qt.IsNil)
+
+		for i := 0; i < 2; i++ {
+			def, err := connector.GetConnectorDefinitionByID("openai", config, nil)
+			c.Assert(err, qt.IsNil)
+
+			c.Check(modelEnum(def, textEmbeddingsTask), qt.DeepEquals, wantEmbeddings)
+		}
+
+		// The listing isn't retried and its failure is cached.
+		c.Check(calls, qt.Equals, 1)
+	})
+
+	c.Run("ok - concurrent definitions share the listing", func(c *qt.C) {
+		var calls atomic.Int32
+		release := make(chan struct{})
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			<-release
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			fmt.Fprintln(w, `{"data": [{"id": "text-embedding-4"}]}`)
+		})
+
+		openAIServer := httptest.NewServer(h)
+		c.Cleanup(openAIServer.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"base_path": openAIServer.URL,
+			"api_key":   apiKey,
+		})
+		c.Assert(err, qt.IsNil)
+
+		const n = 4
+		enums := make(chan []any, n)
+		for i := 0; i < n; i++ {
+			go func() {
+				def, err := connector.GetConnectorDefinitionByID("openai", config, nil)
+				c.Check(err, qt.IsNil)
+				enums <- modelEnum(def, textEmbeddingsTask)
+			}()
+		}
+
+		// Let the callers reach the cache before the listing is answered.
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+
+		for i := 0; i < n; i++ {
+			c.Check(<-enums, qt.Contains, "text-embedding-4")
+		}
+		c.Check(calls.Load(), qt.Equals, int32(1))
+	})
+
+	c.Run("ok - available models outside the enum are executed", func(c *qt.C) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			if r.URL.Path == listModelsPath {
+				fmt.Fprintln(w, `{"data": [{"id": "text-embedding-4"}, {"id": "whisper-2"}]}`)
+				return
+			}
+
+			var req TextEmbeddingsReq
+			c.Assert(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
+			c.Check(req.Model, qt.Equals, "text-embedding-4")
+
+			fmt.Fprintln(w, `{"data": [{"index": 0, "embedding": [0.5]}]}`)
+		})
+
+		openAIServer := httptest.NewServer(h)
+		c.Cleanup(openAIServer.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"base_path": openAIServer.URL,
+			"api_key":   apiKey,
+		})
+		c.Assert(err, qt.IsNil)
+
+		exec, err := connector.CreateExecution(uuid.Must(uuid.NewV4()), textEmbeddingsTask, config, logger)
+		c.Assert(err, qt.IsNil)
+
+		pbIn, err := structpb.NewStruct(map[string]any{"model": "text-embedding-4", "text": "foo"})
+		c.Assert(err, qt.IsNil)
+
+		got, err := exec.ExecuteWithValidation([]*structpb.Struct{pbIn})
+		c.Assert(err, qt.IsNil)
+		c.Check(got[0].AsMap()["embedding"], qt.DeepEquals, []any{0.5})
+
+		// Models that are neither embedded nor available are rejected.
+		pbIn.Fields["model"] = structpb.NewStringValue("text-embedding-5")
+		_, err = exec.ExecuteWithValidation([]*structpb.Struct{pbIn})
+		c.Check(err, qt.ErrorMatches, `inputs\[0\]\.model: model "text-embedding-5" isn't available`)
+
+		// So are the available models of other tasks.
+		pbIn.Fields["model"] = structpb.NewStringValue("whisper-2")
+		_, err = exec.ExecuteWithValidation([]*structpb.Struct{pbIn})
+		c.Check(err, qt.ErrorMatches, `inputs\[0\]\.model: model "whisper-2" isn't available`)
+	})
+
+	c.Run("nok - only embedded models when offline", func(c *qt.C) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Check(r.URL.Path, qt.Equals, listModelsPath)
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, errResp)
+		})
+
+		openAIServer := httptest.NewServer(h)
+		c.Cleanup(openAIServer.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"base_path": openAIServer.URL,
+			"api_key":   apiKey,
+		})
+		c.Assert(err, qt.IsNil)
+
+		exec, err := connector.CreateExecution(uuid.Must(uuid.NewV4()), textEmbeddingsTask, config, logger)
+		c.Assert(err, qt.IsNil)
+
+		inputs := make([]*structpb.Struct, 2)
+		for i, model := range []string{"text-embedding-3-small", "text-embedding-4"} {
+			inputs[i], err = structpb.NewStruct(map[string]any{"model": model, "text": "foo"})
+			c.Assert(err, qt.IsNil)
+		}
+
+		_, err = exec.ExecuteWithValidation(inputs)
+		c.Check(err, qt.ErrorMatches, `inputs\[1\]\.model: model "text-embedding-4" isn't available`)
+	})
+}
+
+func TestConnector_ExecuteProviders(t *testing.T) {
+	c := qt.New(t)
+
+	logger := zap.NewNop()
+	connector := Init(logger)
+	defID := uuid.Must(uuid.NewV4())
+
+	testcases := []struct {
+		name      string
+		config    map[string]any
+		basePath  string
+		task      string
+		in        map[string]any
+		wantPath  string
+		wantQuery string
+		wantAuth  map[string]string
+	}{
+		{
+			name:     "ok - openai",
+			config:   map[string]any{"provider": providerOpenAI, "base_url": "https://ignored.com"},
+			task:     textGenerationTask,
+			in:       map[string]any{"model": "gpt-4", "prompt": "Hi"},
+			wantPath: completionsPath,
+			wantAuth: map[string]string{"Authorization": "Bearer " + apiKey, "Api-Key": ""},
+		},
+		{
+			name: "ok - azure deployment",
+			config: map[string]any{
+				"provider":    providerAzure,
+				"deployments": map[string]any{"gpt-4": "prod-gpt4"},
+			},
+			task:      textGenerationTask,
+			in:        map[string]any{"model": "gpt-4", "prompt": "Hi"},
+			wantPath:  "/openai/deployments/prod-gpt4/chat/completions",
+			wantQuery: "api-version=" + defaultAzureAPIVersion,
+			wantAuth:  map[string]string{"Authorization": "", "Api-Key": apiKey},
+		},
+		{
+			name: "ok - azure model without mapping",
+			config: map[string]any{
+				"provider":    providerAzure,
+				"api_version": "2024-10-21",
+				"deployments": map[string]any{"gpt-4": "prod-gpt4"},
+			},
+			task:      textEmbeddingsTask,
+			in:        map[string]any{"model": "text-embedding-3-small", "text": "Hi"},
+			wantPath:  "/openai/deployments/text-embedding-3-small/embeddings",
+			wantQuery: "api-version=2024-10-21",
+			wantAuth:  map[string]string{"Authorization": "", "Api-Key": apiKey},
+		},
+		{
+			name:     "ok - compatible with version prefix",
+			config:   map[string]any{"provider": providerCompatible},
+			basePath: "/v1",
+			task:     textGenerationTask,
+			in:       map[string]any{"model": "meta-llama/Llama-3-8B", "prompt": "Hi"},
+			wantPath: completionsPath,
+			wantAuth: map[string]string{"Authorization": "Bearer " + apiKey},
+		},
+		{
+			name:     "ok - compatible without version prefix",
+			config:   map[string]any{"provider": providerCompatible},
+			task:     textGenerationTask,
+			in:       map[string]any{"model": "meta-llama/Llama-3-8B", "prompt": "Hi"},
+			wantPath: completionsPath,
+			wantAuth: map[string]string{"Authorization": "Bearer " + apiKey},
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c.Check(r.URL.Path, qt.Equals, tc.wantPath)
+				c.Check(r.URL.RawQuery, qt.Equals, tc.wantQuery)
+				for k, v := range tc.wantAuth {
+					c.Check(r.Header.Get(k), qt.Equals, v)
+				}
+
+				w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+				fmt.Fprintln(w, `{
+  "choices": [{"message": {"content": "Hello"}, "finish_reason": "stop"}],
+  "data": [{"index": 0, "embedding": [0.5]}]
+}`)
+			})
+
+			openAIServer := httptest.NewServer(h)
+			c.Cleanup(openAIServer.Close)
+
+			cfg := map[string]any{"api_key": apiKey}
+			for k, v := range tc.config {
+				cfg[k] = v
+			}
+			if _, ok := cfg["base_url"]; ok {
+				cfg["base_path"] = openAIServer.URL + tc.basePath
+			} else {
+				cfg["base_url"] = openAIServer.URL + tc.basePath
+			}
+
+			config, err := structpb.NewStruct(cfg)
+			c.Assert(err, qt.IsNil)
+
+			exec, err := connector.CreateExecution(defID, tc.task, config, logger)
+			c.Assert(err, qt.IsNil)
+
+			pbIn, err := structpb.NewStruct(tc.in)
+			c.Assert(err, qt.IsNil)
+
+			_, err = exec.Execute([]*structpb.Struct{pbIn})
+			c.Check(err, qt.IsNil)
+		})
+	}
+
+	for _, provider := range []string{providerAzure, providerCompatible} {
+		c.Run("nok - "+provider+" without base URL", func(c *qt.C) {
+			config, err := structpb.NewStruct(map[string]any{
+				"provider": provider,
+				"api_key":  apiKey,
+			})
+			c.Assert(err, qt.IsNil)
+
+			wantMsg := fmt.Sprintf("The %s provider requires a base URL. Set it in the connector configuration.", provider)
+
+			_, err = connector.CreateExecution(defID, textGenerationTask, config, logger)
+			c.Check(err, qt.IsNotNil)
+			c.Check(errmsg.Message(err), qt.Equals, wantMsg)
+
+			got, err := connector.Test(defID, config, logger)
+			c.Check(err, qt.IsNotNil)
+			c.Check(errmsg.Message(err), qt.Equals, wantMsg)
+			c.Check(got, qt.Equals, pipelinePB.Connector_STATE_ERROR)
+		})
+	}
+
+	c.Run("ok - azure connection test", func(c *qt.C) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Check(r.URL.Path, qt.Equals, "/openai/models")
+			c.Check(r.URL.Query().Get("api-version"), qt.Equals, defaultAzureAPIVersion)
+			c.Check(r.Header.Get("Api-Key"), qt.Equals, apiKey)
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			fmt.Fprintln(w, `{"data": [{"id": "gpt-4"}]}`)
+		})
+
+		openAIServer := httptest.NewServer(h)
+		c.Cleanup(openAIServer.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"provider": providerAzure,
+			"base_url": openAIServer.URL,
+			"api_key":  apiKey,
 		})
 		c.Assert(err, qt.IsNil)
 
@@ -0,0 +1,102 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"strconv"
+
+	"github.com/gabriel-vasile/mimetype"
+
+	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
+	"github.com/instill-ai/x/errmsg"
+)
+
+const (
+	imgEditsPath      = "/v1/images/edits"
+	imgVariationsPath = "/v1/images/variations"
+
+	// maxEditImageSize is the maximum size of the images in an edit or
+	// variation request.
+	maxEditImageSize = 4 << 20
+)
+
+type ImageEditInput struct {
+	Image  string  `json:"image"`
+	Mask   string  `json:"mask"`
+	Prompt string  `json:"prompt"`
+	Model  string  `json:"model"`
+	N      *int    `json:"n,omitempty"`
+	Size   *string `json:"size,omitempty"`
+}
+
+type ImageVariationInput struct {
+	Image string  `json:"image"`
+	Model string  `json:"model"`
+	N     *int    `json:"n,omitempty"`
+	Size  *string `json:"size,omitempty"`
+}
+
+// ImageEditReq holds the fields of an image edit or variation request.
+// Variations don't have a prompt or a mask.
+type ImageEditReq struct {
+	Image  []byte
+	Mask   []byte
+	Prompt string
+	Model  string
+	N      *int
+	Size   *string
+}
+
+// decodePNG decodes a base64-encoded image, checking that it meets the
+// requirements of the edit and variation endpoints.
+func decodePNG(name, image string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(image))
+	if err != nil {
+		return nil, errmsg.AddMessage(err, fmt.Sprintf("The %s must be a base64-encoded file.", name))
+	}
+
+	if len(b) > maxEditImageSize {
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("%s too large: %d bytes", name, len(b)),
+			fmt.Sprintf("The %s size (%.1f MB) exceeds the %d MB limit.", name, float64(len(b))/(1<<20), maxEditImageSize>>20),
+		)
+	}
+
+	if mimeType := mimetype.Detect(b).String(); mimeType != "image/png" {
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("unsupported %s type: %s", name, mimeType),
+			fmt.Sprintf("The %s format (%s) isn't supported. Use a PNG image.", name, mimeType),
+		)
+	}
+
+	return b, nil
+}
+
+func getImageEditBytes(req ImageEditReq) (*bytes.Reader, string, error) {
+	data := &bytes.Buffer{}
+	writer := multipart.NewWriter(data)
+	err := util.WriteFile(writer, "image", req.Image)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(req.Mask) > 0 {
+		err := util.WriteFile(writer, "mask", req.Mask)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	util.WriteField(writer, "prompt", req.Prompt)
+	util.WriteField(writer, "model", req.Model)
+	if req.N != nil {
+		util.WriteField(writer, "n", strconv.Itoa(*req.N))
+	}
+	if req.Size != nil {
+		util.WriteField(writer, "size", *req.Size)
+	}
+	util.WriteField(writer, "response_format", "b64_json")
+	writer.Close()
+	return bytes.NewReader(data.Bytes()), writer.FormDataContentType(), nil
+}
@@ -1,5 +1,25 @@
 package openai
 
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
+)
+
 const (
 	listModelsPath = "/v1/models"
 )
@@ -32,3 +52,319 @@ type ListModelsResponse struct {
 	Object string  `json:"object"`
 	Data   []Model `json:"data"`
 }
+
+const (
+	// modelsCacheTTL is the time the models available to an API key are
+	// cached for. Failures are cached for failedListTTL, so definition
+	// requests don't wait for an unavailable API every time.
+	modelsCacheTTL    = 10 * time.Minute
+	failedListTTL     = time.Minute
+	listModelsTimeout = 5 * time.Second
+)
+
+// taskModelPrefixes holds the prefixes of the model IDs that can be used in
+// each task. The models of OpenAI don't have a task, so it is inferred from
+// their family. The image tasks request the b64_json response format, which
+// the gpt-image models don't accept, so these models aren't offered.
+var taskModelPrefixes = map[string][]string{
+	textGenerationTask:    {"gpt-", "chatgpt-", "o1", "o3", "o4", "ft:gpt-"},
+	textEmbeddingsTask:    {"text-embedding-"},
+	speechRecognitionTask: {"whisper-", "gpt-4o-transcribe", "gpt-4o-mini-transcribe"},
+	speechTranslationTask: {"whisper-"},
+	textToSpeechTask:      {"tts-", "gpt-4o-mini-tts"},
+	textToImageTask:       {"dall-e-"},
+	imageEditTask:         {"dall-e-2"},
+	imageVariationTask:    {"dall-e-2"},
+	moderationTask:        {"omni-moderation-", "text-moderation-"},
+}
+
+// nonChatModelMarkers exclude from text generation the GPT models that serve
+// other tasks.
+var nonChatModelMarkers = []string{"-tts", "transcribe", "gpt-image-", "realtime", "audio", "search"}
+
+func isTaskModel(task, id string) bool {
+	if task == textGenerationTask {
+		for _, m := range nonChatModelMarkers {
+			if strings.Contains(id, m) {
+				return false
+			}
+		}
+	}
+
+	for _, p := range taskModelPrefixes[task] {
+		if strings.HasPrefix(id, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// modelsLoad is the listing of the models of an API key, shared by the
+// callers that need it while it's in flight. Its result can be read once
+// done is closed.
+type modelsLoad struct {
+	done      chan struct{}
+	ids       []string
+	err       error
+	expiresAt time.Time
+}
+
+func (l *modelsLoad) load(config *structpb.Struct, logger *zap.Logger) {
+	defer close(l.done)
+
+	l.ids, l.err = listModels(config, logger)
+	l.expiresAt = time.Now().Add(modelsCacheTTL)
+	if l.err != nil {
+		l.expiresAt = time.Now().Add(failedListTTL)
+	}
+}
+
+// expired reports whether the models should be listed again.
+func (l *modelsLoad) expired() bool {
+	select {
+	case <-l.done:
+		return !time.Now().Before(l.expiresAt)
+	default:
+		return false
+	}
+}
+
+// modelsCache holds the IDs of the models available to each API key. mu only
+// guards the map, so listing the models of a key doesn't block the other
+// ones.
+type modelsCache struct {
+	mu    sync.Mutex
+	loads map[string]*modelsLoad
+}
+
+var availableModels = &modelsCache{loads: map[string]*modelsLoad{}}
+
+// modelsCacheKey identifies the models of an account. The API key is hashed
+// so it isn't held in memory longer than the resource config.
+func modelsCacheKey(config *structpb.Struct) string {
+	h := sha256.Sum256([]byte(getBasePath(config) + "\n" + getOrg(config) + "\n" + getAPIKey(config)))
+	return hex.EncodeToString(h[:])
+}
+
+// get returns the models available to the API key of a resource config,
+// listing them if they aren't cached. Concurrent callers share the same
+// listing, which is bounded by listModelsTimeout.
+func (mc *modelsCache) get(config *structpb.Struct, logger *zap.Logger) ([]string, error) {
+	key := modelsCacheKey(config)
+
+	mc.mu.Lock()
+	l, ok := mc.loads[key]
+	if !ok || l.expired() {
+		l = &modelsLoad{done: make(chan struct{})}
+		mc.loads[key] = l
+
+		go l.load(config, logger)
+	}
+	mc.mu.Unlock()
+
+	<-l.done
+	return l.ids, l.err
+}
+
+// listModels returns the sorted IDs of the models available to the API key
+// of a resource config. The models are listed while a request waits for
+// them, so the call isn't retried nor rate limited.
+func listModels(config *structpb.Struct, logger *zap.Logger) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), listModelsTimeout)
+	defer cancel()
+
+	client, err := newProviderClient(config, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	models := ListModelsResponse{}
+	req := client.R().SetContext(ctx).SetResult(&models)
+	if _, err := req.Get(listModelsPath); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(models.Data))
+	for _, m := range models.Data {
+		ids = append(ids, m.ID)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// mergeModelEnum adds to a model enum the available models for a task.
+// The models of the original enum keep their position.
+func mergeModelEnum(enum *structpb.ListValue, task string, ids []string) {
+	known := map[string]bool{}
+	for _, v := range enum.GetValues() {
+		known[v.GetStringValue()] = true
+	}
+
+	for _, id := range ids {
+		if !known[id] && isTaskModel(task, id) {
+			enum.Values = append(enum.Values, structpb.NewStringValue(id))
+			known[id] = true
+		}
+	}
+}
+
+// addModelEnum adds the available models to the enums of the model field of
+// a task input schema. In the component specification, the enum is in the
+// value option of the field.
+func addModelEnum(schema *structpb.Struct, task string, ids []string) {
+	model := schema.GetFields()["properties"].GetStructValue().GetFields()["model"].GetStructValue()
+	if model == nil {
+		return
+	}
+
+	if enum := model.GetFields()["enum"].GetListValue(); enum != nil {
+		mergeModelEnum(enum, task, ids)
+	}
+
+	for _, opt := range model.GetFields()["anyOf"].GetListValue().GetValues() {
+		if enum := opt.GetStructValue().GetFields()["enum"].GetListValue(); enum != nil {
+			mergeModelEnum(enum, task, ids)
+		}
+	}
+}
+
+func (c *Connector) GetConnectorDefinitionByID(defID string, resourceConfig *structpb.Struct, component *pipelinePB.ConnectorComponent) (*pipelinePB.ConnectorDefinition, error) {
+	def, err := c.Connector.GetConnectorDefinitionByID(defID, resourceConfig, component)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GetConnectorDefinitionByUID(uuid.FromStringOrNil(def.Uid), resourceConfig, component)
+}
+
+// GetConnectorDefinitionByUID returns the connector definition. If a resource
+// config is provided, the model enums are extended with the models available
+// to its API key, so new models can be selected without a release. If the
+// models can't be listed, the embedded enums are returned.
+func (c *Connector) GetConnectorDefinitionByUID(defUID uuid.UUID, resourceConfig *structpb.Struct, component *pipelinePB.ConnectorComponent) (*pipelinePB.ConnectorDefinition, error) {
+	oriDef, err := c.Connector.GetConnectorDefinitionByUID(defUID, resourceConfig, component)
+	if err != nil {
+		return nil, err
+	}
+
+	if resourceConfig == nil || getAPIKey(resourceConfig) == "" {
+		return oriDef, nil
+	}
+
+	ids, err := availableModels.get(resourceConfig, c.Logger)
+	if err != nil {
+		c.Logger.Warn("Couldn't list OpenAI models, using the embedded list.", zap.Error(err))
+		return oriDef, nil
+	}
+
+	def := proto.Clone(oriDef).(*pipelinePB.ConnectorDefinition)
+	for _, sch := range def.GetSpec().GetComponentSpecification().GetFields()["oneOf"].GetListValue().GetValues() {
+		props := sch.GetStructValue().GetFields()["properties"].GetStructValue().GetFields()
+		task := props["task"].GetStructValue().GetFields()["const"].GetStringValue()
+		addModelEnum(props["input"].GetStructValue(), task, ids)
+	}
+
+	return def, nil
+}
+
+// GetTaskInputSchemas returns the input schemas the executions are validated
+// against. As the model enums can be extended with the models available to
+// an account, the schemas don't hold them. The executions validate the model
+// against the embedded enum and the models of their config instead (see
+// Execution.ExecuteWithValidation).
+func (c *Connector) GetTaskInputSchemas() map[string]string {
+	c.inputSchemasOnce.Do(func() {
+		c.inputSchemas = make(map[string]string, len(c.Connector.GetTaskInputSchemas()))
+		c.modelEnums = map[string][]string{}
+		for task, s := range c.Connector.GetTaskInputSchemas() {
+			c.inputSchemas[task] = s
+
+			sch := map[string]any{}
+			if err := json.Unmarshal([]byte(s), &sch); err != nil {
+				continue
+			}
+
+			props, _ := sch["properties"].(map[string]any)
+			model, _ := props["model"].(map[string]any)
+			enum, ok := model["enum"].([]any)
+			if !ok {
+				continue
+			}
+			delete(model, "enum")
+
+			for _, v := range enum {
+				if id, ok := v.(string); ok {
+					c.modelEnums[task] = append(c.modelEnums[task], id)
+				}
+			}
+
+			b, err := json.Marshal(sch)
+			if err != nil {
+				continue
+			}
+			c.inputSchemas[task] = string(b)
+		}
+	})
+
+	return c.inputSchemas
+}
+
+// taskModels returns the embedded model enum of a task. It is empty if the
+// task input schema doesn't restrict the model.
+func (c *Connector) taskModels(task string) []string {
+	c.GetTaskInputSchemas()
+	return c.modelEnums[task]
+}
+
+// ExecuteWithValidation validates the inputs and outputs of the execution
+// against the task schemas. Besides, the models of the inputs must be in the
+// embedded enum of the task or be models of the task available to the API key
+// of the config.
+func (e *Execution) ExecuteWithValidation(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
+	if err := e.validateModels(inputs); err != nil {
+		return nil, err
+	}
+
+	return e.Execution.ExecuteWithValidation(inputs)
+}
+
+// validateModels checks the models of the inputs. The errors have the format
+// of the schema validation errors. If the available models can't be listed,
+// only the embedded models are accepted.
+func (e *Execution) validateModels(inputs []*structpb.Struct) error {
+	if len(e.models) == 0 {
+		return nil
+	}
+
+	var available []string
+	var listed bool
+	var errs []string
+	for i, input := range inputs {
+		model := input.GetFields()["model"].GetStringValue()
+		if model == "" || slices.Contains(e.models, model) {
+			continue
+		}
+
+		if !listed {
+			var err error
+			if available, err = availableModels.get(e.Config, e.Logger); err != nil {
+				e.Logger.Warn("Couldn't list OpenAI models, using the embedded list.", zap.Error(err))
+			}
+			listed = true
+		}
+
+		// The listed models aren't bound to a task, so they are filtered as
+		// in the definition enums.
+		if _, ok := slices.BinarySearch(available, model); !ok || !isTaskModel(e.Task, model) {
+			errs = append(errs, fmt.Sprintf("inputs[%d].model: model %q isn't available", i, model))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
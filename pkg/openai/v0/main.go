@@ -1,19 +1,21 @@
 package openai
 
 import (
+	"context"
 	_ "embed"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"sync"
 
-	"github.com/gabriel-vasile/mimetype"
 	"github.com/gofrs/uuid"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
+	"github.com/instill-ai/connector/pkg/util/httpclient"
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
 	"github.com/instill-ai/x/errmsg"
 )
@@ -23,8 +25,15 @@ const (
 	textGenerationTask    = "TASK_TEXT_GENERATION"
 	textEmbeddingsTask    = "TASK_TEXT_EMBEDDINGS"
 	speechRecognitionTask = "TASK_SPEECH_RECOGNITION"
+	speechTranslationTask = "TASK_SPEECH_TRANSLATION"
 	textToSpeechTask      = "TASK_TEXT_TO_SPEECH"
 	textToImageTask       = "TASK_TEXT_TO_IMAGE"
+	imageEditTask         = "TASK_IMAGE_EDIT"
+	imageVariationTask    = "TASK_IMAGE_VARIATION"
+	moderationTask        = "TASK_MODERATION"
+	batchSubmitTask       = "TASK_BATCH_SUBMIT"
+	batchStatusTask       = "TASK_BATCH_STATUS"
+	batchResultsTask      = "TASK_BATCH_RESULTS"
 )
 
 var (
@@ -41,10 +50,26 @@ var (
 
 type Connector struct {
 	base.Connector
+
+	inputSchemasOnce sync.Once
+	inputSchemas     map[string]string
+	// modelEnums holds the model enums removed from the input schemas.
+	modelEnums map[string][]string
 }
 
 type Execution struct {
 	base.Execution
+	util.ExecutionContext
+
+	// models is the embedded model enum of the task.
+	models []string
+	// maxAudioSize is the size above which the audio files are split.
+	maxAudioSize int
+
+	streamHandler StreamHandler
+	// streamMu serializes the calls to the stream handler, as the inputs of
+	// a batch are processed concurrently.
+	streamMu sync.Mutex
 }
 
 func Init(logger *zap.Logger) base.IConnector {
@@ -63,28 +88,78 @@ func Init(logger *zap.Logger) base.IConnector {
 }
 
 func (c *Connector) CreateExecution(defUID uuid.UUID, task string, config *structpb.Struct, logger *zap.Logger) (base.IExecution, error) {
-	e := &Execution{}
+	if err := checkProvider(config); err != nil {
+		return nil, err
+	}
+
+	e := &Execution{models: c.taskModels(task), maxAudioSize: maxAudioSize}
 	e.Execution = base.CreateExecutionHelper(e, c, defUID, task, config, logger)
 	return e, nil
 }
 
-// getBasePath returns OpenAI's API URL. This configuration param allows us to
-// override the API the connector will point to. It isn't meant to be exposed
-// to users. Rather, it can serve to test the logic against a fake server.
-// TODO instead of having the API value hardcoded in the codebase, it should be
-// read from a config file or environment variable.
+// SetStreamHandler makes text generation tasks stream the OpenAI response.
+// The handler is called with every generated chunk and the execution still
+// returns the aggregated texts. Calls to the handler are never concurrent.
+func (e *Execution) SetStreamHandler(h StreamHandler) {
+	e.streamHandler = h
+}
+
+// getBasePath returns the API URL. Azure and OpenAI-compatible providers set
+// it in the base_url configuration param.
+//
+// The base_path param allows us to override the API the connector will point
+// to. It isn't meant to be exposed to users. Rather, it can serve to test the
+// logic against a fake server.
 func getBasePath(config *structpb.Struct) string {
-	v, ok := config.GetFields()["base_path"]
-	if !ok {
-		return host
+	if v, ok := config.GetFields()["base_path"]; ok {
+		return v.GetStringValue()
+	}
+
+	if v := config.GetFields()["base_url"].GetStringValue(); v != "" && getProvider(config) != providerOpenAI {
+		return v
 	}
-	return v.GetStringValue()
+
+	return host
+}
+
+func getProvider(config *structpb.Struct) string {
+	if v := config.GetFields()["provider"].GetStringValue(); v != "" {
+		return v
+	}
+
+	return providerOpenAI
+}
+
+func getAPIVersion(config *structpb.Struct) string {
+	if v := config.GetFields()["api_version"].GetStringValue(); v != "" {
+		return v
+	}
+
+	return defaultAzureAPIVersion
+}
+
+// getDeployments returns the model to deployment name mapping of Azure
+// OpenAI.
+func getDeployments(config *structpb.Struct) map[string]string {
+	deployments := map[string]string{}
+	for model, v := range config.GetFields()["deployments"].GetStructValue().GetFields() {
+		deployments[model] = v.GetStringValue()
+	}
+
+	return deployments
 }
 
 func getAPIKey(config *structpb.Struct) string {
 	return config.GetFields()["api_key"].GetStringValue()
 }
 
+func getRateLimit(config *structpb.Struct) httpclient.RateLimit {
+	return httpclient.RateLimit{
+		RequestsPerMinute: int(config.GetFields()["requests_per_minute"].GetNumberValue()),
+		TokensPerMinute:   int(config.GetFields()["tokens_per_minute"].GetNumberValue()),
+	}
+}
+
 func getOrg(config *structpb.Struct) string {
 	val, ok := config.GetFields()["organization"]
 	if !ok {
@@ -94,243 +169,318 @@ func getOrg(config *structpb.Struct) string {
 }
 
 func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
-	client := newClient(e.Config, e.Logger)
-	outputs := []*structpb.Struct{}
-
-	for _, input := range inputs {
-		switch e.Task {
-		case textGenerationTask:
-			inputStruct := TextCompletionInput{}
-			err := base.ConvertFromStructpb(input, &inputStruct)
-			if err != nil {
-				return nil, err
-			}
+	client, err := newClient(e.UID, e.Config, e.Logger)
+	if err != nil {
+		return nil, err
+	}
 
-			messages := []interface{}{}
-
-			// If chat history is provided, add it to the messages, and ignore the system message
-			if inputStruct.ChatHistory != nil {
-				for _, chat := range inputStruct.ChatHistory {
-					if chat.Role == "user" {
-						messages = append(messages, MultiModalMessage{Role: chat.Role, Content: chat.Content})
-					} else {
-						content := ""
-						for _, c := range chat.Content {
-							// OpenAI doesn't support MultiModal Content for non-user role
-							if c.Type == "text" {
-								content = *c.Text
-							}
-						}
-						messages = append(messages, Message{Role: chat.Role, Content: content})
-					}
-
-				}
-			} else {
-				// If chat history is not provided, add the system message to the messages
-				if inputStruct.SystemMessage != nil {
-					messages = append(messages, Message{Role: "system", Content: *inputStruct.SystemMessage})
-				}
-			}
-			userContents := []Content{}
-			userContents = append(userContents, Content{Type: "text", Text: &inputStruct.Prompt})
-			for _, image := range inputStruct.Images {
-				b, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(image))
-				if err != nil {
-					return nil, err
-				}
-				url := fmt.Sprintf("data:%s;base64,%s", mimetype.Detect(b).String(), base.TrimBase64Mime(image))
-				userContents = append(userContents, Content{Type: "image_url", ImageURL: &ImageURL{URL: url}})
-			}
-			messages = append(messages, MultiModalMessage{Role: "user", Content: userContents})
-
-			body := TextCompletionReq{
-				Messages:         messages,
-				Model:            inputStruct.Model,
-				MaxTokens:        inputStruct.MaxTokens,
-				Temperature:      inputStruct.Temperature,
-				N:                inputStruct.N,
-				TopP:             inputStruct.TopP,
-				PresencePenalty:  inputStruct.PresencePenalty,
-				FrequencyPenalty: inputStruct.FrequencyPenalty,
-			}
+	return util.ExecuteConcurrently(e.Context(), inputs, util.Concurrency(e.Context()), func(ctx context.Context, i int, input *structpb.Struct) (*structpb.Struct, error) {
+		return e.executeOne(ctx, client, i, input)
+	})
+}
 
-			// workaround, the OpenAI service can not accept this param
-			if inputStruct.Model != "gpt-4-vision-preview" {
-				body.ResponseFormat = inputStruct.ResponseFormat
-			}
+func (e *Execution) executeOne(ctx context.Context, client *httpclient.Client, i int, input *structpb.Struct) (*structpb.Struct, error) {
+	switch e.Task {
+	case textGenerationTask:
+		inputStruct := TextCompletionInput{}
+		err := base.ConvertFromStructpb(input, &inputStruct)
+		if err != nil {
+			return nil, err
+		}
 
-			resp := TextCompletionResp{}
-			req := client.R().SetResult(&resp).SetBody(body)
-			if _, err := req.Post(completionsPath); err != nil {
-				return inputs, err
-			}
+		inputStruct, err = e.fitContext(ctx, client, inputStruct)
+		if err != nil {
+			return nil, err
+		}
 
-			outputStruct := TextCompletionOutput{
-				Texts: []string{},
-			}
-			for _, c := range resp.Choices {
-				outputStruct.Texts = append(outputStruct.Texts, c.Message.Content)
-			}
+		body, err := textCompletionReq(inputStruct)
+		if err != nil {
+			return nil, err
+		}
 
-			outputJSON, err := json.Marshal(outputStruct)
-			if err != nil {
-				return nil, err
-			}
-			output := structpb.Struct{}
-			err = protojson.Unmarshal(outputJSON, &output)
-			if err != nil {
-				return nil, err
-			}
-			outputs = append(outputs, &output)
+		outputStruct, err := e.textCompletion(ctx, client, i, inputStruct, body)
+		if err != nil {
+			return nil, err
+		}
 
-		case textEmbeddingsTask:
-			inputStruct := TextEmbeddingsInput{}
-			err := base.ConvertFromStructpb(input, &inputStruct)
-			if err != nil {
-				return nil, err
-			}
+		outputJSON, err := json.Marshal(outputStruct)
+		if err != nil {
+			return nil, err
+		}
+		output := structpb.Struct{}
+		err = protojson.Unmarshal(outputJSON, &output)
+		if err != nil {
+			return nil, err
+		}
+		return &output, nil
 
-			resp := TextEmbeddingsResp{}
-			req := client.R().SetBody(TextEmbeddingsReq{
-				Model: inputStruct.Model,
-				Input: []string{inputStruct.Text},
-			}).SetResult(&resp)
+	case textEmbeddingsTask:
+		inputStruct := TextEmbeddingsInput{}
+		err := base.ConvertFromStructpb(input, &inputStruct)
+		if err != nil {
+			return nil, err
+		}
 
-			if _, err := req.Post(embeddingsPath); err != nil {
-				return inputs, err
-			}
+		embeddings, err := textEmbeddings(ctx, client, inputStruct, inputStruct.texts())
+		if err != nil {
+			return nil, err
+		}
 
-			outputStruct := TextEmbeddingsOutput{
-				Embedding: resp.Data[0].Embedding,
-			}
+		outputStruct := inputStruct.output(embeddings)
+		output, err := base.ConvertToStructpb(outputStruct)
+		if err != nil {
+			return nil, err
+		}
+		return output, nil
 
-			output, err := base.ConvertToStructpb(outputStruct)
-			if err != nil {
-				return nil, err
-			}
-			outputs = append(outputs, output)
+	case speechRecognitionTask, speechTranslationTask:
+		inputStruct := AudioTranscriptionInput{}
+		err := base.ConvertFromStructpb(input, &inputStruct)
+		if err != nil {
+			return nil, err
+		}
 
-		case speechRecognitionTask:
-			inputStruct := AudioTranscriptionInput{}
-			err := base.ConvertFromStructpb(input, &inputStruct)
-			if err != nil {
-				return nil, err
-			}
+		path := transcriptionsPath
+		if e.Task == speechTranslationTask {
+			path = translationsPath
+		}
 
-			audioBytes, err := base64.StdEncoding.DecodeString(base.TrimBase64Mime(inputStruct.Audio))
-			if err != nil {
-				return nil, err
-			}
+		outputStruct, err := transcribeAudio(ctx, client, path, inputStruct, e.maxAudioSize)
+		if err != nil {
+			return nil, err
+		}
 
-			data, ct, err := getBytes(AudioTranscriptionReq{
-				File:        audioBytes,
-				Model:       inputStruct.Model,
-				Prompt:      inputStruct.Prompt,
-				Language:    inputStruct.Prompt,
-				Temperature: inputStruct.Temperature,
-			})
-			if err != nil {
-				return inputs, err
-			}
+		output, err := base.ConvertToStructpb(outputStruct)
+		if err != nil {
+			return nil, err
+		}
+		return output, nil
 
-			resp := AudioTranscriptionResp{}
-			req := client.R().SetBody(data).SetResult(&resp).SetHeader("Content-Type", ct)
-			if _, err := req.Post(transcriptionsPath); err != nil {
-				return inputs, err
-			}
+	case textToSpeechTask:
+		inputStruct := TextToSpeechInput{}
+		err := base.ConvertFromStructpb(input, &inputStruct)
+		if err != nil {
+			return nil, err
+		}
 
-			output, err := base.ConvertToStructpb(resp)
-			if err != nil {
-				return nil, err
-			}
-			outputs = append(outputs, output)
+		req := forModel(client.R().SetContext(ctx), inputStruct.Model).SetBody(TextToSpeechReq{
+			Input:          inputStruct.Text,
+			Model:          inputStruct.Model,
+			Voice:          inputStruct.Voice,
+			ResponseFormat: inputStruct.ResponseFormat,
+			Speed:          inputStruct.Speed,
+		})
 
-		case textToSpeechTask:
-			inputStruct := TextToSpeechInput{}
-			err := base.ConvertFromStructpb(input, &inputStruct)
-			if err != nil {
-				return nil, err
-			}
+		resp, err := req.Post(createSpeechPath)
+		if err != nil {
+			return nil, err
+		}
 
-			req := client.R().SetBody(TextToSpeechReq{
-				Input:          inputStruct.Text,
-				Model:          inputStruct.Model,
-				Voice:          inputStruct.Voice,
-				ResponseFormat: inputStruct.ResponseFormat,
-				Speed:          inputStruct.Speed,
-			})
+		audio := base64.StdEncoding.EncodeToString(resp.Body())
+		outputStruct := TextToSpeechOutput{
+			Audio: fmt.Sprintf("data:audio/wav;base64,%s", audio),
+		}
 
-			resp, err := req.Post(createSpeechPath)
-			if err != nil {
-				return inputs, err
-			}
+		output, err := base.ConvertToStructpb(outputStruct)
+		if err != nil {
+			return nil, err
+		}
+		return output, nil
 
-			audio := base64.StdEncoding.EncodeToString(resp.Body())
-			outputStruct := TextToSpeechOutput{
-				Audio: fmt.Sprintf("data:audio/wav;base64,%s", audio),
-			}
+	case textToImageTask:
 
-			output, err := base.ConvertToStructpb(outputStruct)
-			if err != nil {
-				return nil, err
-			}
-			outputs = append(outputs, output)
+		inputStruct := ImagesGenerationInput{}
+		err := base.ConvertFromStructpb(input, &inputStruct)
+		if err != nil {
+			return nil, err
+		}
 
-		case textToImageTask:
+		resp := ImageGenerationsResp{}
+		req := forModel(client.R().SetContext(ctx), inputStruct.Model).SetBody(ImageGenerationsReq{
+			Model:          inputStruct.Model,
+			Prompt:         inputStruct.Prompt,
+			Quality:        inputStruct.Quality,
+			Size:           inputStruct.Size,
+			Style:          inputStruct.Style,
+			N:              inputStruct.N,
+			ResponseFormat: "b64_json",
+		}).SetResult(&resp)
+
+		if _, err := req.Post(imgGenerationPath); err != nil {
+			return nil, err
+		}
 
-			inputStruct := ImagesGenerationInput{}
-			err := base.ConvertFromStructpb(input, &inputStruct)
-			if err != nil {
-				return nil, err
-			}
+		outputStruct := imageGenerationsOutput(resp, "image/webp")
+		output, err := base.ConvertToStructpb(outputStruct)
+		if err != nil {
+			return nil, err
+		}
+		return output, nil
 
-			resp := ImageGenerationsResp{}
-			req := client.R().SetBody(ImageGenerationsReq{
-				Model:          inputStruct.Model,
-				Prompt:         inputStruct.Prompt,
-				Quality:        inputStruct.Quality,
-				Size:           inputStruct.Size,
-				Style:          inputStruct.Style,
-				N:              inputStruct.N,
-				ResponseFormat: "b64_json",
-			}).SetResult(&resp)
-
-			if _, err := req.Post(imgGenerationPath); err != nil {
-				return inputs, err
-			}
+	case imageEditTask:
+		inputStruct := ImageEditInput{}
+		err := base.ConvertFromStructpb(input, &inputStruct)
+		if err != nil {
+			return nil, err
+		}
 
-			results := []ImageGenerationsOutputResult{}
-			for _, data := range resp.Data {
-				results = append(results, ImageGenerationsOutputResult{
-					Image:         fmt.Sprintf("data:image/webp;base64,%s", data.Image),
-					RevisedPrompt: data.RevisedPrompt,
-				})
-			}
-			outputStruct := ImageGenerationsOutput{
-				Results: results,
-			}
+		image, err := decodePNG("image", inputStruct.Image)
+		if err != nil {
+			return nil, err
+		}
 
-			output, err := base.ConvertToStructpb(outputStruct)
+		var mask []byte
+		if inputStruct.Mask != "" {
+			mask, err = decodePNG("mask", inputStruct.Mask)
 			if err != nil {
 				return nil, err
 			}
-			outputs = append(outputs, output)
+		}
 
-		default:
-			return nil, errmsg.AddMessage(
-				fmt.Errorf("not supported task: %s", e.Task),
-				fmt.Sprintf("%s task is not supported.", e.Task),
-			)
+		data, ct, err := getImageEditBytes(ImageEditReq{
+			Image:  image,
+			Mask:   mask,
+			Prompt: inputStruct.Prompt,
+			Model:  inputStruct.Model,
+			N:      inputStruct.N,
+			Size:   inputStruct.Size,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		resp := ImageGenerationsResp{}
+		req := forModel(client.R().SetContext(ctx), inputStruct.Model).SetBody(data).SetResult(&resp).SetHeader("Content-Type", ct)
+		if _, err := req.Post(imgEditsPath); err != nil {
+			return nil, err
+		}
+
+		outputStruct := imageGenerationsOutput(resp, "image/png")
+		output, err := base.ConvertToStructpb(outputStruct)
+		if err != nil {
+			return nil, err
+		}
+		return output, nil
+
+	case imageVariationTask:
+		inputStruct := ImageVariationInput{}
+		err := base.ConvertFromStructpb(input, &inputStruct)
+		if err != nil {
+			return nil, err
+		}
+
+		image, err := decodePNG("image", inputStruct.Image)
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	return outputs, nil
+		data, ct, err := getImageEditBytes(ImageEditReq{
+			Image: image,
+			Model: inputStruct.Model,
+			N:     inputStruct.N,
+			Size:  inputStruct.Size,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		resp := ImageGenerationsResp{}
+		req := forModel(client.R().SetContext(ctx), inputStruct.Model).SetBody(data).SetResult(&resp).SetHeader("Content-Type", ct)
+		if _, err := req.Post(imgVariationsPath); err != nil {
+			return nil, err
+		}
+
+		outputStruct := imageGenerationsOutput(resp, "image/png")
+		output, err := base.ConvertToStructpb(outputStruct)
+		if err != nil {
+			return nil, err
+		}
+		return output, nil
+
+	case moderationTask:
+		inputStruct := ModerationInput{}
+		err := base.ConvertFromStructpb(input, &inputStruct)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := moderationReq(inputStruct)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := ModerationResp{}
+		req := forModel(client.R().SetContext(ctx), body.Model).SetBody(body).SetResult(&resp)
+		if _, err := req.Post(moderationsPath); err != nil {
+			return nil, err
+		}
+
+		outputStruct, err := moderationOutput(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		return base.ConvertToStructpb(outputStruct)
+
+	case batchSubmitTask:
+		inputStruct := BatchSubmitInput{}
+		err := base.ConvertFromStructpb(input, &inputStruct)
+		if err != nil {
+			return nil, err
+		}
+
+		outputStruct, err := batchSubmit(ctx, client, inputStruct)
+		if err != nil {
+			return nil, err
+		}
+
+		return base.ConvertToStructpb(outputStruct)
+
+	case batchStatusTask:
+		inputStruct := BatchStatusInput{}
+		err := base.ConvertFromStructpb(input, &inputStruct)
+		if err != nil {
+			return nil, err
+		}
+
+		outputStruct, err := batchStatus(ctx, client, inputStruct)
+		if err != nil {
+			return nil, err
+		}
+
+		return base.ConvertToStructpb(outputStruct)
+
+	case batchResultsTask:
+		inputStruct := BatchResultsInput{}
+		err := base.ConvertFromStructpb(input, &inputStruct)
+		if err != nil {
+			return nil, err
+		}
+
+		outputStruct, err := batchResults(ctx, client, inputStruct)
+		if err != nil {
+			return nil, err
+		}
+
+		return base.ConvertToStructpb(outputStruct)
+
+	default:
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("not supported task: %s", e.Task),
+			fmt.Sprintf("%s task is not supported.", e.Task),
+		)
+	}
 }
 
 // Test checks the connector state.
-func (c *Connector) Test(_ uuid.UUID, config *structpb.Struct, logger *zap.Logger) (pipelinePB.Connector_State, error) {
+func (c *Connector) Test(defUID uuid.UUID, config *structpb.Struct, logger *zap.Logger) (pipelinePB.Connector_State, error) {
+	client, err := newClient(defUID, config, logger)
+	if err != nil {
+		return pipelinePB.Connector_STATE_ERROR, err
+	}
+
 	models := ListModelsResponse{}
-	req := newClient(config, logger).R().SetResult(&models)
+	req := client.R().SetResult(&models)
 
 	if _, err := req.Get(listModelsPath); err != nil {
 		return pipelinePB.Connector_STATE_ERROR, err
@@ -0,0 +1,93 @@
+package openai
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/instill-ai/x/errmsg"
+)
+
+const (
+	moderationsPath = "/v1/moderations"
+)
+
+type ModerationInput struct {
+	Text   string   `json:"text"`
+	Images []string `json:"images"`
+	Model  string   `json:"model"`
+}
+
+type ModerationOutput struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+type ModerationReq struct {
+	// Input is the text to classify or, for multi-modal models, a list of
+	// text and image contents.
+	Input any    `json:"input"`
+	Model string `json:"model,omitempty"`
+}
+
+type ModerationResp struct {
+	Results []ModerationResult `json:"results"`
+}
+
+type ModerationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// categoryNames converts the moderation categories (e.g. self-harm/intent)
+// into field names that can be referenced in a pipeline (self_harm_intent).
+var categoryNames = strings.NewReplacer("/", "_", "-", "_")
+
+func moderationReq(in ModerationInput) (ModerationReq, error) {
+	if len(in.Images) == 0 {
+		return ModerationReq{Input: in.Text, Model: in.Model}, nil
+	}
+
+	// Only the omni-moderation models accept images.
+	if strings.HasPrefix(in.Model, "text-moderation") {
+		return ModerationReq{}, errmsg.AddMessage(
+			fmt.Errorf("model %s doesn't support images", in.Model),
+			fmt.Sprintf("The %s model can only classify text. Use an omni-moderation model to classify images.", in.Model),
+		)
+	}
+
+	contents := []Content{}
+	if in.Text != "" {
+		text := in.Text
+		contents = append(contents, Content{Type: "text", Text: &text})
+	}
+
+	imageContents, err := imageContents(in.Images, nil)
+	if err != nil {
+		return ModerationReq{}, err
+	}
+
+	return ModerationReq{Input: append(contents, imageContents...), Model: in.Model}, nil
+}
+
+func moderationOutput(resp ModerationResp) (ModerationOutput, error) {
+	if len(resp.Results) == 0 {
+		return ModerationOutput{}, fmt.Errorf("no moderation results")
+	}
+
+	result := resp.Results[0]
+	out := ModerationOutput{
+		Flagged:        result.Flagged,
+		Categories:     make(map[string]bool, len(result.Categories)),
+		CategoryScores: make(map[string]float64, len(result.CategoryScores)),
+	}
+	for k, v := range result.Categories {
+		out.Categories[categoryNames.Replace(k)] = v
+	}
+	for k, v := range result.CategoryScores {
+		out.CategoryScores[categoryNames.Replace(k)] = v
+	}
+
+	return out, nil
+}
@@ -1,21 +1,47 @@
 package openai
 
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/instill-ai/connector/pkg/util"
+	"github.com/instill-ai/connector/pkg/util/httpclient"
+)
+
 const (
 	embeddingsPath = "/v1/embeddings"
+
+	// maxEmbeddingsBatch is the maximum number of texts the embeddings
+	// endpoint accepts in a single request.
+	maxEmbeddingsBatch = 2048
+
+	encodingFormatFloat  = "float"
+	encodingFormatBase64 = "base64"
 )
 
 type TextEmbeddingsInput struct {
-	Text  string `json:"text"`
-	Model string `json:"model"`
+	Text           string   `json:"text"`
+	Texts          []string `json:"texts"`
+	Model          string   `json:"model"`
+	Dimensions     int      `json:"dimensions"`
+	EncodingFormat string   `json:"encoding_format"`
 }
 
 type TextEmbeddingsOutput struct {
-	Embedding []float64 `json:"embedding"`
+	Embedding  []float64   `json:"embedding,omitempty"`
+	Embeddings [][]float64 `json:"embeddings,omitempty"`
 }
 
 type TextEmbeddingsReq struct {
-	Model string   `json:"model"`
-	Input []string `json:"input"`
+	Model          string   `json:"model"`
+	Input          []string `json:"input"`
+	Dimensions     int      `json:"dimensions,omitempty"`
+	EncodingFormat string   `json:"encoding_format,omitempty"`
 }
 
 type TextEmbeddingsResp struct {
@@ -27,6 +53,104 @@ type TextEmbeddingsResp struct {
 
 type Data struct {
 	Object    string    `json:"object"`
-	Embedding []float64 `json:"embedding"`
+	Embedding Embedding `json:"embedding"`
 	Index     int       `json:"index"`
 }
+
+// Embedding is a vector returned by the embeddings endpoint. It can be
+// encoded as an array of floats or, to save bandwidth, as the base64 string
+// of its little-endian float32 values.
+type Embedding []float64
+
+func (e *Embedding) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var floats []float64
+		if err := json.Unmarshal(b, &floats); err != nil {
+			return err
+		}
+
+		*e = floats
+		return nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	if len(raw)%4 != 0 {
+		return fmt.Errorf("invalid base64 embedding length: %d bytes", len(raw))
+	}
+
+	floats := make([]float64, len(raw)/4)
+	for i := range floats {
+		bits := binary.LittleEndian.Uint32(raw[i*4:])
+		floats[i] = float64(math.Float32frombits(bits))
+	}
+
+	*e = floats
+	return nil
+}
+
+func (in TextEmbeddingsInput) texts() []string {
+	return util.EmbeddingTexts(in.Text, in.Texts)
+}
+
+// output builds the task output from the embeddings of the input texts.
+func (in TextEmbeddingsInput) output(embeddings [][]float64) TextEmbeddingsOutput {
+	out := TextEmbeddingsOutput{}
+	if len(embeddings) > len(in.Texts) {
+		out.Embedding = embeddings[0]
+		embeddings = embeddings[1:]
+	}
+	if len(in.Texts) > 0 {
+		out.Embeddings = embeddings
+	}
+
+	return out
+}
+
+// sortedEmbeddings returns the embeddings of a response in the order of the
+// input texts. The order of the data isn't guaranteed, the index is.
+func sortedEmbeddings(data []Data) [][]float64 {
+	sort.Slice(data, func(i, j int) bool { return data[i].Index < data[j].Index })
+
+	embeddings := make([][]float64, 0, len(data))
+	for _, d := range data {
+		embeddings = append(embeddings, d.Embedding)
+	}
+
+	return embeddings
+}
+
+// textEmbeddings embeds the texts in batches, returning the embeddings in the
+// same order as the texts.
+func textEmbeddings(ctx context.Context, client *httpclient.Client, in TextEmbeddingsInput, texts []string) ([][]float64, error) {
+	embeddings := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += maxEmbeddingsBatch {
+		end := min(start+maxEmbeddingsBatch, len(texts))
+		batch := texts[start:end]
+
+		resp := TextEmbeddingsResp{}
+		req := forModel(httpclient.SetTokenCost(client.R().SetContext(ctx), util.EstimateTokens(batch...)), in.Model)
+		req.SetBody(TextEmbeddingsReq{
+			Model:          in.Model,
+			Input:          batch,
+			Dimensions:     in.Dimensions,
+			EncodingFormat: in.EncodingFormat,
+		}).SetResult(&resp)
+
+		if _, err := req.Post(embeddingsPath); err != nil {
+			return nil, err
+		}
+
+		if len(resp.Data) != len(batch) {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", len(batch), len(resp.Data))
+		}
+
+		embeddings = append(embeddings, sortedEmbeddings(resp.Data)...)
+	}
+
+	return embeddings, nil
+}
@@ -1,35 +1,110 @@
 package openai
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/instill-ai/connector/pkg/util"
+	"github.com/instill-ai/connector/pkg/util/httpclient"
+	"github.com/instill-ai/connector/pkg/util/tokenizer"
+	"github.com/instill-ai/x/errmsg"
+)
+
 const (
 	completionsPath = "/v1/chat/completions"
+
+	responseFormatJSONSchema = "json_schema"
+	structuredOutputName     = "structured_output"
 )
 
 type TextMessage struct {
-	Role    string    `json:"role"`
-	Content []Content `json:"content"`
+	Role       string           `json:"role"`
+	Content    []Content        `json:"content"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+	ToolCalls  []ToolCallOutput `json:"tool_calls,omitempty"`
 }
 type TextCompletionInput struct {
-	Prompt           string                `json:"prompt"`
-	Images           []string              `json:"images"`
-	ChatHistory      []*TextMessage        `json:"chat_history,omitempty"`
-	Model            string                `json:"model"`
-	SystemMessage    *string               `json:"system_message,omitempty"`
-	Temperature      *float32              `json:"temperature,omitempty"`
-	TopP             *float32              `json:"top_p,omitempty"`
-	N                *int                  `json:"n,omitempty"`
-	Stop             *string               `json:"stop,omitempty"`
-	MaxTokens        *int                  `json:"max_tokens,omitempty"`
-	PresencePenalty  *float32              `json:"presence_penalty,omitempty"`
-	FrequencyPenalty *float32              `json:"frequency_penalty,omitempty"`
-	ResponseFormat   *ResponseFormatStruct `json:"response_format,omitempty"`
+	Prompt            string                `json:"prompt"`
+	PromptTemplate    string                `json:"prompt_template,omitempty"`
+	Variables         map[string]any        `json:"variables,omitempty"`
+	Images            []string              `json:"images"`
+	ImageDetails      []string              `json:"image_details,omitempty"`
+	ChatHistory       []*TextMessage        `json:"chat_history,omitempty"`
+	Model             string                `json:"model"`
+	SystemMessage     *string               `json:"system_message,omitempty"`
+	Temperature       *float32              `json:"temperature,omitempty"`
+	TopP              *float32              `json:"top_p,omitempty"`
+	N                 *int                  `json:"n,omitempty"`
+	Stop              *string               `json:"stop,omitempty"`
+	MaxTokens         *int                  `json:"max_tokens,omitempty"`
+	PresencePenalty   *float32              `json:"presence_penalty,omitempty"`
+	FrequencyPenalty  *float32              `json:"frequency_penalty,omitempty"`
+	ResponseFormat    *ResponseFormatStruct `json:"response_format,omitempty"`
+	Tools             []Tool                `json:"tools,omitempty"`
+	ToolChoice        any                   `json:"tool_choice,omitempty"`
+	JSONSchema        map[string]any        `json:"json_schema,omitempty"`
+	JSONSchemaRetries int                   `json:"json_schema_retries,omitempty"`
+	MaxContextTokens  *int                  `json:"max_context_tokens,omitempty"`
+	HistoryTrimming   string                `json:"history_trimming,omitempty"`
 }
 
 type ResponseFormatStruct struct {
-	Type string `json:"type,omitempty"`
+	Type       string              `json:"type,omitempty"`
+	JSONSchema *ResponseJSONSchema `json:"json_schema,omitempty"`
+}
+
+// ResponseJSONSchema is the schema of a structured output in the OpenAI API.
+type ResponseJSONSchema struct {
+	Name   string         `json:"name"`
+	Schema map[string]any `json:"schema"`
+	Strict bool           `json:"strict"`
 }
 
 type TextCompletionOutput struct {
-	Texts []string `json:"texts"`
+	Texts         []string         `json:"texts"`
+	ToolCalls     []ToolCallOutput `json:"tool_calls,omitempty"`
+	FinishReasons []string         `json:"finish_reasons"`
+	Usage         util.LLMUsage    `json:"usage"`
+	Data          map[string]any   `json:"data,omitempty"`
+}
+
+// Tool is a function the model may generate JSON inputs for.
+type Tool struct {
+	Type     string   `json:"type"`
+	Function Function `json:"function"`
+}
+
+type Function struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+// ToolCall is a function call generated by the model, as represented in the
+// OpenAI API.
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ToolCallOutput is the connector representation of a tool call, where the
+// arguments are parsed into an object. The choice index is only relevant in
+// the task output.
+type ToolCallOutput struct {
+	ChoiceIndex int            `json:"choice_index"`
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Arguments   map[string]any `json:"arguments"`
 }
 
 type TextCompletionReq struct {
@@ -43,6 +118,9 @@ type TextCompletionReq struct {
 	PresencePenalty  *float32              `json:"presence_penalty,omitempty"`
 	FrequencyPenalty *float32              `json:"frequency_penalty,omitempty"`
 	ResponseFormat   *ResponseFormatStruct `json:"response_format,omitempty"`
+	Tools            []Tool                `json:"tools,omitempty"`
+	ToolChoice       any                   `json:"tool_choice,omitempty"`
+	Stream           bool                  `json:"stream,omitempty"`
 }
 
 type MultiModalMessage struct {
@@ -51,12 +129,15 @@ type MultiModalMessage struct {
 }
 
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 }
 
 type ImageURL struct {
-	URL string `json:"url"`
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
 }
 type Content struct {
 	Type     string    `json:"type"`
@@ -73,8 +154,9 @@ type TextCompletionResp struct {
 }
 
 type OutputMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 }
 
 type Choices struct {
@@ -83,8 +165,493 @@ type Choices struct {
 	Message      OutputMessage `json:"message"`
 }
 
+// TextCompletionStreamResp is a chunk of a streamed chat completion.
+type TextCompletionStreamResp struct {
+	ID      string          `json:"id"`
+	Object  string          `json:"object"`
+	Created int             `json:"created"`
+	Choices []StreamChoices `json:"choices"`
+}
+
+type StreamChoices struct {
+	Index        int         `json:"index"`
+	FinishReason string      `json:"finish_reason"`
+	Delta        StreamDelta `json:"delta"`
+}
+
+type StreamDelta struct {
+	Role      string          `json:"role"`
+	Content   string          `json:"content"`
+	ToolCalls []ToolCallChunk `json:"tool_calls,omitempty"`
+}
+
+// ToolCallChunk is a fragment of a tool call in a streamed completion. The
+// index identifies the tool call the fragment belongs to.
+type ToolCallChunk struct {
+	Index    int          `json:"index"`
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
 type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
 }
+
+// TextCompletionChunk is an incremental piece of a streamed text generation.
+type TextCompletionChunk struct {
+	// InputIndex is the position, within the execution batch, of the input
+	// that produced the chunk.
+	InputIndex int
+	// ChoiceIndex identifies the completion the chunk belongs to when several
+	// ones are requested (n > 1).
+	ChoiceIndex int
+	// Attempt is the number, starting at 0, of the generation the chunk
+	// belongs to. When the text doesn't follow the JSON schema of the input,
+	// the model is prompted again and the chunks of the new attempt replace
+	// the ones streamed before.
+	Attempt int
+	// Text is the content delta.
+	Text string
+}
+
+// StreamHandler receives the chunks of a streamed text generation.
+type StreamHandler func(TextCompletionChunk)
+
+var (
+	// structuredOutputModels are the prefixes of the models that support
+	// strict JSON schemas in the response format.
+	structuredOutputModels = []string{"gpt-4o", "gpt-4.1", "gpt-5", "o1", "o3", "o4"}
+	// noStructuredOutputModels are the exceptions to structuredOutputModels.
+	noStructuredOutputModels = []string{"gpt-4o-2024-05-13", "o1-preview", "o1-mini"}
+)
+
+// supportsStructuredOutputs returns true if the model can enforce a strict
+// JSON schema in its response.
+func supportsStructuredOutputs(model string) bool {
+	for _, m := range noStructuredOutputModels {
+		if strings.HasPrefix(model, m) {
+			return false
+		}
+	}
+
+	for _, m := range structuredOutputModels {
+		if strings.HasPrefix(model, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// textCompletionReq builds the chat completion request of a text generation
+// input.
+func textCompletionReq(inputStruct TextCompletionInput) (TextCompletionReq, error) {
+	messages := []interface{}{}
+
+	// If chat history is provided, add it to the messages, and ignore the system message
+	if inputStruct.ChatHistory != nil {
+		for _, chat := range inputStruct.ChatHistory {
+			if chat.Role == "user" {
+				messages = append(messages, MultiModalMessage{Role: chat.Role, Content: chat.Content})
+			} else {
+				content := ""
+				for _, c := range chat.Content {
+					// OpenAI doesn't support MultiModal Content for non-user role
+					if c.Type == "text" {
+						content = *c.Text
+					}
+				}
+
+				toolCalls, err := toolCallsReq(chat.ToolCalls)
+				if err != nil {
+					return TextCompletionReq{}, err
+				}
+
+				messages = append(messages, Message{
+					Role:       chat.Role,
+					Content:    content,
+					ToolCallID: chat.ToolCallID,
+					ToolCalls:  toolCalls,
+				})
+			}
+
+		}
+	} else {
+		// If chat history is not provided, add the system message to the messages
+		if inputStruct.SystemMessage != nil {
+			messages = append(messages, Message{Role: "system", Content: *inputStruct.SystemMessage})
+		}
+	}
+	prompt, err := util.PromptFromTemplate(inputStruct.Prompt, inputStruct.PromptTemplate, inputStruct.Variables)
+	if err != nil {
+		return TextCompletionReq{}, err
+	}
+
+	nativeSchema := inputStruct.JSONSchema != nil && supportsStructuredOutputs(inputStruct.Model)
+	if inputStruct.JSONSchema != nil && !nativeSchema {
+		// The schema is enforced client-side, so the model is asked to
+		// follow it.
+		schema, err := util.CompileJSONSchema(inputStruct.JSONSchema)
+		if err != nil {
+			return TextCompletionReq{}, err
+		}
+
+		prompt = fmt.Sprintf("%s\n\n%s", prompt, schema.Instructions())
+	}
+
+	userContents := []Content{}
+	userContents = append(userContents, Content{Type: "text", Text: &prompt})
+	imageContents, err := imageContents(inputStruct.Images, inputStruct.ImageDetails)
+	if err != nil {
+		return TextCompletionReq{}, err
+	}
+	userContents = append(userContents, imageContents...)
+	messages = append(messages, MultiModalMessage{Role: "user", Content: userContents})
+
+	body := TextCompletionReq{
+		Messages:         messages,
+		Model:            inputStruct.Model,
+		MaxTokens:        inputStruct.MaxTokens,
+		Temperature:      inputStruct.Temperature,
+		N:                inputStruct.N,
+		TopP:             inputStruct.TopP,
+		PresencePenalty:  inputStruct.PresencePenalty,
+		FrequencyPenalty: inputStruct.FrequencyPenalty,
+		Tools:            inputStruct.Tools,
+		ToolChoice:       inputStruct.ToolChoice,
+	}
+
+	// workaround, the OpenAI service can not accept this param
+	if inputStruct.Model != "gpt-4-vision-preview" {
+		body.ResponseFormat = inputStruct.ResponseFormat
+	}
+
+	if nativeSchema {
+		body.ResponseFormat = &ResponseFormatStruct{
+			Type: responseFormatJSONSchema,
+			JSONSchema: &ResponseJSONSchema{
+				Name:   structuredOutputName,
+				Schema: inputStruct.JSONSchema,
+				Strict: true,
+			},
+		}
+	}
+
+	return body, nil
+}
+
+// textCompletionOutput transforms a chat completion response into the text
+// generation output. The counter estimates the usage OpenAI doesn't report.
+func textCompletionOutput(counter tokenizer.Counter, resp TextCompletionResp, body TextCompletionReq) (TextCompletionOutput, error) {
+	toolCalls, err := toolCallsOutput(resp.Choices)
+	if err != nil {
+		return TextCompletionOutput{}, err
+	}
+
+	outputStruct := TextCompletionOutput{
+		Texts:     []string{},
+		ToolCalls: toolCalls,
+	}
+	for _, c := range resp.Choices {
+		outputStruct.Texts = append(outputStruct.Texts, c.Message.Content)
+	}
+
+	outputStruct.FinishReasons = finishReasonsOutput(counter, resp.Choices, body.MaxTokens)
+	outputStruct.Usage = usageOutput(counter, resp, body.Messages)
+
+	return outputStruct, nil
+}
+
+// streamTextCompletion requests a streamed chat completion, calls onDelta
+// with every content delta and returns the response assembled from the
+// received chunks.
+func streamTextCompletion(client *httpclient.Client, req *resty.Request, body TextCompletionReq, onDelta func(choice int, text string)) (TextCompletionResp, error) {
+	body.Stream = true
+	resp := TextCompletionResp{}
+
+	restyResp, err := req.SetBody(body).SetDoNotParseResponse(true).Post(completionsPath)
+	if err != nil {
+		return resp, err
+	}
+
+	rawBody := restyResp.RawBody()
+	defer rawBody.Close()
+
+	if restyResp.IsError() {
+		return resp, client.RawResponseError(restyResp)
+	}
+
+	texts := []*strings.Builder{}
+	err = httpclient.ScanEvents(rawBody, func(data string) error {
+		chunk := TextCompletionStreamResp{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return err
+		}
+
+		resp.ID, resp.Object, resp.Created = chunk.ID, chunk.Object, chunk.Created
+		for _, c := range chunk.Choices {
+			for len(resp.Choices) <= c.Index {
+				resp.Choices = append(resp.Choices, Choices{Index: len(resp.Choices)})
+				texts = append(texts, new(strings.Builder))
+			}
+
+			choice := &resp.Choices[c.Index]
+			if c.Delta.Role != "" {
+				choice.Message.Role = c.Delta.Role
+			}
+			if c.FinishReason != "" {
+				choice.FinishReason = c.FinishReason
+			}
+
+			for _, tc := range c.Delta.ToolCalls {
+				for len(choice.Message.ToolCalls) <= tc.Index {
+					choice.Message.ToolCalls = append(choice.Message.ToolCalls, ToolCall{})
+				}
+
+				call := &choice.Message.ToolCalls[tc.Index]
+				if tc.ID != "" {
+					call.ID = tc.ID
+				}
+				if tc.Type != "" {
+					call.Type = tc.Type
+				}
+				call.Function.Name += tc.Function.Name
+				call.Function.Arguments += tc.Function.Arguments
+			}
+
+			if c.Delta.Content == "" {
+				continue
+			}
+
+			texts[c.Index].WriteString(c.Delta.Content)
+			onDelta(c.Index, c.Delta.Content)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return resp, err
+	}
+
+	for i, t := range texts {
+		resp.Choices[i].Message.Content = t.String()
+	}
+
+	return resp, nil
+}
+
+// finishReasonsOutput returns the reason why each choice stopped generating
+// tokens. If OpenAI doesn't report it, it is estimated from the request limit.
+func finishReasonsOutput(counter tokenizer.Counter, choices []Choices, maxTokens *int) []string {
+	limit := 0
+	if maxTokens != nil {
+		limit = *maxTokens
+	}
+
+	out := make([]string, len(choices))
+	for i, c := range choices {
+		out[i] = c.FinishReason
+		if out[i] == "" {
+			out[i] = util.EstimateFinishReason(counter.CountTokens(c.Message.Content), limit)
+		}
+	}
+
+	return out
+}
+
+// usageOutput returns the token usage of a completion. Some responses (e.g.
+// streamed completions) don't report it, so it is estimated from the request
+// messages and the generated texts.
+func usageOutput(counter tokenizer.Counter, resp TextCompletionResp, messages []any) util.LLMUsage {
+	if resp.Usage.TotalTokens > 0 {
+		return util.LLMUsage(resp.Usage)
+	}
+
+	completion := 0
+	for _, c := range resp.Choices {
+		completion += counter.CountTokens(c.Message.Content)
+	}
+
+	return util.NewLLMUsage(promptTokens(counter, messages), completion)
+}
+
+// promptTokens counts the tokens of the request messages the same way the
+// chat history is trimmed.
+func promptTokens(counter tokenizer.Counter, messages []any) int {
+	tokens := tokensPerReply
+	for _, m := range messages {
+		switch m := m.(type) {
+		case Message:
+			texts := []string{m.Content, m.ToolCallID}
+			for _, tc := range m.ToolCalls {
+				texts = append(texts, tc.ID, tc.Function.Name, tc.Function.Arguments)
+			}
+
+			tokens += messageTokens(counter, m.Role, texts...)
+		case MultiModalMessage:
+			var texts []string
+			for _, c := range m.Content {
+				if c.Text != nil {
+					texts = append(texts, *c.Text)
+				}
+			}
+
+			tokens += messageTokens(counter, m.Role, texts...)
+		}
+	}
+
+	return tokens
+}
+
+// tokenCost estimates the number of tokens a request will consume from the
+// tokens-per-minute limit. OpenAI accounts for the prompt and the maximum
+// number of tokens that can be generated.
+func (r TextCompletionReq) tokenCost(counter tokenizer.Counter) int {
+	cost := promptTokens(counter, r.Messages)
+	if r.MaxTokens != nil {
+		n := 1
+		if r.N != nil {
+			n = *r.N
+		}
+
+		cost += *r.MaxTokens * n
+	}
+
+	return cost
+}
+
+// toolCallsOutput parses the arguments of the tool calls generated by the
+// model.
+func toolCallsOutput(choices []Choices) ([]ToolCallOutput, error) {
+	var out []ToolCallOutput
+	for _, c := range choices {
+		for _, tc := range c.Message.ToolCalls {
+			args := map[string]any{}
+			if tc.Function.Arguments != "" {
+				if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+					return nil, errmsg.AddMessage(
+						fmt.Errorf("unmarshalling tool call arguments: %w", err),
+						fmt.Sprintf("OpenAI generated invalid JSON arguments for function %s.", tc.Function.Name),
+					)
+				}
+			}
+
+			out = append(out, ToolCallOutput{
+				ChoiceIndex: c.Index,
+				ID:          tc.ID,
+				Name:        tc.Function.Name,
+				Arguments:   args,
+			})
+		}
+	}
+
+	return out, nil
+}
+
+// toolCallsReq converts the tool calls in the chat history into their API
+// representation.
+func toolCallsReq(calls []ToolCallOutput) ([]ToolCall, error) {
+	var out []ToolCall
+	for _, tc := range calls {
+		args, err := json.Marshal(tc.Arguments)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, ToolCall{
+			ID:   tc.ID,
+			Type: "function",
+			Function: FunctionCall{
+				Name:      tc.Name,
+				Arguments: string(args),
+			},
+		})
+	}
+
+	return out, nil
+}
+
+// textCompletion sends a chat completion request and transforms its response
+// into the text generation output. If a JSON schema is provided, the first
+// choice is parsed into the output data. When it doesn't follow the schema,
+// the model is prompted again with the validation errors.
+func (e *Execution) textCompletion(ctx context.Context, client *httpclient.Client, i int, in TextCompletionInput, body TextCompletionReq) (TextCompletionOutput, error) {
+	if in.JSONSchema == nil {
+		resp, err := e.postTextCompletion(ctx, client, i, 0, body)
+		if err != nil {
+			return TextCompletionOutput{}, err
+		}
+
+		return textCompletionOutput(tokenCounter(ctx, body.Model), resp, body)
+	}
+
+	schema, err := util.CompileJSONSchema(in.JSONSchema)
+	if err != nil {
+		return TextCompletionOutput{}, err
+	}
+
+	var out TextCompletionOutput
+	var usage util.LLMUsage
+	attempt := -1
+	data, _, err := util.GenerateStructured(schema, in.JSONSchemaRetries, func(feedback string) (string, error) {
+		attempt++
+		if feedback != "" {
+			body.Messages = append(body.Messages,
+				Message{Role: "assistant", Content: out.Texts[0]},
+				MultiModalMessage{Role: "user", Content: []Content{{Type: "text", Text: &feedback}}},
+			)
+		}
+
+		resp, err := e.postTextCompletion(ctx, client, i, attempt, body)
+		if err != nil {
+			return "", err
+		}
+
+		if out, err = textCompletionOutput(tokenCounter(ctx, body.Model), resp, body); err != nil {
+			return "", err
+		}
+
+		// Every attempt consumes tokens.
+		usage = util.NewLLMUsage(usage.PromptTokens+out.Usage.PromptTokens, usage.CompletionTokens+out.Usage.CompletionTokens)
+		if len(out.Texts) == 0 {
+			return "", fmt.Errorf("no choices in chat completion")
+		}
+
+		return out.Texts[0], nil
+	})
+	if err != nil {
+		return TextCompletionOutput{}, err
+	}
+
+	out.Data = data
+	out.Usage = usage
+	return out, nil
+}
+
+// postTextCompletion sends a chat completion request, streaming the response
+// if the execution has a stream handler. The chunks are tagged with the
+// structured output attempt.
+func (e *Execution) postTextCompletion(ctx context.Context, client *httpclient.Client, i, attempt int, body TextCompletionReq) (TextCompletionResp, error) {
+	resp := TextCompletionResp{}
+	req := forModel(httpclient.SetTokenCost(client.R().SetContext(ctx), body.tokenCost(tokenCounter(ctx, body.Model))), body.Model)
+	if e.streamHandler == nil {
+		req.SetResult(&resp).SetBody(body)
+		_, err := req.Post(completionsPath)
+		return resp, err
+	}
+
+	return streamTextCompletion(client, req, body, func(choice int, text string) {
+		e.streamMu.Lock()
+		defer e.streamMu.Unlock()
+
+		e.streamHandler(TextCompletionChunk{
+			InputIndex:  i,
+			ChoiceIndex: choice,
+			Attempt:     attempt,
+			Text:        text,
+		})
+	})
+}
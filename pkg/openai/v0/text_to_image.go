@@ -1,5 +1,7 @@
 package openai
 
+import "fmt"
+
 const (
 	imgGenerationPath = "/v1/images/generations"
 )
@@ -38,3 +40,17 @@ type ImageGenerationsRespData struct {
 type ImageGenerationsResp struct {
 	Data []ImageGenerationsRespData `json:"data"`
 }
+
+// imageGenerationsOutput converts the generated images, encoded in the
+// format of mimeType, into the task output.
+func imageGenerationsOutput(resp ImageGenerationsResp, mimeType string) ImageGenerationsOutput {
+	results := []ImageGenerationsOutputResult{}
+	for _, data := range resp.Data {
+		results = append(results, ImageGenerationsOutputResult{
+			Image:         fmt.Sprintf("data:%s;base64,%s", mimeType, data.Image),
+			RevisedPrompt: data.RevisedPrompt,
+		})
+	}
+
+	return ImageGenerationsOutput{Results: results}
+}
@@ -0,0 +1,96 @@
+package openai
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+
+	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/x/errmsg"
+)
+
+const (
+	// maxImageSize is the maximum size of an image in a vision request.
+	maxImageSize = 20 << 20
+)
+
+var (
+	supportedImageTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+	imageDetails        = []string{"auto", "low", "high"}
+)
+
+// imageContents builds the message contents for the images of a vision
+// request. Images can be URLs, which are passed as-is, or base64-encoded
+// files. The details, if present, are applied to the image in the same
+// position.
+func imageContents(images, details []string) ([]Content, error) {
+	if len(details) > len(images) {
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("more image details than images"),
+			fmt.Sprintf("Received %d image details for %d images.", len(details), len(images)),
+		)
+	}
+
+	contents := make([]Content, 0, len(images))
+	for i, image := range images {
+		imageURL, err := imageURL(image)
+		if err != nil {
+			return nil, errmsg.AddMessage(
+				fmt.Errorf("processing image %d: %w", i, err),
+				fmt.Sprintf("Image %d is invalid.", i),
+			)
+		}
+
+		if i < len(details) && details[i] != "" {
+			if !slices.Contains(imageDetails, details[i]) {
+				return nil, errmsg.AddMessage(
+					fmt.Errorf("unsupported image detail: %s", details[i]),
+					fmt.Sprintf("Image detail %q isn't supported. Use one of %s.", details[i], strings.Join(imageDetails, ", ")),
+				)
+			}
+
+			imageURL.Detail = details[i]
+		}
+
+		contents = append(contents, Content{Type: "image_url", ImageURL: imageURL})
+	}
+
+	return contents, nil
+}
+
+func imageURL(image string) (*ImageURL, error) {
+	if strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://") {
+		if _, err := url.ParseRequestURI(image); err != nil {
+			return nil, errmsg.AddMessage(err, "The image URL can't be parsed.")
+		}
+
+		return &ImageURL{URL: image}, nil
+	}
+
+	b64 := base.TrimBase64Mime(image)
+	b, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, errmsg.AddMessage(err, "Images must be URLs or base64-encoded files.")
+	}
+
+	if len(b) > maxImageSize {
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("image too large: %d bytes", len(b)),
+			fmt.Sprintf("The image size (%.1f MB) exceeds the %d MB limit.", float64(len(b))/(1<<20), maxImageSize>>20),
+		)
+	}
+
+	mimeType := mimetype.Detect(b).String()
+	if !slices.Contains(supportedImageTypes, mimeType) {
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("unsupported image type: %s", mimeType),
+			fmt.Sprintf("The image format (%s) isn't supported. Use one of %s.", mimeType, strings.Join(supportedImageTypes, ", ")),
+		)
+	}
+
+	return &ImageURL{URL: fmt.Sprintf("data:%s;base64,%s", mimeType, b64)}, nil
+}
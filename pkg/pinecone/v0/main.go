@@ -1,6 +1,7 @@
 package pinecone
 
 import (
+	"context"
 	_ "embed"
 	"sync"
 
@@ -9,6 +10,7 @@ import (
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
 	"github.com/instill-ai/connector/pkg/util/httpclient"
 
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
@@ -37,6 +39,7 @@ type Connector struct {
 
 type Execution struct {
 	base.Execution
+	util.ExecutionContext
 }
 
 func Init(logger *zap.Logger) base.IConnector {
@@ -64,6 +67,7 @@ func newClient(config *structpb.Struct, logger *zap.Logger) *httpclient.Client {
 	c := httpclient.New("Pinecone", getURL(config),
 		httpclient.WithLogger(logger),
 		httpclient.WithEndUserError(new(errBody)),
+		httpclient.WithRetry(httpclient.DefaultRetryPolicy),
 	)
 
 	c.SetHeader("Api-Key", getAPIKey(config))
@@ -80,11 +84,11 @@ func getURL(config *structpb.Struct) string {
 }
 
 func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
-	req := newClient(e.Config, e.Logger).R()
-	outputs := []*structpb.Struct{}
+	client := newClient(e.Config, e.Logger)
 
-	for _, input := range inputs {
+	return util.ExecuteConcurrently(e.Context(), inputs, util.Concurrency(e.Context()), func(ctx context.Context, _ int, input *structpb.Struct) (*structpb.Struct, error) {
 		var output *structpb.Struct
+		req := client.R().SetContext(ctx)
 		switch e.Task {
 		case taskQuery:
 			inputStruct := queryInput{}
@@ -135,9 +139,8 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 				return nil, err
 			}
 		}
-		outputs = append(outputs, output)
-	}
-	return outputs, nil
+		return output, nil
+	})
 }
 
 func (c *Connector) Test(defUID uuid.UUID, config *structpb.Struct, logger *zap.Logger) (pipelinePB.Connector_State, error) {
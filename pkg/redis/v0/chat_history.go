@@ -71,17 +71,17 @@ type ChatHistoryRetrieveOutput struct {
 }
 
 // WriteSystemMessage writes system message for a given session ID
-func WriteSystemMessage(client *goredis.Client, sessionID string, message MultiModalMessageWithTime) error {
+func WriteSystemMessage(ctx context.Context, client *goredis.Client, sessionID string, message MultiModalMessageWithTime) error {
 	messageJSON, err := json.Marshal(message)
 	if err != nil {
 		return err
 	}
 
 	// Store in a hash with a unique SessionID
-	return client.HSet(context.Background(), "chat_history:system_messages", sessionID, messageJSON).Err()
+	return client.HSet(ctx, "chat_history:system_messages", sessionID, messageJSON).Err()
 }
 
-func WriteNonSystemMessage(client *goredis.Client, sessionID string, message MultiModalMessageWithTime) error {
+func WriteNonSystemMessage(ctx context.Context, client *goredis.Client, sessionID string, message MultiModalMessageWithTime) error {
 	// Marshal the MessageWithTime struct to JSON
 	messageJSON, err := json.Marshal(message)
 	if err != nil {
@@ -89,15 +89,15 @@ func WriteNonSystemMessage(client *goredis.Client, sessionID string, message Mul
 	}
 
 	// Index by Timestamp: Add to the Sorted Set
-	return client.ZAdd(context.Background(), "chat_history:"+sessionID+":timestamps", goredis.Z{
+	return client.ZAdd(ctx, "chat_history:"+sessionID+":timestamps", goredis.Z{
 		Score:  float64(message.Timestamp),
 		Member: string(messageJSON),
 	}).Err()
 }
 
 // RetrieveSystemMessage gets system message based on a given session ID
-func RetrieveSystemMessage(client *goredis.Client, sessionID string) (bool, *MultiModalMessageWithTime, error) {
-	serializedMessage, err := client.HGet(context.Background(), "chat_history:system_messages", sessionID).Result()
+func RetrieveSystemMessage(ctx context.Context, client *goredis.Client, sessionID string) (bool, *MultiModalMessageWithTime, error) {
+	serializedMessage, err := client.HGet(ctx, "chat_history:system_messages", sessionID).Result()
 
 	// Check if the messageID does not exist
 	if err == goredis.Nil {
@@ -116,7 +116,7 @@ func RetrieveSystemMessage(client *goredis.Client, sessionID string) (bool, *Mul
 	return true, &message, nil
 }
 
-func WriteMessage(client *goredis.Client, input ChatMessageWriteInput) ChatMessageWriteOutput {
+func WriteMessage(ctx context.Context, client *goredis.Client, input ChatMessageWriteInput) ChatMessageWriteOutput {
 	// Current time
 	currTime := time.Now().Unix()
 
@@ -137,7 +137,7 @@ func WriteMessage(client *goredis.Client, input ChatMessageWriteInput) ChatMessa
 
 	// Treat system message differently
 	if input.Role == "system" {
-		err := WriteSystemMessage(client, input.SessionID, messageWithTime)
+		err := WriteSystemMessage(ctx, client, input.SessionID, messageWithTime)
 		if err != nil {
 			return ChatMessageWriteOutput{Status: false}
 		} else {
@@ -145,7 +145,7 @@ func WriteMessage(client *goredis.Client, input ChatMessageWriteInput) ChatMessa
 		}
 	}
 
-	err := WriteNonSystemMessage(client, input.SessionID, messageWithTime)
+	err := WriteNonSystemMessage(ctx, client, input.SessionID, messageWithTime)
 	if err != nil {
 		return ChatMessageWriteOutput{Status: false}
 	} else {
@@ -153,7 +153,7 @@ func WriteMessage(client *goredis.Client, input ChatMessageWriteInput) ChatMessa
 	}
 }
 
-func WriteMultiModelMessage(client *goredis.Client, input ChatMultiModalMessageWriteInput) ChatMessageWriteOutput {
+func WriteMultiModelMessage(ctx context.Context, client *goredis.Client, input ChatMultiModalMessageWriteInput) ChatMessageWriteOutput {
 	// Current time
 	currTime := time.Now().Unix()
 
@@ -169,7 +169,7 @@ func WriteMultiModelMessage(client *goredis.Client, input ChatMultiModalMessageW
 
 	// Treat system message differently
 	if input.Role == "system" {
-		err := WriteSystemMessage(client, input.SessionID, messageWithTime)
+		err := WriteSystemMessage(ctx, client, input.SessionID, messageWithTime)
 		if err != nil {
 			return ChatMessageWriteOutput{Status: false}
 		} else {
@@ -177,7 +177,7 @@ func WriteMultiModelMessage(client *goredis.Client, input ChatMultiModalMessageW
 		}
 	}
 
-	err := WriteNonSystemMessage(client, input.SessionID, messageWithTime)
+	err := WriteNonSystemMessage(ctx, client, input.SessionID, messageWithTime)
 	if err != nil {
 		return ChatMessageWriteOutput{Status: false}
 	} else {
@@ -186,7 +186,7 @@ func WriteMultiModelMessage(client *goredis.Client, input ChatMultiModalMessageW
 }
 
 // RetrieveSessionMessages retrieves the latest K conversation turns from the Redis list for the given session ID
-func RetrieveSessionMessages(client *goredis.Client, input ChatHistoryRetrieveInput) ChatHistoryRetrieveOutput {
+func RetrieveSessionMessages(ctx context.Context, client *goredis.Client, input ChatHistoryRetrieveInput) ChatHistoryRetrieveOutput {
 	if input.LatestK == nil || *input.LatestK <= 0 {
 		input.LatestK = &DefaultLatestK
 	}
@@ -194,7 +194,6 @@ func RetrieveSessionMessages(client *goredis.Client, input ChatHistoryRetrieveIn
 
 	messagesWithTime := []MultiModalMessageWithTime{}
 	messages := []*MultiModalMessage{}
-	ctx := context.Background()
 
 	// Retrieve the latest K conversation turns associated with the session ID by descending timestamp order
 	messagesNum := *input.LatestK * 2
@@ -225,7 +224,7 @@ func RetrieveSessionMessages(client *goredis.Client, input ChatHistoryRetrieveIn
 
 	// Add System message if exist
 	if input.IncludeSystemMessage {
-		exist, sysMessage, err := RetrieveSystemMessage(client, input.SessionID)
+		exist, sysMessage, err := RetrieveSystemMessage(ctx, client, input.SessionID)
 		if err != nil {
 			return ChatHistoryRetrieveOutput{
 				Messages: messages,
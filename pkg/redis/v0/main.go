@@ -11,6 +11,7 @@ import (
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
 
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
 )
@@ -37,6 +38,7 @@ type Connector struct {
 
 type Execution struct {
 	base.Execution
+	util.ExecutionContext
 }
 
 func Init(logger *zap.Logger) base.IConnector {
@@ -69,6 +71,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 	}
 	defer client.Close()
 
+	ctx := e.Context()
 	for _, input := range inputs {
 		var output *structpb.Struct
 		switch e.Task {
@@ -78,7 +81,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 			if err != nil {
 				return nil, err
 			}
-			outputStruct := WriteMessage(client, inputStruct)
+			outputStruct := WriteMessage(ctx, client, inputStruct)
 			output, err = base.ConvertToStructpb(outputStruct)
 			if err != nil {
 				return nil, err
@@ -89,7 +92,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 			if err != nil {
 				return nil, err
 			}
-			outputStruct := WriteMultiModelMessage(client, inputStruct)
+			outputStruct := WriteMultiModelMessage(ctx, client, inputStruct)
 			output, err = base.ConvertToStructpb(outputStruct)
 			if err != nil {
 				return nil, err
@@ -100,7 +103,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 			if err != nil {
 				return nil, err
 			}
-			outputStruct := RetrieveSessionMessages(client, inputStruct)
+			outputStruct := RetrieveSessionMessages(ctx, client, inputStruct)
 			output, err = base.ConvertToStructpb(outputStruct)
 			if err != nil {
 				return nil, err
@@ -108,6 +111,12 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 		default:
 			return nil, fmt.Errorf("unsupported task: %s", e.Task)
 		}
+
+		// The chat history operations report failures through the output
+		// status, which would hide a cancellation.
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		outputs = append(outputs, output)
 	}
 	return outputs, nil
@@ -20,6 +20,7 @@ type TaskOutput struct {
 func newClient(config *structpb.Struct, logger *zap.Logger) (*httpclient.Client, error) {
 	c := httpclient.New("REST API", "",
 		httpclient.WithLogger(logger),
+		httpclient.WithRetry(httpclient.DefaultRetryPolicy),
 	)
 
 	auth, err := getAuthentication(config)
@@ -1,6 +1,7 @@
 package restapi
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
 	"github.com/instill-ai/connector/pkg/util/httpclient"
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
 	"github.com/instill-ai/x/errmsg"
@@ -153,6 +155,34 @@ func TestConnector_Execute(t *testing.T) {
 		c.Check(resp["status_code"], qt.Equals, float64(http.StatusOK))
 		c.Check(resp["body"], qt.ContentEquals, map[string]any{"title": "Be the wheel"})
 	})
+
+	c.Run("nok - cancelled execution", func(c *qt.C) {
+		reached := make(chan struct{})
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(reached)
+
+			// Hold the request until the client goes away.
+			<-r.Context().Done()
+		})
+
+		srv := httptest.NewServer(h)
+		c.Cleanup(srv.Close)
+
+		exec, err := connector.CreateExecution(defID, taskGet, cfg(noAuthType), logger)
+		c.Assert(err, qt.IsNil)
+
+		pbIn, err := base.ConvertToStructpb(TaskInput{EndpointURL: srv.URL + path})
+		c.Assert(err, qt.IsNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-reached
+			cancel()
+		}()
+
+		_, err = util.ExecuteWithContext(ctx, exec, []*structpb.Struct{pbIn})
+		c.Check(err, qt.ErrorIs, context.Canceled)
+	})
 }
 
 func TestConnector_Test(t *testing.T) {
@@ -1,6 +1,7 @@
 package restapi
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
 	"errors"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/gofrs/uuid"
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
 	"github.com/instill-ai/x/errmsg"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
@@ -55,6 +57,7 @@ type Connector struct {
 
 type Execution struct {
 	base.Execution
+	util.ExecutionContext
 }
 
 func Init(logger *zap.Logger) base.IConnector {
@@ -126,8 +129,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 		)
 	}
 
-	outputs := []*structpb.Struct{}
-	for _, input := range inputs {
+	return util.ExecuteConcurrently(e.Context(), inputs, util.Concurrency(e.Context()), func(ctx context.Context, _ int, input *structpb.Struct) (*structpb.Struct, error) {
 		taskIn := TaskInput{}
 		taskOut := TaskOutput{}
 
@@ -142,7 +144,7 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 		}
 
 		// An API error is a valid output in this connector.
-		req := client.R().SetResult(&taskOut.Body).SetError(&taskOut.Body)
+		req := client.R().SetContext(ctx).SetResult(&taskOut.Body).SetError(&taskOut.Body)
 		if taskIn.Body != nil {
 			req.SetBody(taskIn.Body)
 		}
@@ -155,14 +157,8 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 		taskOut.StatusCode = resp.StatusCode()
 		taskOut.Header = resp.Header()
 
-		output, err := base.ConvertToStructpb(taskOut)
-		if err != nil {
-			return nil, err
-		}
-
-		outputs = append(outputs, output)
-	}
-	return outputs, nil
+		return base.ConvertToStructpb(taskOut)
+	})
 }
 
 func (c *Connector) Test(defUID uuid.UUID, config *structpb.Struct, logger *zap.Logger) (pipelinePB.Connector_State, error) {
@@ -1,15 +1,20 @@
 package stabilityai
 
 import (
+	"github.com/gofrs/uuid"
 	"github.com/instill-ai/connector/pkg/util/httpclient"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
-func newClient(config *structpb.Struct, logger *zap.Logger) *httpclient.Client {
+// newClient returns a Stability AI client. Clients of the same connector
+// definition and API key share their rate limit.
+func newClient(defUID uuid.UUID, config *structpb.Struct, logger *zap.Logger) *httpclient.Client {
 	c := httpclient.New("Stability AI", getBasePath(config),
 		httpclient.WithLogger(logger),
 		httpclient.WithEndUserError(new(errBody)),
+		httpclient.WithRetry(httpclient.DefaultRetryPolicy),
+		httpclient.WithRateLimit(defUID.String()+getAPIKey(config), getRateLimit(config)),
 	)
 
 	c.SetAuthToken(getAPIKey(config))
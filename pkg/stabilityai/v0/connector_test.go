@@ -1,6 +1,7 @@
 package stabilityai
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
 	"github.com/instill-ai/connector/pkg/util/httpclient"
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
 	"github.com/instill-ai/x/errmsg"
@@ -121,6 +123,59 @@ func TestConnector_ExecuteImageFromText(t *testing.T) {
 		})
 	}
 
+	c.Run("ok - partial failures", func(c *qt.C) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req TextToImageReq
+			c.Check(json.NewDecoder(r.Body).Decode(&req), qt.IsNil)
+
+			w.Header().Set("Content-Type", httpclient.MIMETypeJSON)
+			if req.TextPrompts[0].Text != text {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintln(w, `{"message": "Invalid prompt"}`)
+				return
+			}
+
+			fmt.Fprint(w, okResp)
+		})
+
+		srv := httptest.NewServer(h)
+		c.Cleanup(srv.Close)
+
+		config, err := structpb.NewStruct(map[string]any{
+			"base_path": srv.URL,
+			"api_key":   apiKey,
+		})
+		c.Assert(err, qt.IsNil)
+
+		exec, err := connector.CreateExecution(defID, textToImageTask, config, logger)
+		c.Assert(err, qt.IsNil)
+
+		inputs := make([]*structpb.Struct, 3)
+		for i, in := range []map[string]any{
+			{"engine": "foo", "prompts": []any{text}},
+			{"engine": "stable-diffusion-v1-6", "prompts": []any{"a cat"}},
+			{"engine": "stable-diffusion-v1-6", "prompts": []any{text}},
+		} {
+			inputs[i], err = structpb.NewStruct(in)
+			c.Assert(err, qt.IsNil)
+		}
+
+		ctx := util.WithPartialFailures(context.Background())
+		got, err := util.ExecuteWithContext(ctx, exec, inputs)
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.HasLen, 3)
+
+		c.Check(got[0].AsMap()["error"], qt.ContentEquals, map[string]any{
+			"code":    "INVALID_ARGUMENT",
+			"message": `inputs[0].engine: value must be one of "stable-diffusion-xl-1024-v1-0", "stable-diffusion-xl-1024-v0-9", "stable-diffusion-v1-6", "esrgan-v1-x2plus", "stable-diffusion-512-v2-1", "stable-diffusion-xl-beta-v2-2-2"`,
+		})
+		c.Check(got[1].AsMap()["error"], qt.ContentEquals, map[string]any{
+			"code":    "INVALID_ARGUMENT",
+			"message": "Stability AI responded with a 400 status code. Invalid prompt",
+		})
+		c.Check(got[2].AsMap()["seeds"], qt.ContentEquals, []any{float64(1234)})
+	})
+
 	c.Run("nok - unsupported task", func(c *qt.C) {
 		task := "FOOBAR"
 		exec, err := connector.CreateExecution(defID, task, new(structpb.Struct), logger)
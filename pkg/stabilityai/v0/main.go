@@ -1,6 +1,7 @@
 package stabilityai
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"sync"
@@ -10,6 +11,8 @@ import (
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
+	"github.com/instill-ai/connector/pkg/util/httpclient"
 	"github.com/instill-ai/x/errmsg"
 
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
@@ -38,6 +41,7 @@ type Connector struct {
 
 type Execution struct {
 	base.Execution
+	util.ExecutionContext
 }
 
 func Init(logger *zap.Logger) base.IConnector {
@@ -65,6 +69,12 @@ func getAPIKey(config *structpb.Struct) string {
 	return config.GetFields()["api_key"].GetStringValue()
 }
 
+func getRateLimit(config *structpb.Struct) httpclient.RateLimit {
+	return httpclient.RateLimit{
+		RequestsPerMinute: int(config.GetFields()["requests_per_minute"].GetNumberValue()),
+	}
+}
+
 // getBasePath returns Stability AI's API URL. This configuration param allows
 // us to override the API the connector will point to. It isn't meant to be
 // exposed to users. Rather, it can serve to test the logic against a fake
@@ -80,69 +90,71 @@ func getBasePath(config *structpb.Struct) string {
 }
 
 func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
-	client := newClient(e.Config, e.Logger)
-	outputs := []*structpb.Struct{}
-
-	for _, input := range inputs {
-		switch e.Task {
-		case textToImageTask:
-			params, err := parseTextToImageReq(input)
-			if err != nil {
-				return inputs, err
-			}
-
-			resp := ImageTaskRes{}
-			req := client.R().SetResult(&resp).SetBody(params)
-
-			if _, err := req.Post(params.path); err != nil {
-				return inputs, err
-			}
-
-			output, err := textToImageOutput(resp)
-			if err != nil {
-				return nil, err
-			}
-
-			outputs = append(outputs, output)
-		case imageToImageTask:
-			params, err := parseImageToImageReq(input)
-			if err != nil {
-				return inputs, err
-			}
-
-			data, ct, err := params.getBytes()
-			if err != nil {
-				return inputs, err
-			}
-
-			resp := ImageTaskRes{}
-			req := client.R().SetBody(data).SetResult(&resp).SetHeader("Content-Type", ct)
-
-			if _, err := req.Post(params.path); err != nil {
-				return inputs, err
-			}
-
-			output, err := imageToImageOutput(resp)
-			if err != nil {
-				return nil, err
-			}
-
-			outputs = append(outputs, output)
-
-		default:
-			return nil, errmsg.AddMessage(
-				fmt.Errorf("not supported task: %s", e.Task),
-				fmt.Sprintf("%s task is not supported.", e.Task),
-			)
+	client := newClient(e.UID, e.Config, e.Logger)
+
+	return util.ExecuteConcurrently(e.Context(), inputs, util.Concurrency(e.Context()), func(ctx context.Context, _ int, input *structpb.Struct) (*structpb.Struct, error) {
+		return e.executeOne(ctx, client, input)
+	})
+}
+
+func (e *Execution) executeOne(ctx context.Context, client *httpclient.Client, input *structpb.Struct) (*structpb.Struct, error) {
+	switch e.Task {
+	case textToImageTask:
+		params, err := parseTextToImageReq(input)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := ImageTaskRes{}
+		req := client.R().SetContext(ctx).SetResult(&resp).SetBody(params)
+
+		if _, err := req.Post(params.path); err != nil {
+			return nil, err
+		}
+
+		output, err := textToImageOutput(resp)
+		if err != nil {
+			return nil, err
 		}
+
+		return output, nil
+	case imageToImageTask:
+		params, err := parseImageToImageReq(input)
+		if err != nil {
+			return nil, err
+		}
+
+		data, ct, err := params.getBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		resp := ImageTaskRes{}
+		req := client.R().SetContext(ctx).SetBody(data).SetResult(&resp).SetHeader("Content-Type", ct)
+
+		if _, err := req.Post(params.path); err != nil {
+			return nil, err
+		}
+
+		output, err := imageToImageOutput(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		return output, nil
+
+	default:
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("not supported task: %s", e.Task),
+			fmt.Sprintf("%s task is not supported.", e.Task),
+		)
 	}
-	return outputs, nil
 }
 
 // Test checks the connector state.
-func (c *Connector) Test(_ uuid.UUID, config *structpb.Struct, logger *zap.Logger) (pipelinePB.Connector_State, error) {
+func (c *Connector) Test(defUID uuid.UUID, config *structpb.Struct, logger *zap.Logger) (pipelinePB.Connector_State, error) {
 	var engines []Engine
-	req := newClient(config, logger).R().SetResult(&engines)
+	req := newClient(defUID, config, logger).R().SetResult(&engines)
 
 	if _, err := req.Get(listEnginesPath); err != nil {
 		return pipelinePB.Connector_STATE_ERROR, err
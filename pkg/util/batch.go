@@ -0,0 +1,164 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// DefaultConcurrency is the default number of inputs of a batch that a
+// connector processes at the same time.
+const DefaultConcurrency = 8
+
+type concurrencyKey struct{}
+
+// WithConcurrency returns a context that sets the number of inputs of a batch
+// that the executions running with it process at the same time (see
+// ExecuteWithContext), e.g. to fit the quota of an account. Values below 1
+// are ignored.
+func WithConcurrency(ctx context.Context, concurrency int) context.Context {
+	return context.WithValue(ctx, concurrencyKey{}, concurrency)
+}
+
+// Concurrency returns the batch concurrency set in a context (see
+// WithConcurrency) or DefaultConcurrency.
+func Concurrency(ctx context.Context) int {
+	if n, ok := ctx.Value(concurrencyKey{}).(int); ok && n > 0 {
+		return n
+	}
+
+	return DefaultConcurrency
+}
+
+type batchIndexesKey struct{}
+
+// withBatchIndexes returns a context that holds the index of each input of a
+// batch. Executions with partial failures run each input as a batch of its
+// own, and the index lets them report the position of the input in the
+// original batch (see BatchIndex).
+func withBatchIndexes(ctx context.Context, inputs []*structpb.Struct) context.Context {
+	indexes := make(map[*structpb.Struct]int, len(inputs))
+	for i, input := range inputs {
+		if _, ok := indexes[input]; !ok {
+			indexes[input] = i
+		}
+	}
+
+	return context.WithValue(ctx, batchIndexesKey{}, indexes)
+}
+
+// BatchIndex returns the index of an input in the batch passed to the
+// execution (see ExecuteWithContext). It's i, the position of the input in
+// the inputs of Execute, unless the input was executed on its own.
+func BatchIndex(ctx context.Context, i int, input *structpb.Struct) int {
+	indexes, _ := ctx.Value(batchIndexesKey{}).(map[*structpb.Struct]int)
+	if j, ok := indexes[input]; ok {
+		return j
+	}
+
+	return i
+}
+
+// ExecuteFunc processes a single input of a batch. The context is cancelled
+// when the execution of the batch fails. The index of the input is its
+// position in the batch passed to the execution (see BatchIndex).
+type ExecuteFunc func(ctx context.Context, i int, input *structpb.Struct) (*structpb.Struct, error)
+
+// ExecuteConcurrently processes the inputs of a batch in parallel, with at
+// most `concurrency` inputs being processed at the same time. Outputs are
+// returned in the same order as the inputs.
+//
+// If the execution of an input fails, the rest of the batch is cancelled and
+// the errors of the failed inputs are returned, annotated with their index.
+func ExecuteConcurrently(ctx context.Context, inputs []*structpb.Struct, concurrency int, execute ExecuteFunc) ([]*structpb.Struct, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	outputs := make([]*structpb.Struct, len(inputs))
+	errs := make([]error, len(inputs))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+launch:
+	for i, input := range inputs {
+		// Select doesn't prioritize the cancellation when both cases are
+		// ready.
+		if ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break launch
+		}
+
+		wg.Add(1)
+		go func(i int, input *structpb.Struct) {
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("panic: %v", r)
+					cancel()
+				}
+
+				<-sem
+				wg.Done()
+			}()
+
+			output, err := execute(ctx, BatchIndex(ctx, i, input), input)
+			if err != nil {
+				errs[i] = err
+				cancel()
+				return
+			}
+
+			outputs[i] = output
+		}(i, input)
+	}
+
+	wg.Wait()
+
+	if err := batchError(ctx, inputs, errs); err != nil {
+		return nil, err
+	}
+
+	// The batch might have been interrupted before launching every input.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return outputs, nil
+}
+
+// batchError aggregates the errors of a batch. Errors caused by the
+// cancellation of the batch are only reported when no other error is found.
+func batchError(ctx context.Context, inputs []*structpb.Struct, errs []error) error {
+	var failed, cancelled []error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		err = fmt.Errorf("input %d: %w", BatchIndex(ctx, i, inputs[i]), err)
+		if errors.Is(err, context.Canceled) {
+			cancelled = append(cancelled, err)
+			continue
+		}
+
+		failed = append(failed, err)
+	}
+
+	if len(failed) > 0 {
+		return errors.Join(failed...)
+	}
+
+	return errors.Join(cancelled...)
+}
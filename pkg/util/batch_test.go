@@ -0,0 +1,113 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/instill-ai/x/errmsg"
+)
+
+func TestExecuteConcurrently(t *testing.T) {
+	c := qt.New(t)
+
+	inputs := make([]*structpb.Struct, 20)
+	for i := range inputs {
+		inputs[i], _ = structpb.NewStruct(map[string]any{"n": i})
+	}
+
+	double := func(_ context.Context, _ int, in *structpb.Struct) (*structpb.Struct, error) {
+		n := in.Fields["n"].GetNumberValue()
+
+		// Make later inputs finish first.
+		time.Sleep(time.Duration(20-n) * time.Millisecond)
+		return structpb.NewStruct(map[string]any{"n": 2 * n})
+	}
+
+	c.Run("ok - preserves order", func(c *qt.C) {
+		got, err := ExecuteConcurrently(context.Background(), inputs, 4, double)
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.HasLen, len(inputs))
+		for i, out := range got {
+			c.Check(out.Fields["n"].GetNumberValue(), qt.Equals, float64(2*i))
+		}
+	})
+
+	c.Run("ok - bounded parallelism", func(c *qt.C) {
+		var running, maxRunning atomic.Int32
+		_, err := ExecuteConcurrently(context.Background(), inputs, 3, func(ctx context.Context, i int, in *structpb.Struct) (*structpb.Struct, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+
+			return double(ctx, i, in)
+		})
+		c.Assert(err, qt.IsNil)
+		c.Check(maxRunning.Load(), qt.Equals, int32(3))
+	})
+
+	c.Run("nok - errors are aggregated and the batch is cancelled", func(c *qt.C) {
+		var started atomic.Int32
+
+		// Failing inputs wait for each other so both are executed.
+		var failing sync.WaitGroup
+		failing.Add(2)
+
+		_, err := ExecuteConcurrently(context.Background(), inputs, 4, func(ctx context.Context, i int, _ *structpb.Struct) (*structpb.Struct, error) {
+			started.Add(1)
+			if i == 1 || i == 2 {
+				failing.Done()
+				failing.Wait()
+			}
+
+			switch i {
+			case 1:
+				return nil, errmsg.AddMessage(fmt.Errorf("boom"), "Something went wrong.")
+			case 2:
+				return nil, fmt.Errorf("bang")
+			}
+
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+		c.Check(err, qt.ErrorMatches, "input 1: boom\ninput 2: bang")
+		c.Check(errmsg.Message(err), qt.Equals, "Something went wrong.")
+		c.Check(started.Load() < int32(len(inputs)), qt.IsTrue)
+	})
+
+	c.Run("nok - panic", func(c *qt.C) {
+		_, err := ExecuteConcurrently(context.Background(), inputs[:1], 4, func(context.Context, int, *structpb.Struct) (*structpb.Struct, error) {
+			panic("oops")
+		})
+		c.Check(err, qt.ErrorMatches, "input 0: panic: oops")
+	})
+
+	c.Run("nok - cancelled context", func(c *qt.C) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := ExecuteConcurrently(ctx, inputs, 4, double)
+		c.Check(err, qt.ErrorIs, context.Canceled)
+	})
+}
+
+func TestConcurrency(t *testing.T) {
+	c := qt.New(t)
+
+	c.Check(Concurrency(context.Background()), qt.Equals, DefaultConcurrency)
+	c.Check(Concurrency(WithConcurrency(context.Background(), 2)), qt.Equals, 2)
+	c.Check(Concurrency(WithConcurrency(context.Background(), 0)), qt.Equals, DefaultConcurrency)
+}
@@ -0,0 +1,65 @@
+package util
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/instill-ai/component/pkg/base"
+)
+
+// ExecutionContext holds the context of a connector execution. The execution
+// interface doesn't take a context, so executions embed this type to let the
+// caller propagate its deadline and cancellation signal to the calls the
+// connector makes (see ExecuteWithContext).
+type ExecutionContext struct {
+	ctx context.Context
+}
+
+// SetContext sets the context of the execution.
+func (ec *ExecutionContext) SetContext(ctx context.Context) {
+	ec.ctx = ctx
+}
+
+// Context returns the context of the execution. If no context has been set, a
+// background context is returned.
+func (ec *ExecutionContext) Context() context.Context {
+	if ec.ctx == nil {
+		return context.Background()
+	}
+
+	return ec.ctx
+}
+
+type contextSetter interface {
+	SetContext(context.Context)
+}
+
+// ExecuteWithContext validates and executes the inputs of an execution. If
+// the execution supports it, the context is propagated to its calls, so a
+// cancelled or timed out execution won't leave requests running in the
+// background.
+//
+// If the context enables partial failures (see WithPartialFailures), each
+// input is validated and executed separately and the output of a failed input
+// holds its error. The context can also set the number of inputs processed at
+// the same time (see WithConcurrency).
+func ExecuteWithContext(ctx context.Context, e base.IExecution, inputs []*structpb.Struct) ([]*structpb.Struct, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if partialFailures(ctx) {
+		ctx = withBatchIndexes(ctx, inputs)
+	}
+
+	if s, ok := e.(contextSetter); ok {
+		s.SetContext(ctx)
+	}
+
+	if partialFailures(ctx) {
+		return executeWithPartialFailures(ctx, e, inputs)
+	}
+
+	return e.ExecuteWithValidation(inputs)
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/instill-ai/component/pkg/base"
+)
+
+type ctxExecution struct {
+	base.Execution
+	ExecutionContext
+
+	executed bool
+}
+
+func (e *ctxExecution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
+	e.executed = true
+	return inputs, e.Context().Err()
+}
+
+func (e *ctxExecution) ExecuteWithValidation(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
+	return e.Execute(inputs)
+}
+
+func TestExecuteWithContext(t *testing.T) {
+	c := qt.New(t)
+
+	type ctxKey struct{}
+	inputs := []*structpb.Struct{{}}
+
+	c.Run("ok - context is propagated", func(c *qt.C) {
+		e := new(ctxExecution)
+		c.Check(e.Context(), qt.Equals, context.Background())
+
+		ctx := context.WithValue(context.Background(), ctxKey{}, "foo")
+		got, err := ExecuteWithContext(ctx, e, inputs)
+		c.Check(err, qt.IsNil)
+		c.Check(got, qt.HasLen, len(inputs))
+		c.Check(e.executed, qt.IsTrue)
+		c.Check(e.Context().Value(ctxKey{}), qt.Equals, "foo")
+	})
+
+	c.Run("nok - cancelled context", func(c *qt.C) {
+		e := new(ctxExecution)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := ExecuteWithContext(ctx, e, inputs)
+		c.Check(err, qt.ErrorIs, context.Canceled)
+		c.Check(e.executed, qt.IsFalse)
+	})
+}
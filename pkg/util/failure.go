@@ -0,0 +1,201 @@
+package util
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util/httpclient"
+	"github.com/instill-ai/x/errmsg"
+)
+
+type partialFailuresKey struct{}
+
+// WithPartialFailures returns a context that enables partial failures in the
+// executions that run with it (see ExecuteWithContext). In this mode, a failed
+// input doesn't fail the whole batch. Instead, its output is replaced by a
+// structured error (see InputError) and the rest of the inputs are processed.
+func WithPartialFailures(ctx context.Context) context.Context {
+	return context.WithValue(ctx, partialFailuresKey{}, true)
+}
+
+func partialFailures(ctx context.Context) bool {
+	enabled, _ := ctx.Value(partialFailuresKey{}).(bool)
+	return enabled
+}
+
+// InputError describes the failure of an input in a batch executed with
+// partial failures.
+type InputError struct {
+	// Code is the canonical name of the error code (see google.rpc.Code),
+	// e.g. INVALID_ARGUMENT.
+	Code string `json:"code"`
+	// Message is the end-user message of the error.
+	Message string `json:"message"`
+}
+
+// NewInputError builds the structured error of a failed input.
+func NewInputError(err error) InputError {
+	return InputError{
+		Code:    errorCode(err).String(),
+		Message: errmsg.MessageOrErr(err),
+	}
+}
+
+// IsFailedOutput returns true if the output of an execution with partial
+// failures holds an error instead of a result.
+func IsFailedOutput(output *structpb.Struct) bool {
+	_, ok := output.GetFields()["error"]
+	return ok && len(output.GetFields()) == 1
+}
+
+func failedOutput(err error) (*structpb.Struct, error) {
+	return base.ConvertToStructpb(struct {
+		Error InputError `json:"error"`
+	}{
+		Error: NewInputError(err),
+	})
+}
+
+func httpStatusCode(status int) code.Code {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusRequestEntityTooLarge:
+		return code.Code_INVALID_ARGUMENT
+	case http.StatusUnauthorized:
+		return code.Code_UNAUTHENTICATED
+	case http.StatusForbidden:
+		return code.Code_PERMISSION_DENIED
+	case http.StatusNotFound:
+		return code.Code_NOT_FOUND
+	case http.StatusConflict:
+		return code.Code_ALREADY_EXISTS
+	case http.StatusTooManyRequests:
+		return code.Code_RESOURCE_EXHAUSTED
+	case http.StatusNotImplemented:
+		return code.Code_UNIMPLEMENTED
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return code.Code_UNAVAILABLE
+	case http.StatusGatewayTimeout:
+		return code.Code_DEADLINE_EXCEEDED
+	}
+
+	switch {
+	case status >= 500:
+		return code.Code_INTERNAL
+	case status >= 400:
+		return code.Code_FAILED_PRECONDITION
+	}
+
+	return code.Code_UNKNOWN
+}
+
+// errorCode classifies an execution error so failed inputs can be routed
+// (e.g. retried or sent to a dead-letter destination) by the caller.
+func errorCode(err error) code.Code {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return code.Code_CANCELLED
+	case errors.Is(err, context.DeadlineExceeded):
+		return code.Code_DEADLINE_EXCEEDED
+	}
+
+	respErr := new(httpclient.ResponseError)
+	if errors.As(err, &respErr) {
+		return httpStatusCode(respErr.StatusCode)
+	}
+
+	if s, ok := status.FromError(err); ok && s.Code() != codes.OK {
+		return code.Code(s.Code())
+	}
+
+	b64Err := new(base64.CorruptInputError)
+	if errors.As(err, b64Err) {
+		return code.Code_INVALID_ARGUMENT
+	}
+
+	// Outputs that don't match the schema are an error of the connector or
+	// the provider, not of the input.
+	schemaErr := new(SchemaError)
+	if errors.As(err, &schemaErr) {
+		if schemaErr.Target == "outputs" {
+			return code.Code_INTERNAL
+		}
+
+		return code.Code_INVALID_ARGUMENT
+	}
+
+	return code.Code_UNKNOWN
+}
+
+// executeWithPartialFailures validates and executes each input of a batch
+// separately, so a failed input doesn't discard the outputs of the rest of
+// the batch.
+func executeWithPartialFailures(ctx context.Context, e base.IExecution, inputs []*structpb.Struct) ([]*structpb.Struct, error) {
+	return ExecuteConcurrently(ctx, inputs, Concurrency(ctx), func(ctx context.Context, i int, input *structpb.Struct) (*structpb.Struct, error) {
+		outputs, err := e.ExecuteWithValidation([]*structpb.Struct{input})
+		if err != nil {
+			// A cancelled batch isn't a failure of its inputs.
+			if ctx.Err() != nil {
+				return nil, err
+			}
+
+			return failedOutput(schemaError(err, i))
+		}
+
+		if len(outputs) == 0 {
+			return nil, nil
+		}
+
+		return outputs[0], nil
+	})
+}
+
+// SchemaError is the error of an input, or of its output, that doesn't follow
+// the schema of the task.
+type SchemaError struct {
+	// Target is "inputs" or "outputs".
+	Target string
+	// Index is the position of the input in the batch.
+	Index int
+	// Err holds the validation errors of the input executed on its own,
+	// which point to the first position of the batch (e.g.
+	// inputs[0].prompt).
+	Err error
+}
+
+// schemaErrorLocation matches the location of the validation errors of an
+// input executed on its own. Validation errors are joined by "; ".
+var schemaErrorLocation = regexp.MustCompile(`(^|; )(inputs|outputs)\[0\]`)
+
+// Error points the validation errors to the position of the input in the
+// batch.
+func (e *SchemaError) Error() string {
+	return schemaErrorLocation.ReplaceAllString(e.Err.Error(), fmt.Sprintf("${1}${2}[%d]", e.Index))
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+// schemaError wraps the validation errors of an input executed on its own in
+// a SchemaError. The validation of the base package doesn't type its errors,
+// so they are recognised by the location they point to.
+func schemaError(err error, i int) error {
+	for _, target := range []string{"inputs", "outputs"} {
+		if strings.HasPrefix(err.Error(), target+"[0]") {
+			return &SchemaError{Target: target, Index: i, Err: err}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,263 @@
+package util
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util/httpclient"
+	"github.com/instill-ai/x/errmsg"
+)
+
+// failingExecution fails the inputs with a "fail" field.
+type failingExecution struct {
+	base.Execution
+	ExecutionContext
+}
+
+func (e *failingExecution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
+	return ExecuteConcurrently(e.Context(), inputs, Concurrency(e.Context()), func(ctx context.Context, _ int, in *structpb.Struct) (*structpb.Struct, error) {
+		if msg := in.Fields["fail"].GetStringValue(); msg != "" {
+			return nil, errmsg.AddMessage(&httpclient.ResponseError{StatusCode: http.StatusBadRequest}, msg)
+		}
+
+		return structpb.NewStruct(map[string]any{"n": in.Fields["n"].GetNumberValue()})
+	})
+}
+
+func (e *failingExecution) ExecuteWithValidation(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
+	return e.Execute(inputs)
+}
+
+// indexingExecution returns the index of each input, as a stream handler
+// would report it.
+type indexingExecution struct {
+	failingExecution
+}
+
+func (e *indexingExecution) ExecuteWithValidation(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
+	return ExecuteConcurrently(e.Context(), inputs, Concurrency(e.Context()), func(_ context.Context, i int, _ *structpb.Struct) (*structpb.Struct, error) {
+		return structpb.NewStruct(map[string]any{"index": i})
+	})
+}
+
+const (
+	testInputSchema  = `{"type": "object", "properties": {"n": {"type": "number", "maximum": 10}}}`
+	testOutputSchema = `{"type": "object", "properties": {"n": {"type": "number", "maximum": 5}}}`
+)
+
+// validatingExecution validates the inputs and outputs of failingExecution.
+type validatingExecution struct {
+	failingExecution
+}
+
+func (e *validatingExecution) ExecuteWithValidation(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
+	if err := e.Validate(inputs, testInputSchema, "inputs"); err != nil {
+		return nil, err
+	}
+
+	outputs, err := e.Execute(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.Validate(outputs, testOutputSchema, "outputs"); err != nil {
+		return nil, err
+	}
+
+	return outputs, nil
+}
+
+func TestExecuteWithContext_PartialFailures(t *testing.T) {
+	c := qt.New(t)
+
+	inputs := make([]*structpb.Struct, 4)
+	for i := range inputs {
+		in := map[string]any{"n": i}
+		if i%2 == 1 {
+			in["fail"] = fmt.Sprintf("Input %d is invalid.", i)
+		}
+
+		inputs[i], _ = structpb.NewStruct(in)
+	}
+
+	c.Run("nok - partial failures disabled", func(c *qt.C) {
+		_, err := ExecuteWithContext(context.Background(), new(failingExecution), inputs)
+		c.Check(err, qt.IsNotNil)
+	})
+
+	c.Run("ok - partial failures", func(c *qt.C) {
+		ctx := WithPartialFailures(context.Background())
+
+		got, err := ExecuteWithContext(ctx, new(failingExecution), inputs)
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.HasLen, len(inputs))
+
+		for i, out := range got {
+			if i%2 == 0 {
+				c.Check(IsFailedOutput(out), qt.IsFalse)
+				c.Check(out.AsMap(), qt.ContentEquals, map[string]any{"n": float64(i)})
+				continue
+			}
+
+			c.Check(IsFailedOutput(out), qt.IsTrue)
+			c.Check(out.AsMap(), qt.ContentEquals, map[string]any{
+				"error": map[string]any{
+					"code":    "INVALID_ARGUMENT",
+					"message": fmt.Sprintf("Input %d is invalid.", i),
+				},
+			})
+		}
+	})
+
+	c.Run("ok - schema errors", func(c *qt.C) {
+		ctx := WithPartialFailures(context.Background())
+
+		inputs := make([]*structpb.Struct, 3)
+		for i, n := range []float64{1, 8, 20} {
+			inputs[i], _ = structpb.NewStruct(map[string]any{"n": n})
+		}
+
+		got, err := ExecuteWithContext(ctx, new(validatingExecution), inputs)
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.HasLen, len(inputs))
+
+		c.Check(IsFailedOutput(got[0]), qt.IsFalse)
+
+		c.Check(IsFailedOutput(got[1]), qt.IsTrue)
+		outErr := got[1].Fields["error"].GetStructValue().AsMap()
+		c.Check(outErr["code"], qt.Equals, "INTERNAL")
+		c.Check(outErr["message"], qt.Matches, `outputs\[1\]\.n: .*`)
+
+		c.Check(IsFailedOutput(got[2]), qt.IsTrue)
+		inErr := got[2].Fields["error"].GetStructValue().AsMap()
+		c.Check(inErr["code"], qt.Equals, "INVALID_ARGUMENT")
+		c.Check(inErr["message"], qt.Matches, `inputs\[2\]\.n: .*`)
+	})
+
+	c.Run("ok - batch indexes", func(c *qt.C) {
+		ctx := WithPartialFailures(context.Background())
+
+		// Each input is executed on its own, but the execution sees its
+		// index in the batch.
+		got, err := ExecuteWithContext(ctx, new(indexingExecution), inputs)
+		c.Assert(err, qt.IsNil)
+		for i, out := range got {
+			c.Check(out.AsMap(), qt.ContentEquals, map[string]any{"index": float64(i)})
+		}
+	})
+
+	c.Run("nok - cancelled context", func(c *qt.C) {
+		ctx, cancel := context.WithCancel(WithPartialFailures(context.Background()))
+		cancel()
+
+		_, err := ExecuteWithContext(ctx, new(failingExecution), inputs)
+		c.Check(err, qt.ErrorIs, context.Canceled)
+	})
+}
+
+func TestNewInputError(t *testing.T) {
+	c := qt.New(t)
+
+	_, b64Err := base64.StdEncoding.DecodeString("not base64!")
+
+	testcases := []struct {
+		name     string
+		in       error
+		wantCode string
+		wantMsg  string
+	}{
+		{
+			name:     "HTTP error",
+			in:       errmsg.AddMessage(&httpclient.ResponseError{StatusCode: http.StatusTooManyRequests}, "Slow down."),
+			wantCode: "RESOURCE_EXHAUSTED",
+			wantMsg:  "Slow down.",
+		},
+		{
+			name:     "HTTP server error",
+			in:       fmt.Errorf("calling API: %w", &httpclient.ResponseError{StatusCode: http.StatusInternalServerError}),
+			wantCode: "INTERNAL",
+			wantMsg:  "calling API: unsuccessful HTTP response",
+		},
+		{
+			name:     "gRPC error",
+			in:       status.Error(codes.NotFound, "model not found"),
+			wantCode: "NOT_FOUND",
+			wantMsg:  "rpc error: code = NotFound desc = model not found",
+		},
+		{
+			name:     "invalid base64",
+			in:       fmt.Errorf("decoding image: %w", b64Err),
+			wantCode: "INVALID_ARGUMENT",
+			wantMsg:  "decoding image: illegal base64 data at input byte 3",
+		},
+		{
+			name:     "invalid input",
+			in:       schemaError(fmt.Errorf("inputs[0].n: must be <= 10 but found 20; inputs[0].m: expected string"), 2),
+			wantCode: "INVALID_ARGUMENT",
+			wantMsg:  "inputs[2].n: must be <= 10 but found 20; inputs[2].m: expected string",
+		},
+		{
+			name:     "invalid input with end-user message",
+			in:       schemaError(errmsg.AddMessage(fmt.Errorf("inputs[0].model: unknown model"), "Model foo isn't available."), 2),
+			wantCode: "INVALID_ARGUMENT",
+			wantMsg:  "Model foo isn't available.",
+		},
+		{
+			name:     "invalid output",
+			in:       schemaError(fmt.Errorf("outputs[0].n: must be <= 5 but found 8"), 1),
+			wantCode: "INTERNAL",
+			wantMsg:  "outputs[1].n: must be <= 5 but found 8",
+		},
+		{
+			name:     "not a schema error",
+			in:       schemaError(fmt.Errorf("calling API: %w", context.Canceled), 1),
+			wantCode: "CANCELLED",
+			wantMsg:  "calling API: context canceled",
+		},
+		{
+			name:     "timeout",
+			in:       fmt.Errorf("calling API: %w", context.DeadlineExceeded),
+			wantCode: "DEADLINE_EXCEEDED",
+			wantMsg:  "calling API: context deadline exceeded",
+		},
+		{
+			name:     "unknown",
+			in:       fmt.Errorf("foo"),
+			wantCode: "UNKNOWN",
+			wantMsg:  "foo",
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			got := NewInputError(tc.in)
+			c.Check(got.Code, qt.Equals, tc.wantCode)
+			c.Check(got.Message, qt.Equals, tc.wantMsg)
+		})
+	}
+}
+
+func TestSchemaError(t *testing.T) {
+	c := qt.New(t)
+
+	errInvalid := errmsg.AddMessage(fmt.Errorf("inputs[0].n: must be <= 10 but found 20"), "Invalid input.")
+	err := schemaError(errInvalid, 3)
+
+	c.Check(err, qt.ErrorMatches, `inputs\[3\]\.n: must be <= 10 but found 20`)
+	c.Check(err, qt.ErrorIs, errInvalid)
+	c.Check(errmsg.Message(err), qt.Equals, "Invalid input.")
+
+	schemaErr := new(SchemaError)
+	c.Assert(err, qt.ErrorAs, &schemaErr)
+	c.Check(schemaErr.Target, qt.Equals, "inputs")
+	c.Check(schemaErr.Index, qt.Equals, 3)
+}
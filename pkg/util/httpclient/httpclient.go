@@ -25,7 +25,8 @@ const (
 type Client struct {
 	*resty.Client
 
-	name string
+	name   string
+	logger *zap.Logger
 }
 
 // Option provides configuration options for a client.
@@ -36,6 +37,7 @@ type Option func(*Client)
 func WithLogger(logger *zap.Logger) Option {
 	return func(c *Client) {
 		logger := logger.With(zap.String("name", c.name))
+		c.logger = logger
 
 		c.SetLogger(logger.Sugar()).OnError(func(req *resty.Request, err error) {
 			logger := logger.With(zap.String("url", req.URL))
@@ -52,6 +54,15 @@ func WithLogger(logger *zap.Logger) Option {
 	}
 }
 
+// ResponseError is returned when an API responds with an error status code.
+type ResponseError struct {
+	StatusCode int
+}
+
+func (e *ResponseError) Error() string {
+	return "unsuccessful HTTP response"
+}
+
 // ErrBody allows Client to extract an error message from the API.
 type ErrBody interface {
 	Message() string
@@ -78,13 +89,17 @@ func wrapWithErrMessage(apiName string) func(*resty.Client, *resty.Response) err
 			issue = resp.String()
 		}
 
-		if issue == "" {
-			issue = fmt.Sprintf("Please refer to %s's API reference for more information.", apiName)
-		}
+		return endUserError(apiName, resp.StatusCode(), issue)
+	}
+}
 
-		msg := fmt.Sprintf("%s responded with a %d status code. %s", apiName, resp.StatusCode(), issue)
-		return errmsg.AddMessage(fmt.Errorf("unsuccessful HTTP response"), msg)
+func endUserError(apiName string, status int, issue string) error {
+	if issue == "" {
+		issue = fmt.Sprintf("Please refer to %s's API reference for more information.", apiName)
 	}
+
+	msg := fmt.Sprintf("%s responded with a %d status code. %s", apiName, status, issue)
+	return errmsg.AddMessage(&ResponseError{StatusCode: status}, msg)
 }
 
 // WithEndUserError will unmarshal error response bodies as the error struct
@@ -108,6 +123,7 @@ func New(name, host string, options ...Option) *Client {
 	c := &Client{
 		Client: r,
 		name:   name,
+		logger: zap.NewNop(),
 	}
 
 	for _, o := range options {
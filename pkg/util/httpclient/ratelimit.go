@@ -0,0 +1,159 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/time/rate"
+)
+
+// RateLimit defines the maximum throughput allowed by an API. Zero values
+// mean there is no limit.
+type RateLimit struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+}
+
+// rateLimiterIdleTTL is the time after which an unused rate limiter is
+// evicted. The limits are defined per minute, so the buckets of a limiter
+// that has been idle for longer are full and it's equivalent to a new one.
+const rateLimiterIdleTTL = 10 * time.Minute
+
+// rateLimiter holds a token bucket for the requests and another one for the
+// tokens (e.g. LLM tokens) sent to an API.
+type rateLimiter struct {
+	requests *rate.Limiter
+	tokens   *rate.Limiter
+	// lastUsed is the Unix time, in nanoseconds, the limiter was last
+	// used.
+	lastUsed atomic.Int64
+}
+
+func (rl *rateLimiter) touch() {
+	rl.lastUsed.Store(time.Now().UnixNano())
+}
+
+var (
+	rateLimiters   = map[string]*rateLimiter{}
+	rateLimitersMu sync.Mutex
+	// lastEviction is the last time the idle rate limiters were evicted.
+	lastEviction time.Time
+)
+
+// evictIdleRateLimiters removes the limiters that haven't been used for
+// rateLimiterIdleTTL, so credentials that are no longer used don't hold
+// memory. The map is swept at most once per rateLimiterIdleTTL. It must be
+// called with rateLimitersMu held.
+func evictIdleRateLimiters(now time.Time) {
+	if now.Sub(lastEviction) < rateLimiterIdleTTL {
+		return
+	}
+
+	lastEviction = now
+	for key, rl := range rateLimiters {
+		if now.Sub(time.Unix(0, rl.lastUsed.Load())) >= rateLimiterIdleTTL {
+			delete(rateLimiters, key)
+		}
+	}
+}
+
+func perMinute(n int) (rate.Limit, int) {
+	if n <= 0 {
+		return rate.Inf, 0
+	}
+
+	// The burst allows consuming the quota of a whole minute at once, as
+	// the provider limits are usually defined per minute.
+	return rate.Limit(float64(n) / 60), n
+}
+
+func setLimit(l *rate.Limiter, n int) {
+	limit, burst := perMinute(n)
+	if l.Limit() != limit || l.Burst() != burst {
+		l.SetLimit(limit)
+		l.SetBurst(burst)
+	}
+}
+
+// sharedRateLimiter returns the rate limiter associated to a key, creating
+// it if it doesn't exist or has been evicted. If the limits have changed (e.g. the connector
+// resource has been updated), the limiter is updated.
+func sharedRateLimiter(key string, l RateLimit) *rateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	evictIdleRateLimiters(time.Now())
+
+	rl, ok := rateLimiters[key]
+	if !ok {
+		rl = &rateLimiter{
+			requests: rate.NewLimiter(perMinute(l.RequestsPerMinute)),
+			tokens:   rate.NewLimiter(perMinute(l.TokensPerMinute)),
+		}
+		rl.touch()
+		rateLimiters[key] = rl
+
+		return rl
+	}
+
+	rl.touch()
+
+	setLimit(rl.requests, l.RequestsPerMinute)
+	setLimit(rl.tokens, l.TokensPerMinute)
+
+	return rl
+}
+
+// wait blocks the request until the limiter allows it to be sent. The
+// request will consume its token cost (see SetTokenCost).
+func (rl *rateLimiter) wait(_ *resty.Client, req *resty.Request) error {
+	rl.touch()
+
+	ctx := req.Context()
+	if err := rl.requests.Wait(ctx); err != nil {
+		return err
+	}
+
+	tokens, _ := ctx.Value(tokenCostKey{}).(int)
+	if tokens <= 0 {
+		return nil
+	}
+
+	// A request that exceeds the limit would never be allowed. It will
+	// consume the whole bucket instead.
+	if burst := rl.tokens.Burst(); rl.tokens.Limit() != rate.Inf && tokens > burst {
+		tokens = burst
+	}
+
+	return rl.tokens.WaitN(ctx, tokens)
+}
+
+// WithRateLimit will throttle the requests so they stay under the provided
+// limit. The limit is shared by every client with the same key, so
+// executions that use the same credentials cooperate instead of competing
+// for the API quota. The key is hashed before being stored, so it can
+// contain credentials.
+func WithRateLimit(key string, l RateLimit) Option {
+	return func(c *Client) {
+		if l.RequestsPerMinute <= 0 && l.TokensPerMinute <= 0 {
+			return
+		}
+
+		h := sha256.Sum256([]byte(key))
+		c.OnBeforeRequest(sharedRateLimiter(hex.EncodeToString(h[:]), l).wait)
+	}
+}
+
+type tokenCostKey struct{}
+
+// SetTokenCost sets the number of tokens a request will consume from the
+// tokens-per-minute limit of the client (see WithRateLimit). If the request
+// context is to be set, it must be done before calling this function.
+func SetTokenCost(req *resty.Request, tokens int) *resty.Request {
+	return req.SetContext(context.WithValue(req.Context(), tokenCostKey{}, tokens))
+}
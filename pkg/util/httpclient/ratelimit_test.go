@@ -0,0 +1,122 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"golang.org/x/time/rate"
+)
+
+func TestClient_RateLimit(t *testing.T) {
+	c := qt.New(t)
+
+	const testName = "Pokédex"
+	const path = "/137"
+
+	var hits atomic.Int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"added": 1}`)
+	})
+
+	srv := httptest.NewServer(h)
+	c.Cleanup(srv.Close)
+
+	// The limiter rejects requests that would exceed the context deadline
+	// without waiting.
+	post := func(c *qt.C, client *Client, tokens int) error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		c.Cleanup(cancel)
+
+		req := client.R().SetContext(ctx)
+		if tokens > 0 {
+			req = SetTokenCost(req, tokens)
+		}
+
+		_, err := req.Post(path)
+		return err
+	}
+
+	c.Run("ok - requests per minute", func(c *qt.C) {
+		hits.Store(0)
+		key := c.Name()
+		limit := RateLimit{RequestsPerMinute: 2}
+
+		// Clients with the same key share the limit.
+		c.Check(post(c, New(testName, srv.URL, WithRateLimit(key, limit)), 0), qt.IsNil)
+		c.Check(post(c, New(testName, srv.URL, WithRateLimit(key, limit)), 0), qt.IsNil)
+		c.Check(post(c, New(testName, srv.URL, WithRateLimit(key, limit)), 0), qt.ErrorMatches, ".*exceed context deadline")
+
+		// Other keys aren't affected.
+		c.Check(post(c, New(testName, srv.URL, WithRateLimit(key+"-other", limit)), 0), qt.IsNil)
+
+		// No limit.
+		c.Check(post(c, New(testName, srv.URL, WithRateLimit(key, RateLimit{})), 0), qt.IsNil)
+
+		c.Check(hits.Load(), qt.Equals, int32(4))
+	})
+
+	c.Run("ok - tokens per minute", func(c *qt.C) {
+		hits.Store(0)
+		client := New(testName, srv.URL, WithRateLimit(c.Name(), RateLimit{TokensPerMinute: 100}))
+
+		c.Check(post(c, client, 60), qt.IsNil)
+		c.Check(post(c, client, 0), qt.IsNil)
+		c.Check(post(c, client, 60), qt.ErrorMatches, ".*exceed context deadline")
+
+		c.Check(hits.Load(), qt.Equals, int32(2))
+	})
+
+	c.Run("ok - request cost exceeds limit", func(c *qt.C) {
+		client := New(testName, srv.URL, WithRateLimit(c.Name(), RateLimit{TokensPerMinute: 100}))
+		c.Check(post(c, client, 150), qt.IsNil)
+	})
+}
+
+func TestSharedRateLimiter(t *testing.T) {
+	c := qt.New(t)
+
+	rl := sharedRateLimiter(c.Name(), RateLimit{RequestsPerMinute: 60})
+	c.Check(rl.requests.Limit(), qt.Equals, rate.Limit(1))
+	c.Check(rl.requests.Burst(), qt.Equals, 60)
+	c.Check(rl.tokens.Limit(), qt.Equals, rate.Inf)
+
+	// Limits are updated when the configuration changes.
+	got := sharedRateLimiter(c.Name(), RateLimit{RequestsPerMinute: 120, TokensPerMinute: 600})
+	c.Check(got, qt.Equals, rl)
+	c.Check(rl.requests.Limit(), qt.Equals, rate.Limit(2))
+	c.Check(rl.requests.Burst(), qt.Equals, 120)
+	c.Check(rl.tokens.Limit(), qt.Equals, rate.Limit(10))
+	c.Check(rl.tokens.Burst(), qt.Equals, 600)
+}
+
+func TestSharedRateLimiter_Eviction(t *testing.T) {
+	c := qt.New(t)
+
+	idle := sharedRateLimiter(c.Name()+"-idle", RateLimit{RequestsPerMinute: 60})
+	idle.lastUsed.Store(time.Now().Add(-rateLimiterIdleTTL).UnixNano())
+	used := sharedRateLimiter(c.Name()+"-used", RateLimit{RequestsPerMinute: 60})
+
+	rateLimitersMu.Lock()
+	lastEviction = time.Time{}
+	rateLimitersMu.Unlock()
+
+	// Idle limiters are evicted when a limiter is requested.
+	got := sharedRateLimiter(c.Name()+"-used", RateLimit{RequestsPerMinute: 60})
+	c.Check(got, qt.Equals, used)
+
+	rateLimitersMu.Lock()
+	_, ok := rateLimiters[c.Name()+"-idle"]
+	rateLimitersMu.Unlock()
+	c.Check(ok, qt.IsFalse)
+
+	// Evicted limiters are created again.
+	c.Check(sharedRateLimiter(c.Name()+"-idle", RateLimit{RequestsPerMinute: 60}), qt.Not(qt.Equals), idle)
+}
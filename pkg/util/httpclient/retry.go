@@ -0,0 +1,241 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+)
+
+// RetryPolicy defines how a client retries failed requests.
+type RetryPolicy struct {
+	// MaxAttempts caps the number of times a request is sent, including the
+	// first attempt.
+	MaxAttempts int
+	// MinWait and MaxWait bound the time to wait between attempts. When the
+	// server doesn't specify a wait time, the client will use a jittered
+	// exponential backoff within these limits.
+	MinWait time.Duration
+	MaxWait time.Duration
+	// MaxElapsedTime caps the time spent retrying a request. No new attempt
+	// will be made after this time has passed since the first attempt.
+	MaxElapsedTime time.Duration
+	// Skip, if set, excludes from the retries the failed responses for which
+	// it returns true. Connectors use it for the transient failures they
+	// handle themselves.
+	Skip func(*resty.Response) bool
+}
+
+// DefaultRetryPolicy is the retry policy used by the connectors.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	MinWait:        500 * time.Millisecond,
+	MaxWait:        30 * time.Second,
+	MaxElapsedTime: reqTimeout,
+}
+
+type retryStartKey struct{}
+
+// WithRetry will retry the requests that fail due to a transient error:
+// rate limits (429), unavailable upstream services (502, 503, 504) and
+// connection resets. Wait times specified by the server through the
+// Retry-After or the X-Ratelimit-Reset-* headers are honoured.
+//
+// Only idempotent requests (see SetIdempotent) are retried on any transient
+// failure. Other requests might have been processed by the server, so they
+// are only retried when the server rejects them with a 429 status or asks
+// the client to retry them through the Retry-After header.
+//
+// If the client has a logger (see WithLogger), each retry will be logged.
+func WithRetry(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.SetRetryCount(p.MaxAttempts - 1).
+			SetRetryWaitTime(p.MinWait).
+			SetRetryMaxWaitTime(p.MaxWait).
+			SetRetryResetReaders(true).
+			OnBeforeRequest(setRetryStart).
+			AddRetryCondition(p.shouldRetry).
+			SetRetryAfter(retryAfter).
+			AddRetryHook(func(resp *resty.Response, err error) {
+				// Resty calls the hooks when the last attempt fails, too.
+				if resp.Request.Attempt < p.MaxAttempts {
+					c.logRetry(resp, err)
+				}
+			})
+	}
+}
+
+// setRetryStart records the time of the first attempt of a request, which is
+// used to cap the time spent retrying.
+func setRetryStart(_ *resty.Client, req *resty.Request) error {
+	if _, ok := req.Context().Value(retryStartKey{}).(time.Time); !ok {
+		req.SetContext(context.WithValue(req.Context(), retryStartKey{}, time.Now()))
+	}
+
+	return nil
+}
+
+func (p RetryPolicy) shouldRetry(resp *resty.Response, err error) bool {
+	// Errors in the request middleware don't produce a response and
+	// shouldn't be retried.
+	if resp == nil || resp.Request.Context().Err() != nil {
+		return false
+	}
+
+	if !isTransientFailure(resp, err) {
+		return false
+	}
+
+	if p.Skip != nil && p.Skip(resp) {
+		return false
+	}
+
+	wait, found := serverWaitTime(resp)
+	if !isIdempotent(resp.Request) && resp.StatusCode() != http.StatusTooManyRequests && !found {
+		return false
+	}
+
+	if wait > p.MaxWait {
+		return false
+	}
+
+	if start, ok := resp.Request.Context().Value(retryStartKey{}).(time.Time); ok && p.MaxElapsedTime > 0 {
+		if time.Since(start)+max(wait, p.MinWait) > p.MaxElapsedTime {
+			return false
+		}
+	}
+
+	return true
+}
+
+type idempotentKey struct{}
+
+// SetIdempotent marks a request as idempotent, so it's retried on any
+// transient failure (see WithRetry). Requests with an idempotent method
+// (GET, HEAD, OPTIONS, TRACE, PUT, DELETE) or with an Idempotency-Key header
+// don't need to be marked. If the request context is to be set, it must be
+// done before calling this function.
+func SetIdempotent(req *resty.Request) *resty.Request {
+	return req.SetContext(context.WithValue(req.Context(), idempotentKey{}, true))
+}
+
+func isIdempotent(req *resty.Request) bool {
+	if marked, _ := req.Context().Value(idempotentKey{}).(bool); marked {
+		return true
+	}
+
+	switch req.Method {
+	case http.MethodGet,
+		http.MethodHead,
+		http.MethodOptions,
+		http.MethodTrace,
+		http.MethodPut,
+		http.MethodDelete:
+		return true
+	}
+
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+func isTransientFailure(resp *resty.Response, err error) bool {
+	switch resp.StatusCode() {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	if resp.RawResponse != nil || err == nil {
+		return false
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// retryAfter returns the wait time requested by the server. A zero value
+// will make the client fall back to exponential backoff.
+func retryAfter(_ *resty.Client, resp *resty.Response) (time.Duration, error) {
+	// Responses that aren't parsed (e.g. streams) must be closed before
+	// retrying, as the caller will only get the last one.
+	if body := resp.RawBody(); body != nil {
+		body.Close()
+	}
+
+	wait, _ := serverWaitTime(resp)
+	return wait, nil
+}
+
+// serverWaitTime extracts the time the server requests to wait before
+// retrying. The Retry-After header is checked first. On rate limit errors,
+// the longest of the X-Ratelimit-Reset-* headers is used as a fallback.
+func serverWaitTime(resp *resty.Response) (time.Duration, bool) {
+	if wait, ok := parseWaitTime(resp.Header().Get("Retry-After")); ok {
+		return wait, true
+	}
+
+	if resp.StatusCode() != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	var wait time.Duration
+	var found bool
+	for k, v := range resp.Header() {
+		if !strings.HasPrefix(strings.ToLower(k), "x-ratelimit-reset") || len(v) == 0 {
+			continue
+		}
+
+		if w, ok := parseWaitTime(v[0]); ok {
+			wait, found = max(wait, w), true
+		}
+	}
+
+	return wait, found
+}
+
+// parseWaitTime parses the value of a header that indicates when a request
+// can be retried. Values can be expressed in seconds, as a duration (e.g.
+// 6m0s, as returned by OpenAI), as a Unix timestamp or as an HTTP date.
+func parseWaitTime(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	// Values above this threshold are considered Unix timestamps.
+	const minTimestamp = 1e9
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		if secs > minTimestamp {
+			return max(time.Until(time.Unix(int64(secs), 0)), 0), true
+		}
+
+		return max(time.Duration(secs*float64(time.Second)), 0), true
+	}
+
+	if d, err := time.ParseDuration(v); err == nil {
+		return max(d, 0), true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+
+	return 0, false
+}
+
+func (c *Client) logRetry(resp *resty.Response, err error) {
+	logger := c.logger.With(zap.Int("attempt", resp.Request.Attempt))
+	if resp.RawResponse != nil {
+		logger = logger.With(zap.Int("status", resp.StatusCode()))
+	}
+
+	logger.Warn("Retrying HTTP request", zap.String("url", resp.Request.URL), zap.Error(err))
+}
@@ -0,0 +1,249 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/instill-ai/x/errmsg"
+)
+
+// closeConn is used in the test server to close the connection without
+// responding.
+const closeConn = 0
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	MinWait:        time.Millisecond,
+	MaxWait:        50 * time.Millisecond,
+	MaxElapsedTime: time.Second,
+}
+
+func TestClient_Retry(t *testing.T) {
+	c := qt.New(t)
+
+	const testName = "Pokédex"
+	const path = "/137"
+
+	testcases := []struct {
+		name         string
+		statuses     []int
+		header       http.Header
+		method       string
+		idempotent   bool
+		policy       RetryPolicy
+		wantAttempts int
+		wantIssue    string
+		wantErr      string
+	}{
+		{
+			name:         "ok - retry on rate limit",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			header:       http.Header{"Retry-After": []string{"0"}},
+			wantAttempts: 2,
+		},
+		{
+			name:         "ok - retry on unavailable service",
+			statuses:     []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK},
+			idempotent:   true,
+			wantAttempts: 3,
+		},
+		{
+			name:         "ok - retry on connection reset",
+			statuses:     []int{closeConn, http.StatusOK},
+			idempotent:   true,
+			wantAttempts: 2,
+		},
+		{
+			name:         "ok - retry idempotent method",
+			statuses:     []int{http.StatusServiceUnavailable, closeConn, http.StatusOK},
+			method:       http.MethodGet,
+			wantAttempts: 3,
+		},
+		{
+			name:         "ok - retry non-idempotent request with Retry-After",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			header:       http.Header{"Retry-After": []string{"0"}},
+			wantAttempts: 2,
+		},
+		{
+			name:         "nok - no retry of non-idempotent request on unavailable service",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantAttempts: 1,
+			wantIssue:    fmt.Sprintf("%s responded with a 503 status code. Try again.", testName),
+		},
+		{
+			name:         "nok - no retry of non-idempotent request on connection reset",
+			statuses:     []int{closeConn, http.StatusOK},
+			wantAttempts: 1,
+			wantErr:      `Post "[^"]+": EOF`,
+		},
+		{
+			name:         "ok - rate limit reset header",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			header:       http.Header{"X-Ratelimit-Reset-Requests": []string{"20ms"}},
+			wantAttempts: 2,
+		},
+		{
+			name:         "nok - no retry on client error",
+			statuses:     []int{http.StatusBadRequest, http.StatusOK},
+			wantAttempts: 1,
+			wantIssue:    fmt.Sprintf("%s responded with a 400 status code. Try again.", testName),
+		},
+		{
+			name:         "nok - too many attempts",
+			statuses:     []int{http.StatusGatewayTimeout, http.StatusGatewayTimeout, http.StatusGatewayTimeout, http.StatusOK},
+			idempotent:   true,
+			wantAttempts: 3,
+			wantIssue:    fmt.Sprintf("%s responded with a 504 status code. Try again.", testName),
+		},
+		{
+			name:         "nok - server wait time exceeds max",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			header:       http.Header{"Retry-After": []string{"60"}},
+			wantAttempts: 1,
+			wantIssue:    fmt.Sprintf("%s responded with a 429 status code. Try again.", testName),
+		},
+		{
+			name:       "nok - skipped failure",
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusOK},
+			idempotent: true,
+			policy: RetryPolicy{
+				MaxAttempts: 3,
+				MinWait:     time.Millisecond,
+				MaxWait:     50 * time.Millisecond,
+				Skip: func(resp *resty.Response) bool {
+					return resp.StatusCode() == http.StatusServiceUnavailable
+				},
+			},
+			wantAttempts: 1,
+			wantIssue:    fmt.Sprintf("%s responded with a 503 status code. Try again.", testName),
+		},
+		{
+			name:     "nok - max elapsed time",
+			statuses: []int{http.StatusTooManyRequests, http.StatusOK},
+			header:   http.Header{"Retry-After": []string{"0.04"}},
+			policy: RetryPolicy{
+				MaxAttempts:    3,
+				MinWait:        time.Millisecond,
+				MaxWait:        50 * time.Millisecond,
+				MaxElapsedTime: 30 * time.Millisecond,
+			},
+			wantAttempts: 1,
+			wantIssue:    fmt.Sprintf("%s responded with a 429 status code. Try again.", testName),
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			var attempts atomic.Int32
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := attempts.Add(1) - 1
+				if tc.statuses[i] == closeConn {
+					conn, _, err := w.(http.Hijacker).Hijack()
+					c.Assert(err, qt.IsNil)
+					conn.Close()
+					return
+				}
+
+				for k, v := range tc.header {
+					w.Header()[k] = v
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.statuses[i])
+				if tc.statuses[i] != http.StatusOK {
+					fmt.Fprintln(w, `{ "message": "Try again." }`)
+					return
+				}
+
+				fmt.Fprintln(w, `{"added": 1}`)
+			})
+
+			srv := httptest.NewServer(h)
+			c.Cleanup(srv.Close)
+
+			policy := tc.policy
+			if policy.MaxAttempts == 0 {
+				policy = testRetryPolicy
+			}
+
+			zCore, zLogs := observer.New(zap.InfoLevel)
+			client := New(testName, srv.URL,
+				WithLogger(zap.New(zCore)),
+				WithEndUserError(errBody{}),
+				WithRetry(policy),
+			)
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodPost
+			}
+
+			var got okBody
+			req := client.R().SetResult(&got)
+			if tc.idempotent {
+				req = SetIdempotent(req)
+			}
+
+			_, err := req.Execute(method, path)
+			c.Check(attempts.Load(), qt.Equals, int32(tc.wantAttempts))
+
+			// Each retry is logged.
+			retries := zLogs.FilterMessage("Retrying HTTP request")
+			c.Check(retries.Len(), qt.Equals, tc.wantAttempts-1)
+			for _, l := range retries.All() {
+				c.Check(l.ContextMap()["name"], qt.Equals, testName)
+			}
+
+			if tc.wantErr != "" {
+				c.Check(err, qt.ErrorMatches, tc.wantErr)
+				return
+			}
+
+			if tc.wantIssue != "" {
+				c.Check(err, qt.IsNotNil)
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantIssue)
+				return
+			}
+
+			c.Check(err, qt.IsNil)
+			c.Check(got.Added, qt.Equals, 1)
+		})
+	}
+}
+
+func TestParseWaitTime(t *testing.T) {
+	c := qt.New(t)
+
+	testcases := []struct {
+		in     string
+		want   time.Duration
+		wantOK bool
+	}{
+		{in: "", wantOK: false},
+		{in: "foo", wantOK: false},
+		{in: "2", want: 2 * time.Second, wantOK: true},
+		{in: "0.5", want: 500 * time.Millisecond, wantOK: true},
+		{in: "6m0s", want: 6 * time.Minute, wantOK: true},
+		{in: "20ms", want: 20 * time.Millisecond, wantOK: true},
+		{in: "1704067200", want: 0, wantOK: true},
+		{in: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0, wantOK: true},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.in, func(c *qt.C) {
+			got, ok := parseWaitTime(tc.in)
+			c.Check(ok, qt.Equals, tc.wantOK)
+			c.Check(got, qt.Equals, tc.want)
+		})
+	}
+}
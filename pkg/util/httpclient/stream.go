@@ -0,0 +1,69 @@
+package httpclient
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	// maxEventSize is the maximum size of a single server-sent event line.
+	maxEventSize = 1024 * 1024
+	// eventStreamDone is the payload of the event that closes the streams of
+	// OpenAI-compatible APIs.
+	eventStreamDone = "[DONE]"
+)
+
+// ScanEvents reads the server-sent events of a streamed response and calls
+// onData with the data of each event. It stops at the end of the stream, at
+// the [DONE] event or when onData returns an error.
+func ScanEvents(r io.Reader, onData func(data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxEventSize)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		data = strings.TrimSpace(data)
+		if data == eventStreamDone {
+			return nil
+		}
+
+		if err := onData(data); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// RawResponseError returns the end-user error of a response with an error
+// status whose body wasn't parsed, e.g. a stream. Response middlewares aren't
+// applied to these responses, so the body is read here and decoded as the
+// error struct of the client.
+func (c *Client) RawResponseError(resp *resty.Response) error {
+	b, err := io.ReadAll(resp.RawBody())
+	if err != nil {
+		return err
+	}
+
+	var issue string
+	if c.Error != nil {
+		errResp := reflect.New(c.Error).Interface()
+		if v, ok := errResp.(ErrBody); ok && json.Unmarshal(b, errResp) == nil {
+			issue = v.Message()
+		}
+	}
+
+	if issue == "" {
+		issue = strings.TrimSpace(string(b))
+	}
+
+	return endUserError(c.name, resp.StatusCode(), issue)
+}
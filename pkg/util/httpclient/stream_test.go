@@ -0,0 +1,90 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/instill-ai/x/errmsg"
+)
+
+func TestScanEvents(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("ok - stops at the done event", func(c *qt.C) {
+		stream := ": keep-alive\n\ndata: {\"n\": 1}\n\ndata:{\"n\": 2}\n\ndata: [DONE]\n\ndata: {\"n\": 3}\n\n"
+
+		var got []string
+		err := ScanEvents(strings.NewReader(stream), func(data string) error {
+			got = append(got, data)
+			return nil
+		})
+		c.Check(err, qt.IsNil)
+		c.Check(got, qt.DeepEquals, []string{`{"n": 1}`, `{"n": 2}`})
+	})
+
+	c.Run("nok - callback error", func(c *qt.C) {
+		err := ScanEvents(strings.NewReader("data: 1\n\ndata: 2\n\n"), func(data string) error {
+			return fmt.Errorf("bad event %s", data)
+		})
+		c.Check(err, qt.ErrorMatches, "bad event 1")
+	})
+
+	c.Run("nok - event too large", func(c *qt.C) {
+		stream := "data: " + strings.Repeat("a", maxEventSize) + "\n\n"
+		err := ScanEvents(strings.NewReader(stream), func(string) error { return nil })
+		c.Check(err, qt.ErrorMatches, ".*token too long")
+	})
+}
+
+func TestClient_RawResponseError(t *testing.T) {
+	c := qt.New(t)
+
+	const testName = "Pokédex"
+
+	testcases := []struct {
+		name      string
+		gotBody   string
+		wantIssue string
+	}{
+		{
+			name:      "error body",
+			gotBody:   `{ "message": "Incorrect API key provided." }`,
+			wantIssue: testName + " responded with a 401 status code. Incorrect API key provided.",
+		},
+		{
+			name:      "text body",
+			gotBody:   "Unauthorized\n",
+			wantIssue: testName + " responded with a 401 status code. Unauthorized",
+		},
+		{
+			name:      "empty body",
+			wantIssue: testName + " responded with a 401 status code. Please refer to " + testName + "'s API reference for more information.",
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, tc.gotBody)
+			})
+
+			srv := httptest.NewServer(h)
+			c.Cleanup(srv.Close)
+
+			client := New(testName, srv.URL, WithEndUserError(errBody{}))
+			resp, err := client.R().SetDoNotParseResponse(true).Get("/stream")
+			c.Assert(err, qt.IsNil)
+			defer resp.RawBody().Close()
+
+			err = client.RawResponseError(resp)
+			c.Check(err, qt.ErrorMatches, "unsuccessful HTTP response")
+			c.Check(errmsg.Message(err), qt.Equals, tc.wantIssue)
+		})
+	}
+}
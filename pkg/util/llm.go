@@ -0,0 +1,138 @@
+package util
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/instill-ai/x/errmsg"
+)
+
+const (
+	// FinishReasonStop means the model reached a natural stop point or a
+	// provided stop sequence.
+	FinishReasonStop = "stop"
+	// FinishReasonLength means the generation reached the maximum number of
+	// tokens.
+	FinishReasonLength = "length"
+
+	// charsPerToken is the rule-of-thumb ratio used to estimate the number
+	// of tokens in a text.
+	charsPerToken = 4
+)
+
+// LLMUsage contains the number of tokens consumed by a text generation.
+type LLMUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// NewLLMUsage returns the usage of a text generation from its prompt and
+// completion token counts.
+func NewLLMUsage(promptTokens, completionTokens int) LLMUsage {
+	return LLMUsage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+	}
+}
+
+// EstimateTokens approximates the number of tokens in a set of texts. It is
+// meant to be used when the provider doesn't report the token usage and it
+// follows the rule of thumb of 4 characters per token.
+func EstimateTokens(texts ...string) int {
+	var tokens int
+	for _, t := range texts {
+		chars := utf8.RuneCountInString(t)
+		tokens += (chars + charsPerToken - 1) / charsPerToken
+	}
+
+	return tokens
+}
+
+// EstimateFinishReason infers why a generation stopped when the provider
+// doesn't report it. A zero maxTokens value means there was no limit in the
+// request.
+func EstimateFinishReason(completionTokens, maxTokens int) string {
+	if maxTokens > 0 && completionTokens >= maxTokens {
+		return FinishReasonLength
+	}
+
+	return FinishReasonStop
+}
+
+const (
+	// HistoryTrimmingSummarize is the history trimming option that replaces
+	// the dropped chat history messages with a summary.
+	HistoryTrimmingSummarize = "summarize"
+
+	// SummaryMaxTokens is the size of the summary of the dropped messages.
+	SummaryMaxTokens = 256
+	// SummaryPrompt is the instruction to summarize the dropped messages.
+	SummaryPrompt = "Summarize the following conversation in a few sentences, keeping the facts needed to continue it."
+	// SummaryPrefix introduces the summary in the context sent to the model.
+	SummaryPrefix = "Summary of the earlier conversation: "
+)
+
+// ContextMessage is a chat history message, as seen by the context window
+// trimming.
+type ContextMessage struct {
+	// Tokens is the number of tokens the message takes in the context.
+	Tokens int
+	// Pinned messages, e.g. system messages, are never dropped.
+	Pinned bool
+	// CanStart is true if the history can start at the message. E.g., a
+	// tool response can't be sent without the call that precedes it.
+	CanStart bool
+}
+
+// TrimHistory selects the oldest chat history messages that must be dropped
+// for the history to fit in a context window of maxTokens, along with the
+// fixedTokens that are always sent (e.g. the prompt or the tokens reserved
+// for the completion). It returns the indices of the dropped messages, in
+// order.
+func TrimHistory(history []ContextMessage, fixedTokens, maxTokens int) ([]int, error) {
+	total, pinned := fixedTokens, fixedTokens
+	for _, m := range history {
+		total += m.Tokens
+		if m.Pinned {
+			pinned += m.Tokens
+		}
+	}
+
+	if pinned > maxTokens {
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("context of %d tokens exceeds limit of %d", pinned, maxTokens),
+			fmt.Sprintf("The prompt, the system messages and the tokens reserved for the completion take %d tokens, which exceeds the maximum context of %d tokens.", pinned, maxTokens),
+		)
+	}
+
+	var dropped []int
+	for i, m := range history {
+		if m.Pinned {
+			continue
+		}
+
+		// Once the history fits, it is only trimmed further until it can
+		// start at the first remaining message.
+		if total <= maxTokens && m.CanStart {
+			break
+		}
+
+		total -= m.Tokens
+		dropped = append(dropped, i)
+	}
+
+	return dropped, nil
+}
+
+// EmbeddingTexts returns the texts of an embedding task, whose input has a
+// single text and a batch of texts. The single text is embedded when no batch
+// is provided, so an empty input still produces an embedding.
+func EmbeddingTexts(text string, batch []string) []string {
+	if text != "" || len(batch) == 0 {
+		return append([]string{text}, batch...)
+	}
+
+	return batch
+}
@@ -0,0 +1,110 @@
+package util
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/instill-ai/x/errmsg"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	c := qt.New(t)
+
+	testcases := []struct {
+		name string
+		in   []string
+		want int
+	}{
+		{name: "ok - no texts", want: 0},
+		{name: "ok - empty text", in: []string{""}, want: 0},
+		{name: "ok - rounds up", in: []string{"hola"}, want: 1},
+		{name: "ok - partial token", in: []string{"hola!"}, want: 2},
+		{name: "ok - counts runes", in: []string{"ñandú"}, want: 2},
+		{name: "ok - several texts", in: []string{"hola", "mundo"}, want: 3},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			c.Check(EstimateTokens(tc.in...), qt.Equals, tc.want)
+		})
+	}
+}
+
+func TestEstimateFinishReason(t *testing.T) {
+	c := qt.New(t)
+
+	c.Check(EstimateFinishReason(10, 0), qt.Equals, FinishReasonStop)
+	c.Check(EstimateFinishReason(10, 50), qt.Equals, FinishReasonStop)
+	c.Check(EstimateFinishReason(50, 50), qt.Equals, FinishReasonLength)
+}
+
+func TestNewLLMUsage(t *testing.T) {
+	c := qt.New(t)
+
+	got := NewLLMUsage(3, 4)
+	c.Check(got, qt.Equals, LLMUsage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7})
+}
+
+func TestTrimHistory(t *testing.T) {
+	c := qt.New(t)
+
+	system := ContextMessage{Tokens: 10, Pinned: true, CanStart: true}
+	user := ContextMessage{Tokens: 20, CanStart: true}
+	call := ContextMessage{Tokens: 5, CanStart: true}
+	tool := ContextMessage{Tokens: 30}
+
+	testcases := []struct {
+		name      string
+		history   []ContextMessage
+		maxTokens int
+		want      []int
+		wantErr   string
+	}{
+		{
+			name:      "ok - fits",
+			history:   []ContextMessage{system, user, user},
+			maxTokens: 100,
+		},
+		{
+			name:      "ok - drops oldest and keeps system messages",
+			history:   []ContextMessage{system, user, user, user},
+			maxTokens: 70,
+			want:      []int{1, 2},
+		},
+		{
+			name:      "ok - doesn't start with a tool response",
+			history:   []ContextMessage{system, user, call, tool, user},
+			maxTokens: 80,
+			want:      []int{1, 2, 3},
+		},
+		{
+			name:      "nok - pinned messages exceed the context",
+			history:   []ContextMessage{system, user},
+			maxTokens: 30,
+			wantErr:   "The prompt, the system messages and the tokens reserved for the completion take 35 tokens, which exceeds the maximum context of 30 tokens.",
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			got, err := TrimHistory(tc.history, 25, tc.maxTokens)
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				return
+			}
+
+			c.Check(err, qt.IsNil)
+			c.Check(got, qt.DeepEquals, tc.want)
+		})
+	}
+}
+
+func TestEmbeddingTexts(t *testing.T) {
+	c := qt.New(t)
+
+	c.Check(EmbeddingTexts("", nil), qt.DeepEquals, []string{""})
+	c.Check(EmbeddingTexts("hola", nil), qt.DeepEquals, []string{"hola"})
+	c.Check(EmbeddingTexts("", []string{"a", "b"}), qt.DeepEquals, []string{"a", "b"})
+	c.Check(EmbeddingTexts("hola", []string{"a", "b"}), qt.DeepEquals, []string{"hola", "a", "b"})
+}
@@ -0,0 +1,177 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"github.com/instill-ai/x/errmsg"
+)
+
+const schemaURL = "structured-output.json"
+
+// JSONSchema validates the texts generated by an LLM against the JSON schema
+// of a structured output.
+type JSONSchema struct {
+	raw      map[string]any
+	compiled *jsonschema.Schema
+}
+
+// CompileJSONSchema compiles the JSON schema of a structured output. The
+// schema must describe an object, as the parsed output is a JSON object.
+func CompileJSONSchema(schema map[string]any) (*JSONSchema, error) {
+	if t, ok := schema["type"]; !ok || t != "object" {
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("structured output schema with type %v", t),
+			`The JSON schema of the structured output must have the "object" type.`,
+		)
+	}
+
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(schemaURL, strings.NewReader(string(b))); err != nil {
+		return nil, errmsg.AddMessage(err, "The JSON schema of the structured output is invalid.")
+	}
+
+	compiled, err := compiler.Compile(schemaURL)
+	if err != nil {
+		return nil, errmsg.AddMessage(err, "The JSON schema of the structured output is invalid.")
+	}
+
+	return &JSONSchema{raw: schema, compiled: compiled}, nil
+}
+
+// Raw returns the JSON schema as it was provided.
+func (s *JSONSchema) Raw() map[string]any {
+	return s.raw
+}
+
+// Instructions returns the text that asks a model to follow the schema. It is
+// meant for providers that can't enforce the schema themselves.
+func (s *JSONSchema) Instructions() string {
+	b, _ := json.Marshal(s.raw)
+	return fmt.Sprintf("Respond only with a JSON object that follows this JSON schema, without any other text: %s", b)
+}
+
+// Feedback returns the text that asks a model to fix a response that didn't
+// follow the schema.
+func (s *JSONSchema) Feedback(err error) string {
+	return fmt.Sprintf("%s %s", errmsg.MessageOrErr(err), s.Instructions())
+}
+
+// Parse extracts the JSON object in a generated text and validates it against
+// the schema. Models often wrap the object in a Markdown code block or in
+// some explanatory text, which is discarded.
+func (s *JSONSchema) Parse(text string) (map[string]any, error) {
+	raw := extractJSONObject(text)
+
+	var data any
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("parsing structured output: %w", err),
+			"The response is not a JSON object.",
+		)
+	}
+
+	if err := s.compiled.Validate(data); err != nil {
+		return nil, errmsg.AddMessage(
+			fmt.Errorf("validating structured output: %w", err),
+			fmt.Sprintf("The response doesn't follow the JSON schema (%s).", validationReasons(err)),
+		)
+	}
+
+	obj, ok := data.(map[string]any)
+	if !ok {
+		return nil, errmsg.AddMessage(fmt.Errorf("structured output isn't an object"), "The response is not a JSON object.")
+	}
+
+	return obj, nil
+}
+
+func extractJSONObject(text string) string {
+	text = strings.TrimSpace(text)
+	if start := strings.Index(text, "```"); start >= 0 {
+		block := text[start+3:]
+		if end := strings.Index(block, "```"); end >= 0 {
+			block = block[:end]
+		}
+
+		// Skip the info string of the code block, e.g. "json".
+		if nl := strings.IndexByte(block, '\n'); nl >= 0 && !strings.ContainsAny(block[:nl], "{[") {
+			block = block[nl+1:]
+		}
+
+		text = strings.TrimSpace(block)
+	}
+
+	start, end := strings.IndexByte(text, '{'), strings.LastIndexByte(text, '}')
+	if start < 0 || end < start {
+		return text
+	}
+
+	return text[start : end+1]
+}
+
+func validationReasons(err error) string {
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return err.Error()
+	}
+
+	var reasons []string
+	for _, e := range ve.BasicOutput().Errors {
+		// Intermediate errors only point at the failing subschemas.
+		if e.Error == "" || strings.HasPrefix(e.Error, "doesn't validate with") {
+			continue
+		}
+
+		loc := e.InstanceLocation
+		if loc == "" {
+			loc = "/"
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %s", loc, e.Error))
+	}
+
+	if len(reasons) == 0 {
+		return ve.Message
+	}
+
+	return strings.Join(reasons, "; ")
+}
+
+// GenerateStructured calls generate until it returns a text that follows the
+// schema. When the text is invalid, generate is called again with the
+// feedback to send to the model, up to maxRetries times. The first call
+// receives an empty feedback. The last generated text is returned along with
+// its parsed data.
+func GenerateStructured(s *JSONSchema, maxRetries int, generate func(feedback string) (string, error)) (map[string]any, string, error) {
+	var feedback string
+	for attempt := 0; ; attempt++ {
+		text, err := generate(feedback)
+		if err != nil {
+			return nil, "", err
+		}
+
+		data, err := s.Parse(text)
+		if err == nil {
+			return data, text, nil
+		}
+
+		if attempt >= maxRetries {
+			msg := "The model didn't generate a valid structured output."
+			if attempt > 0 {
+				msg = fmt.Sprintf("The model didn't generate a valid structured output after %d attempts.", attempt+1)
+			}
+
+			return nil, text, errmsg.AddMessage(fmt.Errorf("structured output after %d attempts: %w", attempt+1, err), msg)
+		}
+
+		feedback = s.Feedback(err)
+	}
+}
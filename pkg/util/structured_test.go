@@ -0,0 +1,131 @@
+package util
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/instill-ai/x/errmsg"
+)
+
+var personSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"name": map[string]any{"type": "string"},
+		"age":  map[string]any{"type": "integer", "minimum": 0},
+	},
+	"required": []any{"name"},
+}
+
+func TestCompileJSONSchema(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("ok", func(c *qt.C) {
+		s, err := CompileJSONSchema(personSchema)
+		c.Check(err, qt.IsNil)
+		c.Check(s.Instructions(), qt.Contains, `"required":["name"]`)
+	})
+
+	c.Run("nok - not an object", func(c *qt.C) {
+		_, err := CompileJSONSchema(map[string]any{"type": "array"})
+		c.Check(errmsg.Message(err), qt.Equals, `The JSON schema of the structured output must have the "object" type.`)
+	})
+
+	c.Run("nok - invalid schema", func(c *qt.C) {
+		_, err := CompileJSONSchema(map[string]any{"type": "object", "required": "name"})
+		c.Check(errmsg.Message(err), qt.Equals, "The JSON schema of the structured output is invalid.")
+	})
+}
+
+func TestJSONSchema_Parse(t *testing.T) {
+	c := qt.New(t)
+
+	s, err := CompileJSONSchema(personSchema)
+	c.Assert(err, qt.IsNil)
+
+	testcases := []struct {
+		name    string
+		in      string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "ok - plain object",
+			in:   `{"name": "Ada", "age": 36}`,
+			want: map[string]any{"name": "Ada", "age": float64(36)},
+		},
+		{
+			name: "ok - code block",
+			in:   "Sure!\n```json\n{\"name\": \"Ada\"}\n```",
+			want: map[string]any{"name": "Ada"},
+		},
+		{
+			name: "ok - surrounding text",
+			in:   `Here it is: {"name": "Ada"}. Anything else?`,
+			want: map[string]any{"name": "Ada"},
+		},
+		{
+			name:    "nok - not JSON",
+			in:      "Ada, 36",
+			wantErr: "The response is not a JSON object.",
+		},
+		{
+			name:    "nok - missing property",
+			in:      `{"age": 36}`,
+			wantErr: "The response doesn't follow the JSON schema (/: missing properties: 'name').",
+		},
+		{
+			name:    "nok - wrong type",
+			in:      `{"name": "Ada", "age": -1}`,
+			wantErr: "The response doesn't follow the JSON schema (/age: must be >= 0 but found -1).",
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			got, err := s.Parse(tc.in)
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				return
+			}
+
+			c.Check(err, qt.IsNil)
+			c.Check(got, qt.DeepEquals, tc.want)
+		})
+	}
+}
+
+func TestGenerateStructured(t *testing.T) {
+	c := qt.New(t)
+
+	s, err := CompileJSONSchema(personSchema)
+	c.Assert(err, qt.IsNil)
+
+	c.Run("ok - after retry", func(c *qt.C) {
+		responses := []string{`{"age": 36}`, `{"name": "Ada"}`}
+		var feedbacks []string
+		data, text, err := GenerateStructured(s, 1, func(feedback string) (string, error) {
+			feedbacks = append(feedbacks, feedback)
+			return responses[len(feedbacks)-1], nil
+		})
+
+		c.Check(err, qt.IsNil)
+		c.Check(data, qt.DeepEquals, map[string]any{"name": "Ada"})
+		c.Check(text, qt.Equals, `{"name": "Ada"}`)
+		c.Check(feedbacks, qt.HasLen, 2)
+		c.Check(feedbacks[0], qt.Equals, "")
+		c.Check(feedbacks[1], qt.Matches, `The response doesn't follow the JSON schema \(/: missing properties: 'name'\)\. Respond only with .*`)
+	})
+
+	c.Run("nok - retries exhausted", func(c *qt.C) {
+		var calls int
+		_, text, err := GenerateStructured(s, 2, func(string) (string, error) {
+			calls++
+			return "nope", nil
+		})
+
+		c.Check(calls, qt.Equals, 3)
+		c.Check(text, qt.Equals, "nope")
+		c.Check(errmsg.Message(err), qt.Equals, "The model didn't generate a valid structured output after 3 attempts. The response is not a JSON object.")
+	})
+}
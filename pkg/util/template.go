@@ -0,0 +1,81 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/instill-ai/x/errmsg"
+)
+
+var missingVariable = regexp.MustCompile(`map has no entry for key "([^"]*)"`)
+
+// promptFuncs are the functions available in prompt templates, on top of the
+// Go template built-ins.
+var promptFuncs = template.FuncMap{
+	// json encodes a value as JSON, which escapes quotes and newlines in
+	// strings.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join": func(elems []any, sep string) string {
+		s := make([]string, len(elems))
+		for i, e := range elems {
+			s[i] = fmt.Sprint(e)
+		}
+
+		return strings.Join(s, sep)
+	},
+}
+
+// RenderPrompt renders a prompt template with the provided variables. The
+// template follows the Go template syntax, so variables are referenced as
+// {{.name}} and lists and conditionals are expressed with {{range}} and
+// {{if}}. Referencing a variable that isn't defined is an error.
+func RenderPrompt(tmpl string, variables map[string]any) (string, error) {
+	t, err := template.New("prompt").Funcs(promptFuncs).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", errmsg.AddMessage(
+			fmt.Errorf("parsing prompt template: %w", err),
+			fmt.Sprintf("The prompt template is invalid: %s.", strings.TrimPrefix(err.Error(), "template: prompt:")),
+		)
+	}
+
+	if variables == nil {
+		variables = map[string]any{}
+	}
+
+	sb := new(strings.Builder)
+	if err := t.Execute(sb, variables); err != nil {
+		if m := missingVariable.FindStringSubmatch(err.Error()); m != nil {
+			return "", errmsg.AddMessage(
+				fmt.Errorf("rendering prompt template: %w", err),
+				fmt.Sprintf("The prompt template references the variable %q, which isn't defined.", m[1]),
+			)
+		}
+
+		return "", errmsg.AddMessage(
+			fmt.Errorf("rendering prompt template: %w", err),
+			fmt.Sprintf("The prompt template can't be rendered: %s.", strings.TrimPrefix(err.Error(), "template: prompt:")),
+		)
+	}
+
+	return sb.String(), nil
+}
+
+// PromptFromTemplate returns the prompt of a text generation input, which is
+// either provided directly or rendered from a template.
+func PromptFromTemplate(prompt, tmpl string, variables map[string]any) (string, error) {
+	if tmpl == "" {
+		return prompt, nil
+	}
+
+	if prompt != "" {
+		return "", errmsg.AddMessage(fmt.Errorf("prompt and prompt template"), "Provide either a prompt or a prompt template, not both.")
+	}
+
+	return RenderPrompt(tmpl, variables)
+}
@@ -0,0 +1,87 @@
+package util
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/instill-ai/x/errmsg"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	c := qt.New(t)
+
+	testcases := []struct {
+		name      string
+		tmpl      string
+		variables map[string]any
+		want      string
+		wantErr   string
+	}{
+		{
+			name:      "ok - variable",
+			tmpl:      "Summarize {{.text}}",
+			variables: map[string]any{"text": "this"},
+			want:      "Summarize this",
+		},
+		{
+			name: "ok - loop and conditional",
+			tmpl: "{{range .items}}- {{.}}\n{{end}}{{if .formal}}Regards.{{else}}Bye!{{end}}",
+			variables: map[string]any{
+				"items":  []any{"apples", "pears"},
+				"formal": false,
+			},
+			want: "- apples\n- pears\nBye!",
+		},
+		{
+			name:      "ok - functions",
+			tmpl:      `{"quote": {{json .quote}}, "tags": "{{join .tags ", "}}"}`,
+			variables: map[string]any{"quote": `"Hi"` + "\n", "tags": []any{"a", "b"}},
+			want:      `{"quote": "\"Hi\"\n", "tags": "a, b"}`,
+		},
+		{
+			name:      "ok - escaped delimiters",
+			tmpl:      `{{"{{.name}}"}} is {{.name}}`,
+			variables: map[string]any{"name": "Ada"},
+			want:      "{{.name}} is Ada",
+		},
+		{
+			name:    "nok - missing variable",
+			tmpl:    "Hello {{.name}}",
+			wantErr: `The prompt template references the variable "name", which isn't defined.`,
+		},
+		{
+			name:    "nok - invalid template",
+			tmpl:    "Hello {{.name",
+			wantErr: "The prompt template is invalid: 1: unclosed action.",
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			got, err := RenderPrompt(tc.tmpl, tc.variables)
+			if tc.wantErr != "" {
+				c.Check(errmsg.Message(err), qt.Equals, tc.wantErr)
+				return
+			}
+
+			c.Check(err, qt.IsNil)
+			c.Check(got, qt.Equals, tc.want)
+		})
+	}
+}
+
+func TestPromptFromTemplate(t *testing.T) {
+	c := qt.New(t)
+
+	got, err := PromptFromTemplate("Hello", "", nil)
+	c.Check(err, qt.IsNil)
+	c.Check(got, qt.Equals, "Hello")
+
+	got, err = PromptFromTemplate("", "Hello {{.name}}", map[string]any{"name": "Ada"})
+	c.Check(err, qt.IsNil)
+	c.Check(got, qt.Equals, "Hello Ada")
+
+	_, err = PromptFromTemplate("Hello", "Hello {{.name}}", nil)
+	c.Check(errmsg.Message(err), qt.Equals, "Provide either a prompt or a prompt template, not both.")
+}
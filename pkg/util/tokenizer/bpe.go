@@ -0,0 +1,191 @@
+// Package tokenizer counts the tokens in the texts sent to LLMs. OpenAI
+// models use byte pair encodings (BPE) compatible with tiktoken. Other models
+// fall back to an estimation.
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/instill-ai/connector/pkg/util"
+)
+
+// Counter counts the tokens in a text.
+type Counter interface {
+	CountTokens(text string) int
+}
+
+// CounterFunc adapts a function to the Counter interface.
+type CounterFunc func(text string) int
+
+// CountTokens implements Counter.
+func (f CounterFunc) CountTokens(text string) int { return f(text) }
+
+// Estimator approximates the number of tokens in a text when the tokenizer
+// of the model isn't known.
+var Estimator Counter = CounterFunc(func(text string) int { return util.EstimateTokens(text) })
+
+// Encoding is a byte pair encoding in the tiktoken format: the text is split
+// into pieces with a regular expression and the bytes of each piece are
+// merged by rank.
+type Encoding struct {
+	name    string
+	pattern *regexp.Regexp
+	ranks   map[string]int
+}
+
+// NewEncoding builds an encoding from its split pattern and its ranks, in the
+// .tiktoken file format: one base64-encoded token and its rank per line.
+//
+// Go regular expressions don't support lookaheads, so the pattern must not
+// contain the `\s+(?!\S)` alternative of the tiktoken patterns. It is
+// emulated by Encode.
+func NewEncoding(name, pattern string, ranks io.Reader) (*Encoding, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compiling %s pattern: %w", name, err)
+	}
+
+	enc := &Encoding{name: name, pattern: re, ranks: map[string]int{}}
+	scanner := bufio.NewScanner(ranks)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		token, rank, ok := bytes.Cut(line, []byte(" "))
+		if !ok {
+			return nil, fmt.Errorf("invalid %s rank line: %q", name, line)
+		}
+
+		b, err := base64.StdEncoding.DecodeString(string(token))
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s token: %w", name, err)
+		}
+
+		r, err := strconv.Atoi(string(rank))
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s rank: %w", name, err)
+		}
+
+		enc.ranks[string(b)] = r
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s ranks: %w", name, err)
+	}
+
+	return enc, nil
+}
+
+// Name returns the name of the encoding.
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// CountTokens implements Counter.
+func (e *Encoding) CountTokens(text string) int {
+	return len(e.Encode(text))
+}
+
+// Encode returns the tokens of a text.
+func (e *Encoding) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range e.split(text) {
+		if r, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, r)
+			continue
+		}
+
+		tokens = append(tokens, e.merge(piece)...)
+	}
+
+	return tokens
+}
+
+// split splits a text into the pieces that are encoded independently.
+func (e *Encoding) split(text string) []string {
+	var pieces []string
+	for len(text) > 0 {
+		loc := e.pattern.FindStringIndex(text)
+		if loc == nil || loc[0] > 0 {
+			// The patterns match any character, so this is a safeguard
+			// against custom patterns.
+			_, size := utf8.DecodeRuneInString(text)
+			loc = []int{0, size}
+		}
+
+		piece := text[:loc[1]]
+
+		// Emulate `\s+(?!\S)`: a whitespace run followed by text leaves its
+		// last character to the next piece.
+		if loc[1] < len(text) && isSpaceRun(piece) {
+			if last, size := utf8.DecodeLastRuneInString(piece); last != '\r' && last != '\n' && size < len(piece) {
+				piece = piece[:len(piece)-size]
+			}
+		}
+
+		pieces = append(pieces, piece)
+		text = text[len(piece):]
+	}
+
+	return pieces
+}
+
+func isSpaceRun(s string) bool {
+	for _, r := range s {
+		// The tiktoken patterns also consider the ASCII separators as
+		// whitespace.
+		if !unicode.IsSpace(r) && (r < 0x1c || r > 0x1f) {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+// merge applies the byte pair merges to a piece, lowest rank first.
+func (e *Encoding) merge(piece string) []int {
+	// Boundaries of the parts the piece is split into.
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+
+	for len(bounds) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(bounds); i++ {
+			if r, ok := e.ranks[piece[bounds[i]:bounds[i+2]]]; ok && r < bestRank {
+				best, bestRank = i, r
+			}
+		}
+
+		if best < 0 {
+			break
+		}
+
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+
+	tokens := make([]int, 0, len(bounds)-1)
+	for i := 0; i+1 < len(bounds); i++ {
+		r, ok := e.ranks[piece[bounds[i]:bounds[i+1]]]
+		if !ok {
+			// All the single bytes have a rank in a complete encoding.
+			r = -1
+		}
+
+		tokens = append(tokens, r)
+	}
+
+	return tokens
+}
@@ -0,0 +1,253 @@
+package tokenizer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// spaceClass is the Unicode whitespace matched by `\s` in the tiktoken
+	// patterns. In Go regular expressions, `\s` only matches ASCII
+	// whitespace.
+	spaceClass   = `\t\n\v\f\r\x{1c}-\x{1f}\x{85}\p{Z}`
+	contractions = `(?i:'s|'t|'re|'ve|'m|'ll|'d)`
+
+	encodingCL100K = "cl100k_base"
+	encodingO200K  = "o200k_base"
+
+	// failedLoadTTL is the time a failed encoding download is remembered,
+	// so executions don't wait for it on every call.
+	failedLoadTTL = 10 * time.Minute
+	loadTimeout   = 30 * time.Second
+
+	// encodingsURL is the location of the .tiktoken files published by
+	// OpenAI. The files are cached under this URL, as tiktoken does, even
+	// when they're downloaded from a mirror.
+	encodingsURL = "https://openaipublic.blob.core.windows.net/encodings"
+)
+
+var (
+	upper = `\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}`
+	lower = `\p{Ll}\p{Lm}\p{Lo}\p{M}`
+
+	patterns = map[string]string{
+		encodingCL100K: contractions +
+			`|[^\r\n\p{L}\p{N}]?\p{L}+` +
+			`|\p{N}{1,3}` +
+			`| ?[^` + spaceClass + `\p{L}\p{N}]+[\r\n]*` +
+			`|[` + spaceClass + `]*[\r\n]+` +
+			`|[` + spaceClass + `]+`,
+		encodingO200K: `[^\r\n\p{L}\p{N}]?[` + upper + `]*[` + lower + `]+` + contractions + `?` +
+			`|[^\r\n\p{L}\p{N}]?[` + upper + `]+[` + lower + `]*` + contractions + `?` +
+			`|\p{N}{1,3}` +
+			`| ?[^` + spaceClass + `\p{L}\p{N}]+[\r\n/]*` +
+			`|[` + spaceClass + `]*[\r\n]+` +
+			`|[` + spaceClass + `]+`,
+	}
+
+	// modelEncodings maps the OpenAI model prefixes to their encoding. The
+	// most specific prefixes go first.
+	modelEncodings = []struct {
+		prefix   string
+		encoding string
+	}{
+		{"gpt-4o", encodingO200K},
+		{"chatgpt-4o", encodingO200K},
+		{"gpt-4.1", encodingO200K},
+		{"gpt-4.5", encodingO200K},
+		{"gpt-5", encodingO200K},
+		{"o1", encodingO200K},
+		{"o3", encodingO200K},
+		{"o4", encodingO200K},
+		{"gpt-4", encodingCL100K},
+		{"gpt-3.5", encodingCL100K},
+		{"text-embedding-", encodingCL100K},
+	}
+
+	// encodingHashes are the SHA-256 hashes of the .tiktoken files, which
+	// tiktoken checks too. It is a variable so tests can serve other ranks.
+	encodingHashes = map[string]string{
+		encodingCL100K: "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7",
+		encodingO200K:  "446a9538cb6c348e3516120d7c08b09f57c36495e2acfffe59a5bf8b0cfb1a2d",
+	}
+
+	// encodings holds the loads of the encodings. encodingsMu only guards
+	// the map, so loading an encoding doesn't block the other ones.
+	encodings   = map[string]*encodingLoad{}
+	encodingsMu sync.Mutex
+)
+
+// encodingLoad is the load of an encoding, shared by the callers that need it
+// while it's in flight. Its result can be read once done is closed.
+type encodingLoad struct {
+	done chan struct{}
+	enc  *Encoding
+	err  error
+	at   time.Time
+}
+
+func (l *encodingLoad) load(ctx context.Context, name string) {
+	defer close(l.done)
+
+	l.enc, l.err = loadEncoding(ctx, name)
+	l.at = time.Now()
+}
+
+// expired reports whether a load should be retried, i.e. it failed more than
+// failedLoadTTL ago.
+func (l *encodingLoad) expired() bool {
+	select {
+	case <-l.done:
+		return l.err != nil && time.Since(l.at) >= failedLoadTTL
+	default:
+		return false
+	}
+}
+
+// EncodingForModel returns the name of the encoding of an OpenAI model. It
+// returns false if the model is unknown.
+func EncodingForModel(model string) (string, bool) {
+	for _, me := range modelEncodings {
+		if strings.HasPrefix(model, me.prefix) {
+			return me.encoding, true
+		}
+	}
+
+	return "", false
+}
+
+// ForOpenAIModel returns the tokenizer of an OpenAI model. The encoding ranks
+// are read from the TIKTOKEN_CACHE_DIR directory, which is shared with
+// tiktoken, and checked against their known hash.
+// Downloading the ranks that aren't cached is opt-in, so air-gapped
+// deployments don't wait for a remote server: the TIKTOKEN_ENCODINGS_URL
+// variable sets the location to download them from, e.g. the OpenAI one or a
+// mirror. The downloaded ranks are cached.
+// If the model is unknown or the encoding can't be loaded, an error is
+// returned and callers are expected to fall back to the Estimator.
+func ForOpenAIModel(ctx context.Context, model string) (*Encoding, error) {
+	name, ok := EncodingForModel(model)
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding for model %s", model)
+	}
+
+	encodingsMu.Lock()
+	l, ok := encodings[name]
+	if !ok || l.expired() {
+		l = &encodingLoad{done: make(chan struct{})}
+		encodings[name] = l
+
+		// The load outlives the caller that starts it, as other callers
+		// might be waiting for it. It's bounded by loadTimeout.
+		go l.load(context.WithoutCancel(ctx), name)
+	}
+	encodingsMu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.enc, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func loadEncoding(ctx context.Context, name string) (*Encoding, error) {
+	file := name + ".tiktoken"
+	url := encodingsURL + "/" + file
+	ranks, err := readCachedRanks(url)
+	if err != nil || checkRanks(name, ranks) != nil {
+		mirror := strings.TrimSuffix(os.Getenv("TIKTOKEN_ENCODINGS_URL"), "/")
+		if mirror == "" {
+			return nil, fmt.Errorf("loading %s: not cached and TIKTOKEN_ENCODINGS_URL is not set", name)
+		}
+
+		if ranks, err = downloadRanks(ctx, mirror+"/"+file); err != nil {
+			return nil, fmt.Errorf("loading %s: %w", name, err)
+		}
+
+		if err := checkRanks(name, ranks); err != nil {
+			return nil, fmt.Errorf("loading %s: %w", name, err)
+		}
+
+		writeCachedRanks(url, ranks)
+	}
+
+	return NewEncoding(name, patterns[name], bytes.NewReader(ranks))
+}
+
+// checkRanks verifies the hash of the ranks of an encoding, so corrupted or
+// tampered files are neither used nor cached.
+func checkRanks(name string, ranks []byte) error {
+	sum := sha256.Sum256(ranks)
+	if got := hex.EncodeToString(sum[:]); got != encodingHashes[name] {
+		return fmt.Errorf("unexpected hash %s", got)
+	}
+
+	return nil
+}
+
+// cachePath returns the file where tiktoken caches a URL.
+func cachePath(url string) string {
+	dir := os.Getenv("TIKTOKEN_CACHE_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "data-gym-cache")
+	}
+
+	key := sha1.Sum([]byte(url))
+	return filepath.Join(dir, hex.EncodeToString(key[:]))
+}
+
+func readCachedRanks(url string) ([]byte, error) {
+	return os.ReadFile(cachePath(url))
+}
+
+// writeCachedRanks caches the ranks on a best-effort basis.
+func writeCachedRanks(url string, ranks []byte) {
+	path := cachePath(url)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+
+	// Write atomically, as other processes might read the cache.
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, ranks, 0o644); err != nil {
+		return
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+func downloadRanks(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, loadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: status %d", url, resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
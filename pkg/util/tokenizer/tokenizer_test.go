@@ -0,0 +1,165 @@
+package tokenizer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// testRanks returns a tiktoken file with all the single bytes and the
+// provided merges, ranked in that order.
+func testRanks(merges ...string) string {
+	sb := new(strings.Builder)
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, m := range merges {
+		fmt.Fprintf(sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(m)), 256+i)
+	}
+
+	return sb.String()
+}
+
+func TestEncoding_Split(t *testing.T) {
+	c := qt.New(t)
+
+	testcases := []struct {
+		in   string
+		want []string
+	}{
+		{in: "Hello world", want: []string{"Hello", " world"}},
+		{in: "I'm here", want: []string{"I", "'m", " here"}},
+		{in: "don't!!", want: []string{"don", "'t", "!!"}},
+		{in: "1234567", want: []string{"123", "456", "7"}},
+		{in: "hi\n\n  there", want: []string{"hi", "\n\n", " ", " there"}},
+		{in: "a   ", want: []string{"a", "   "}},
+		{in: "héllo wörld", want: []string{"héllo", " wörld"}},
+		{in: "x  y", want: []string{"x", " ", " y"}},
+	}
+
+	enc, err := NewEncoding(encodingCL100K, patterns[encodingCL100K], strings.NewReader(testRanks()))
+	c.Assert(err, qt.IsNil)
+
+	for _, tc := range testcases {
+		c.Run(tc.in, func(c *qt.C) {
+			c.Check(enc.split(tc.in), qt.DeepEquals, tc.want)
+		})
+	}
+
+	c.Run("o200k", func(c *qt.C) {
+		enc, err := NewEncoding(encodingO200K, patterns[encodingO200K], strings.NewReader(testRanks()))
+		c.Assert(err, qt.IsNil)
+		c.Check(enc.split("HelloWorld I'M here/\n"), qt.DeepEquals, []string{"Hello", "World", " I'M", " here", "/\n"})
+	})
+}
+
+func TestEncoding_Encode(t *testing.T) {
+	c := qt.New(t)
+
+	enc, err := NewEncoding(encodingCL100K, patterns[encodingCL100K], strings.NewReader(testRanks("ll", "he", "hell", " w", "hello")))
+	c.Assert(err, qt.IsNil)
+
+	// "hello" is ranked as a whole, " world" is merged from its bytes.
+	c.Check(enc.Encode("hello world"), qt.DeepEquals, []int{260, 259, 'o', 'r', 'l', 'd'})
+	c.Check(enc.Encode("hellz"), qt.DeepEquals, []int{258, 'z'})
+	c.Check(enc.CountTokens(""), qt.Equals, 0)
+
+	_, err = NewEncoding("bad", patterns[encodingCL100K], strings.NewReader("aGk="))
+	c.Check(err, qt.ErrorMatches, "invalid bad rank line.*")
+}
+
+func TestForOpenAIModel(t *testing.T) {
+	c := qt.New(t)
+
+	var downloads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		if r.URL.Path != "/"+encodingCL100K+".tiktoken" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprint(w, testRanks("hi"))
+	}))
+	c.Cleanup(srv.Close)
+
+	sum := sha256.Sum256([]byte(testRanks("hi")))
+	hashes := encodingHashes
+
+	c.Setenv("TIKTOKEN_CACHE_DIR", c.TempDir())
+	encodingHashes = map[string]string{
+		encodingCL100K: hex.EncodeToString(sum[:]),
+		encodingO200K:  hashes[encodingO200K],
+	}
+	c.Cleanup(func() {
+		encodingHashes = hashes
+		encodings = map[string]*encodingLoad{}
+	})
+
+	// Downloads are opt-in.
+	_, err := ForOpenAIModel(context.Background(), "gpt-4-turbo")
+	c.Check(err, qt.ErrorMatches, "loading cl100k_base: not cached and TIKTOKEN_ENCODINGS_URL is not set")
+	c.Check(downloads, qt.Equals, 0)
+
+	c.Setenv("TIKTOKEN_ENCODINGS_URL", srv.URL+"/")
+	encodings = map[string]*encodingLoad{}
+
+	enc, err := ForOpenAIModel(context.Background(), "gpt-4-turbo")
+	c.Assert(err, qt.IsNil)
+	c.Check(enc.Name(), qt.Equals, encodingCL100K)
+	c.Check(enc.CountTokens("hi!"), qt.Equals, 2)
+
+	// The ranks are cached in memory and on disk, under the OpenAI URL.
+	_, err = ForOpenAIModel(context.Background(), "gpt-3.5-turbo")
+	c.Check(err, qt.IsNil)
+	c.Check(downloads, qt.Equals, 1)
+
+	cached := cachePath(encodingsURL + "/" + encodingCL100K + ".tiktoken")
+	_, err = os.Stat(cached)
+	c.Check(err, qt.IsNil)
+
+	// Cached ranks are used without downloading them.
+	c.Setenv("TIKTOKEN_ENCODINGS_URL", "")
+	encodings = map[string]*encodingLoad{}
+
+	_, err = ForOpenAIModel(context.Background(), "gpt-4")
+	c.Check(err, qt.IsNil)
+	c.Check(downloads, qt.Equals, 1)
+
+	c.Setenv("TIKTOKEN_ENCODINGS_URL", srv.URL)
+
+	// Failed downloads are remembered too.
+	_, err = ForOpenAIModel(context.Background(), "gpt-4o")
+	c.Check(err, qt.ErrorMatches, "loading o200k_base: .*status 404")
+	_, err = ForOpenAIModel(context.Background(), "gpt-4o-mini")
+	c.Check(err, qt.IsNotNil)
+	c.Check(downloads, qt.Equals, 2)
+
+	// Corrupted caches are downloaded again.
+	c.Assert(os.WriteFile(cached, []byte("corrupted"), 0o644), qt.IsNil)
+	encodings = map[string]*encodingLoad{}
+
+	_, err = ForOpenAIModel(context.Background(), "gpt-4")
+	c.Check(err, qt.IsNil)
+	c.Check(downloads, qt.Equals, 3)
+
+	// Ranks that don't match the known hash are rejected.
+	encodingHashes[encodingCL100K] = hashes[encodingCL100K]
+	encodings = map[string]*encodingLoad{}
+
+	_, err = ForOpenAIModel(context.Background(), "gpt-4")
+	c.Check(err, qt.ErrorMatches, "loading cl100k_base: unexpected hash .*")
+	c.Check(downloads, qt.Equals, 4)
+
+	_, err = ForOpenAIModel(context.Background(), "llama3")
+	c.Check(err, qt.ErrorMatches, "unknown encoding for model llama3")
+}
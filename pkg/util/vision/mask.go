@@ -0,0 +1,241 @@
+package vision
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Mask is a binary segmentation mask.
+type Mask struct {
+	width, height int
+	on            []bool
+}
+
+// NewMask returns an empty mask.
+func NewMask(width, height int) *Mask {
+	return &Mask{
+		width:  width,
+		height: height,
+		on:     make([]bool, width*height),
+	}
+}
+
+// DecodeMask reads a mask image. Pixels whose intensity is above the
+// threshold (a fraction of the maximum intensity) belong to the mask.
+func DecodeMask(img image.Image, threshold float64) *Mask {
+	bounds := img.Bounds()
+	m := NewMask(bounds.Dx(), bounds.Dy())
+
+	cut := uint16(threshold * 0xffff)
+	for y := 0; y < m.height; y++ {
+		for x := 0; x < m.width; x++ {
+			c := color.Gray16Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray16)
+			m.on[y*m.width+x] = c.Y > cut
+		}
+	}
+
+	return m
+}
+
+// DecodePNGMask reads a PNG mask image. See DecodeMask.
+func DecodePNGMask(b []byte, threshold float64) (*Mask, error) {
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeMask(img, threshold), nil
+}
+
+// EncodePNG encodes the mask as a black and white PNG image.
+func (m *Mask) EncodePNG() ([]byte, error) {
+	img := image.NewGray(image.Rect(0, 0, m.width, m.height))
+	for i, on := range m.on {
+		if on {
+			img.Pix[i] = 0xff
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// At reports whether a pixel belongs to the mask. Pixels outside the image
+// don't.
+func (m *Mask) At(x, y int) bool {
+	if x < 0 || y < 0 || x >= m.width || y >= m.height {
+		return false
+	}
+
+	return m.on[y*m.width+x]
+}
+
+// Set adds a pixel to the mask or removes it.
+func (m *Mask) Set(x, y int, on bool) {
+	if x < 0 || y < 0 || x >= m.width || y >= m.height {
+		return
+	}
+
+	m.on[y*m.width+x] = on
+}
+
+// Merge adds the pixels of another mask of the same size.
+func (m *Mask) Merge(other *Mask) error {
+	if other.width != m.width || other.height != m.height {
+		return fmt.Errorf("merging %dx%d mask into %dx%d mask", other.width, other.height, m.width, m.height)
+	}
+
+	for i, on := range other.on {
+		m.on[i] = m.on[i] || on
+	}
+
+	return nil
+}
+
+// Image returns the rectangle covered by the mask image.
+func (m *Mask) Image() image.Rectangle {
+	return image.Rect(0, 0, m.width, m.height)
+}
+
+// Bounds returns the smallest rectangle containing the mask pixels. It is
+// empty if the mask has no pixels.
+func (m *Mask) Bounds() image.Rectangle {
+	box := image.Rectangle{}
+	for y := 0; y < m.height; y++ {
+		for x := 0; x < m.width; x++ {
+			if m.At(x, y) {
+				box = box.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	return box
+}
+
+// Area returns the number of pixels in the mask.
+func (m *Mask) Area() int {
+	var area int
+	for _, on := range m.on {
+		if on {
+			area++
+		}
+	}
+
+	return area
+}
+
+// RLE returns the run-length encoding of the mask within a rectangle, as a
+// comma-separated list of alternating background and foreground run lengths
+// in row-major order. The first run is background, so it's 0 when the first
+// pixel belongs to the mask. Instance segmentation masks are encoded within
+// their bounding box, semantic segmentation masks within the whole image.
+func (m *Mask) RLE(r image.Rectangle) string {
+	var counts []string
+	run, on := 0, false
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if m.At(x, y) != on {
+				counts = append(counts, strconv.Itoa(run))
+				run, on = 0, !on
+			}
+
+			run++
+		}
+	}
+
+	counts = append(counts, strconv.Itoa(run))
+	return strings.Join(counts, ",")
+}
+
+// Polygon traces the outer contour of the mask, starting at its top-left
+// pixel, and returns the pixel coordinates of its vertices in clockwise
+// order. When the mask has several disconnected regions, only the one holding
+// the top-left pixel is traced.
+func (m *Mask) Polygon() []image.Point {
+	start, found := image.Point{}, false
+	for i, on := range m.on {
+		if on {
+			start, found = image.Pt(i%m.width, i/m.width), true
+			break
+		}
+	}
+
+	if !found {
+		return []image.Point{}
+	}
+
+	// Moore neighbourhood, clockwise starting west.
+	dirs := []image.Point{
+		{-1, 0}, {-1, -1}, {0, -1}, {1, -1},
+		{1, 0}, {1, 1}, {0, 1}, {-1, 1},
+	}
+
+	contour := []image.Point{start}
+	current, dir := start, 0
+	var second image.Point
+	// Every pixel is entered from at most 8 directions, which bounds the
+	// trace.
+	for steps := 0; steps < 8*len(m.on); steps++ {
+		next, moved := current, false
+		for i := 0; i < len(dirs); i++ {
+			d := (dir + i) % len(dirs)
+			if p := current.Add(dirs[d]); m.At(p.X, p.Y) {
+				// Resume the search around p from the background pixel
+				// checked before it.
+				back := current.Add(dirs[(d+len(dirs)-1)%len(dirs)]).Sub(p)
+				next, moved = p, true
+				dir = slices.Index(dirs, back)
+				break
+			}
+		}
+
+		if !moved {
+			break
+		}
+
+		// The contour is closed when the start pixel is left the same way
+		// as in the first step (Jacob's stopping criterion).
+		if steps == 0 {
+			second = next
+		} else if current == start && next == second {
+			contour = contour[:len(contour)-1]
+			break
+		}
+
+		current = next
+		contour = append(contour, current)
+	}
+
+	return simplifyPolygon(contour)
+}
+
+// simplifyPolygon removes the vertices of a contour that lie on a straight
+// segment. The tips of one-pixel-wide spikes, where the contour turns back,
+// are kept.
+func simplifyPolygon(contour []image.Point) []image.Point {
+	if len(contour) < 3 {
+		return contour
+	}
+
+	vertices := make([]image.Point, 0, len(contour))
+	for i, p := range contour {
+		prev := contour[(i+len(contour)-1)%len(contour)]
+		next := contour[(i+1)%len(contour)]
+		a, b := p.Sub(prev), next.Sub(p)
+		if a.X*b.Y-a.Y*b.X != 0 || a.X*b.X+a.Y*b.Y < 0 {
+			vertices = append(vertices, p)
+		}
+	}
+
+	return vertices
+}
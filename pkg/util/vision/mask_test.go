@@ -0,0 +1,166 @@
+package vision
+
+import (
+	"image"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// newTestMask builds a mask from rows of pixels, where '#' pixels belong to
+// the mask.
+func newTestMask(rows ...string) *Mask {
+	m := NewMask(len(rows[0]), len(rows))
+	for y, row := range rows {
+		for x, p := range row {
+			m.Set(x, y, p == '#')
+		}
+	}
+
+	return m
+}
+
+func TestMask_Geometry(t *testing.T) {
+	c := qt.New(t)
+
+	testcases := []struct {
+		name        string
+		rows        []string
+		wantBounds  image.Rectangle
+		wantArea    int
+		wantRLE     string
+		wantPolygon []image.Point
+	}{
+		{
+			name:        "single pixel",
+			rows:        []string{"...", ".#.", "..."},
+			wantBounds:  image.Rect(1, 1, 2, 2),
+			wantArea:    1,
+			wantRLE:     "0,1",
+			wantPolygon: []image.Point{{1, 1}},
+		},
+		{
+			name:        "rectangle",
+			rows:        []string{"###", "###"},
+			wantBounds:  image.Rect(0, 0, 3, 2),
+			wantArea:    6,
+			wantRLE:     "0,6",
+			wantPolygon: []image.Point{{0, 0}, {2, 0}, {2, 1}, {0, 1}},
+		},
+		{
+			name:        "cross",
+			rows:        []string{".#.", "###", ".#."},
+			wantBounds:  image.Rect(0, 0, 3, 3),
+			wantArea:    5,
+			wantRLE:     "1,1,1,3,1,1,1",
+			wantPolygon: []image.Point{{1, 0}, {2, 1}, {1, 2}, {0, 1}},
+		},
+		{
+			name:        "L shape",
+			rows:        []string{"#..", "#..", "###"},
+			wantBounds:  image.Rect(0, 0, 3, 3),
+			wantArea:    5,
+			wantRLE:     "0,1,2,1,2,3",
+			wantPolygon: []image.Point{{0, 0}, {0, 1}, {1, 2}, {2, 2}, {0, 2}},
+		},
+		{
+			name:        "one-pixel-wide V",
+			rows:        []string{"#...#", ".#.#.", "..#.."},
+			wantBounds:  image.Rect(0, 0, 5, 3),
+			wantArea:    5,
+			wantRLE:     "0,1,3,1,1,1,1,1,3,1,2",
+			wantPolygon: []image.Point{{0, 0}, {2, 2}, {4, 0}, {2, 2}},
+		},
+		{
+			name:        "ring",
+			rows:        []string{"....", ".###", ".#.#", ".###"},
+			wantBounds:  image.Rect(1, 1, 4, 4),
+			wantArea:    8,
+			wantRLE:     "0,4,1,4",
+			wantPolygon: []image.Point{{1, 1}, {3, 1}, {3, 3}, {1, 3}},
+		},
+		{
+			name:        "disconnected regions",
+			rows:        []string{"##..", "##..", "....", "...#"},
+			wantBounds:  image.Rect(0, 0, 4, 4),
+			wantArea:    5,
+			wantRLE:     "0,2,2,2,9,1",
+			wantPolygon: []image.Point{{0, 0}, {1, 0}, {1, 1}, {0, 1}},
+		},
+		{
+			name:        "empty",
+			rows:        []string{"..", ".."},
+			wantBounds:  image.Rectangle{},
+			wantArea:    0,
+			wantRLE:     "0",
+			wantPolygon: []image.Point{},
+		},
+	}
+
+	for _, tc := range testcases {
+		c.Run(tc.name, func(c *qt.C) {
+			m := newTestMask(tc.rows...)
+
+			bounds := m.Bounds()
+			c.Check(bounds, qt.Equals, tc.wantBounds)
+			c.Check(m.Area(), qt.Equals, tc.wantArea)
+			c.Check(m.RLE(bounds), qt.Equals, tc.wantRLE)
+			c.Check(m.Polygon(), qt.DeepEquals, tc.wantPolygon)
+		})
+	}
+}
+
+func TestMask_RLEWithinImage(t *testing.T) {
+	c := qt.New(t)
+
+	m := newTestMask("....", ".##.", "....")
+	c.Check(m.RLE(m.Image()), qt.Equals, "5,2,5")
+}
+
+func TestMask_Merge(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("ok", func(c *qt.C) {
+		m := newTestMask("#.", "..")
+		c.Assert(m.Merge(newTestMask("..", ".#")), qt.IsNil)
+		c.Check(m.RLE(m.Image()), qt.Equals, "0,1,2,1")
+	})
+
+	c.Run("nok - different sizes", func(c *qt.C) {
+		m := newTestMask("#.", "..")
+		err := m.Merge(newTestMask("#"))
+		c.Check(err, qt.ErrorMatches, "merging 1x1 mask into 2x2 mask")
+	})
+}
+
+func TestDecodePNGMask(t *testing.T) {
+	c := qt.New(t)
+
+	img := image.NewGray(image.Rect(0, 0, 3, 1))
+	img.Pix = []uint8{0x00, 0x60, 0xff}
+
+	c.Run("ok - default threshold", func(c *qt.C) {
+		m := DecodeMask(img, 0.5)
+		c.Check(m.RLE(m.Image()), qt.Equals, "2,1")
+	})
+
+	c.Run("ok - low threshold", func(c *qt.C) {
+		m := DecodeMask(img, 0.2)
+		c.Check(m.RLE(m.Image()), qt.Equals, "1,2")
+	})
+
+	c.Run("ok - PNG round trip", func(c *qt.C) {
+		b, err := newTestMask(".##", "#..").EncodePNG()
+		c.Assert(err, qt.IsNil)
+
+		m, err := DecodePNGMask(b, 0.5)
+		c.Assert(err, qt.IsNil)
+		c.Check(m.Image(), qt.Equals, image.Rect(0, 0, 3, 2))
+		c.Check(m.RLE(m.Image()), qt.Equals, "1,3,2")
+	})
+
+	c.Run("nok - invalid PNG", func(c *qt.C) {
+		_, err := DecodePNGMask([]byte("aaa"), 0.5)
+		c.Check(err, qt.IsNotNil)
+	})
+}
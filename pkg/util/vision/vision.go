@@ -0,0 +1,131 @@
+// Package vision defines the results of the computer vision tasks shared by
+// the connectors. The types follow the Instill Model task outputs
+// (`instill_types` in the component schema), so pipelines can switch between
+// vision providers without changing how they read the results. Each connector
+// converts the native format of its provider into these types.
+package vision
+
+import "image"
+
+// BoundingBox locates an object in an image, in pixels from its top-left
+// corner.
+type BoundingBox struct {
+	Top    float64 `json:"top"`
+	Left   float64 `json:"left"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// BoxFromCorners converts a box defined by its top-left (xmin, ymin) and
+// bottom-right (xmax, ymax) corners.
+func BoxFromCorners(xmin, ymin, xmax, ymax float64) BoundingBox {
+	return BoundingBox{
+		Top:    ymin,
+		Left:   xmin,
+		Width:  xmax - xmin,
+		Height: ymax - ymin,
+	}
+}
+
+// BoxFromRect converts a pixel rectangle.
+func BoxFromRect(r image.Rectangle) BoundingBox {
+	return BoundingBox{
+		Top:    float64(r.Min.Y),
+		Left:   float64(r.Min.X),
+		Width:  float64(r.Dx()),
+		Height: float64(r.Dy()),
+	}
+}
+
+// Classification is the category of an image.
+type Classification struct {
+	Category string  `json:"category"`
+	Score    float64 `json:"score"`
+}
+
+// TopClassification returns the best-scoring classification. It returns false
+// if there are no classifications.
+func TopClassification(classes []Classification) (Classification, bool) {
+	if len(classes) == 0 {
+		return Classification{}, false
+	}
+
+	top := classes[0]
+	for _, c := range classes[1:] {
+		if c.Score > top.Score {
+			top = c
+		}
+	}
+
+	return top, true
+}
+
+// DetectionObject is an object detected in an image.
+type DetectionObject struct {
+	BoundingBox BoundingBox `json:"bounding_box"`
+	Category    string      `json:"category"`
+	Score       float64     `json:"score"`
+}
+
+// Detection is the result of an object detection task.
+type Detection struct {
+	Objects []DetectionObject `json:"objects"`
+}
+
+// Keypoint is a point of interest of an object, such as a body joint. V is
+// its visibility.
+type Keypoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	V float64 `json:"v"`
+}
+
+// KeypointObject is an object located by its keypoints.
+type KeypointObject struct {
+	Keypoints   []Keypoint  `json:"keypoints"`
+	Score       float64     `json:"score"`
+	BoundingBox BoundingBox `json:"bounding_box"`
+}
+
+// Keypoints is the result of a keypoint detection task.
+type Keypoints struct {
+	Objects []KeypointObject `json:"objects"`
+}
+
+// OCRObject is a piece of text found in an image.
+type OCRObject struct {
+	BoundingBox BoundingBox `json:"bounding_box"`
+	Text        string      `json:"text"`
+	Score       float64     `json:"score"`
+}
+
+// OCR is the result of an optical character recognition task.
+type OCR struct {
+	Objects []OCRObject `json:"objects"`
+}
+
+// InstanceSegmentationObject is an object segmented in an image. Its mask is
+// run-length encoded within its bounding box (see Mask.RLE).
+type InstanceSegmentationObject struct {
+	RLE         string      `json:"rle"`
+	BoundingBox BoundingBox `json:"bounding_box"`
+	Category    string      `json:"category"`
+	Score       float64     `json:"score"`
+}
+
+// InstanceSegmentation is the result of an instance segmentation task.
+type InstanceSegmentation struct {
+	Objects []InstanceSegmentationObject `json:"objects"`
+}
+
+// SemanticSegmentationStuff is the region of an image that belongs to a
+// category. Its mask is run-length encoded over the whole image.
+type SemanticSegmentationStuff struct {
+	RLE      string `json:"rle"`
+	Category string `json:"category"`
+}
+
+// SemanticSegmentation is the result of a semantic segmentation task.
+type SemanticSegmentation struct {
+	Stuffs []SemanticSegmentationStuff `json:"stuffs"`
+}
@@ -0,0 +1,41 @@
+package vision
+
+import (
+	"image"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestBoxFromCorners(t *testing.T) {
+	c := qt.New(t)
+
+	got := BoxFromCorners(10, 20, 15, 40)
+	c.Check(got, qt.DeepEquals, BoundingBox{Top: 20, Left: 10, Width: 5, Height: 20})
+}
+
+func TestBoxFromRect(t *testing.T) {
+	c := qt.New(t)
+
+	got := BoxFromRect(image.Rect(1, 2, 4, 8))
+	c.Check(got, qt.DeepEquals, BoundingBox{Top: 2, Left: 1, Width: 3, Height: 6})
+}
+
+func TestTopClassification(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("ok", func(c *qt.C) {
+		got, ok := TopClassification([]Classification{
+			{Category: "cat", Score: 0.2},
+			{Category: "dog", Score: 0.7},
+			{Category: "bird", Score: 0.1},
+		})
+		c.Check(ok, qt.IsTrue)
+		c.Check(got, qt.DeepEquals, Classification{Category: "dog", Score: 0.7})
+	})
+
+	c.Run("nok - no classes", func(c *qt.C) {
+		_, ok := TopClassification(nil)
+		c.Check(ok, qt.IsFalse)
+	})
+}
@@ -1,6 +1,7 @@
 package website
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"sync"
@@ -10,6 +11,7 @@ import (
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/instill-ai/component/pkg/base"
+	"github.com/instill-ai/connector/pkg/util"
 
 	pipelinePB "github.com/instill-ai/protogen-go/vdp/pipeline/v1beta"
 )
@@ -34,6 +36,7 @@ type Connector struct {
 
 type Execution struct {
 	base.Execution
+	util.ExecutionContext
 }
 
 func Init(logger *zap.Logger) base.IConnector {
@@ -58,9 +61,7 @@ func (c *Connector) CreateExecution(defUID uuid.UUID, task string, config *struc
 }
 
 func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, error) {
-	outputs := []*structpb.Struct{}
-
-	for _, input := range inputs {
+	return util.ExecuteConcurrently(e.Context(), inputs, util.Concurrency(e.Context()), func(ctx context.Context, _ int, input *structpb.Struct) (*structpb.Struct, error) {
 		switch e.Task {
 		case taskScrapeWebsite:
 			inputStruct := ScrapeWebsiteInput{}
@@ -69,21 +70,15 @@ func (e *Execution) Execute(inputs []*structpb.Struct) ([]*structpb.Struct, erro
 				return nil, err
 			}
 
-			outputStruct, err := Scrape(inputStruct)
-			if err != nil {
-				return nil, err
-			}
-			output, err := base.ConvertToStructpb(outputStruct)
+			outputStruct, err := Scrape(ctx, inputStruct)
 			if err != nil {
 				return nil, err
 			}
-			outputs = append(outputs, output)
+			return base.ConvertToStructpb(outputStruct)
 		default:
 			return nil, fmt.Errorf("not supported task: %s", e.Task)
 		}
-	}
-
-	return outputs, nil
+	})
 }
 
 func (c *Connector) Test(defUID uuid.UUID, config *structpb.Struct, logger *zap.Logger) (pipelinePB.Connector_State, error) {
@@ -1,6 +1,7 @@
 package website
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -72,12 +73,16 @@ func existsInSlice(slice []string, item string) bool {
 }
 
 // getHTMLPageDoc returns the *goquery.Document of a webpage
-func getHTMLPageDoc(url string) (*goquery.Document, error) {
+func getHTMLPageDoc(ctx context.Context, url string) (*goquery.Document, error) {
 	// Request the HTML page.
 	client := &http.Client{Transport: &http.Transport{
 		DisableKeepAlives: true,
 	}}
-	res, err := client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -92,8 +97,9 @@ func getHTMLPageDoc(url string) (*goquery.Document, error) {
 	return doc, nil
 }
 
-// Scrape crawls a webpage and returns a slice of PageInfo
-func Scrape(input ScrapeWebsiteInput) (ScrapeWebsiteOutput, error) {
+// Scrape crawls a webpage and returns a slice of PageInfo. The crawl stops
+// when the context is cancelled.
+func Scrape(ctx context.Context, input ScrapeWebsiteInput) (ScrapeWebsiteOutput, error) {
 	output := ScrapeWebsiteOutput{}
 
 	if input.IncludeLinkHTML == nil {
@@ -130,7 +136,7 @@ func Scrape(input ScrapeWebsiteInput) (ScrapeWebsiteOutput, error) {
 
 	c.OnRequest(func(r *colly.Request) {
 
-		if input.MaxK > 0 && len(output.Pages) >= input.MaxK {
+		if ctx.Err() != nil || input.MaxK > 0 && len(output.Pages) >= input.MaxK {
 			r.Abort()
 			return
 		}
@@ -144,7 +150,7 @@ func Scrape(input ScrapeWebsiteInput) (ScrapeWebsiteOutput, error) {
 			// Add the URL to the slice if it doesn't already exist
 			pageLinks = append(pageLinks, strippedURL.String())
 			// Scrape the webpage information
-			doc, err := getHTMLPageDoc(strippedURL.String())
+			doc, err := getHTMLPageDoc(ctx, strippedURL.String())
 			if err != nil {
 				fmt.Printf("Error parsing %s: %v", strippedURL.String(), err)
 				return
@@ -184,5 +190,9 @@ func Scrape(input ScrapeWebsiteInput) (ScrapeWebsiteOutput, error) {
 	}
 	_ = c.Visit(input.TargetURL)
 
+	if err := ctx.Err(); err != nil {
+		return output, err
+	}
+
 	return output, nil
 }